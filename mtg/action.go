@@ -23,36 +23,97 @@ type Action struct {
 func (grp *Group) handleActionsQueue(ctx context.Context) error {
 	outputs, err := grp.store.ListActions(16)
 	if err != nil {
-		return err
+		return newStoreError("Group.ListActions", err)
 	}
 	for _, out := range outputs {
-		for _, wkr := range grp.workers {
-			var handled bool
-			switch out.Type {
-			case OutputTypeMultisig:
-				handled = wkr.ProcessOutput(ctx, out.AsMultisig())
-			case OutputTypeCollectible:
-				handled = wkr.ProcessCollectibleOutput(ctx, out.AsCollectible())
-			default:
-				panic(out.Type)
+		if grp.interrupted(ctx) {
+			return nil
+		}
+		// the action retried is handled at the time not before
+		at, attempts := out.CreatedAt, 0
+		retry, err := grp.readActionRetry(out.UniqueId())
+		if err != nil {
+			return err
+		}
+		if retry != nil {
+			ready, err := grp.readyActionRetry(ctx, retry)
+			if err != nil || !ready {
+				return err
+			}
+			at, attempts = retry.NotBefore, retry.Attempts+1
+		}
+		err = grp.fireTimers(ctx, at)
+		if err != nil || grp.interrupted(ctx) {
+			return err
+		}
+
+		// the approvals and halt votes from members are handled by the
+		// group itself
+		handled := false
+		if out.Type == OutputTypeMultisig {
+			handled, err = grp.handleHaltOutput(ctx, out.AsMultisig())
+			if err != nil {
+				return err
+			}
+		}
+		if out.Type == OutputTypeMultisig && !handled {
+			handled, err = grp.handleApprovalOutput(out.AsMultisig())
+			if err != nil {
+				return err
 			}
-			if handled {
-				break
+		}
+		if !handled {
+			actx := withAction(ctx, out.UniqueId(), at)
+			res := grp.processActionOutput(actx, out)
+			switch res.Kind {
+			case WorkerResultRetryAfter:
+				err = grp.scheduleActionRetry(actx, out, res.After, attempts)
+				if err != nil {
+					return err
+				}
+				err = grp.writeConsensusTime(at)
+				if err != nil {
+					return err
+				}
+				continue
+			case WorkerResultFatal:
+				return newConsensusError("Group.processActionOutput", "fatal %s %v", out.UniqueId(), res.Err)
+			case WorkerResultSkipped:
+				err = grp.refundUnhandledOutput(actx, out)
+				if err != nil {
+					return err
+				}
 			}
 		}
-		grp.writeAction(out, ActionStateDone)
+		err = grp.writeAction(out, ActionStateDone)
+		if err != nil {
+			return err
+		}
+		if retry != nil {
+			err = grp.clearActionRetry(out.UniqueId())
+			if err != nil {
+				return err
+			}
+		}
+		err = grp.writeConsensusTime(at)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func (grp *Group) writeAction(out *UnifiedOutput, state int) {
+func (grp *Group) writeAction(out *UnifiedOutput, state int) error {
 	logger.Verbosef("Group.writeAction(%v, %d)", out, state)
 	err := grp.store.WriteAction(&Action{
 		UTXOID:    out.UniqueId(),
 		CreatedAt: out.CreatedAt,
 		State:     state,
 	})
-	if err != nil {
-		panic(err)
+	if err != nil || state != ActionStateDone {
+		return newStoreError("Group.WriteAction", err)
 	}
+	// the initial action is written again when the output updated, and only
+	// the handled actions are in the same order on all members
+	return grp.writeAuditEntry(AuditKindAction, out.UniqueId(), state, "", true, out.CreatedAt)
 }
@@ -0,0 +1,195 @@
+package mtg
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/MixinNetwork/mixin/logger"
+)
+
+const (
+	AuditKindAction      = "action"
+	AuditKindTransaction = "transaction"
+	AuditKindUnlock      = "unlock"
+	AuditKindCompaction  = "compaction"
+	AuditKindTimer       = "timer"
+
+	auditVerifyBatchSize = 500
+)
+
+// an entry of the append only audit log, every entry is chained to the
+// previous one by hash, so any modification breaks the chain. the consensus
+// entries, i.e. the actions handled and the transactions built by them, are
+// the same on all members, and they are also chained to the digest, which
+// the members compare to detect divergence, because the other entries like
+// signing and unlocking differ among members.
+type AuditEntry struct {
+	Sequence  uint64
+	Kind      string
+	Subject   string
+	State     int
+	Detail    string
+	Consensus bool
+	CreatedAt time.Time
+	Round     uint64
+	Digest    crypto.Hash
+	Previous  crypto.Hash
+	Hash      crypto.Hash
+}
+
+// the digest of all consensus entries, members have the same digest at the
+// same round
+type AuditDigest struct {
+	Round  uint64
+	Digest crypto.Hash
+}
+
+// the store calls this to chain the entry to the last one in the same
+// database transaction, the last is nil for the first entry
+func (e *AuditEntry) Chain(last *AuditEntry) {
+	e.Sequence, e.Round = 1, 0
+	e.Previous, e.Digest = crypto.Hash{}, crypto.Hash{}
+	if last != nil {
+		e.Sequence = last.Sequence + 1
+		e.Round, e.Digest, e.Previous = last.Round, last.Digest, last.Hash
+	}
+	if e.Consensus {
+		e.Round = e.Round + 1
+		content := MsgpackMarshalPanic([]any{e.Kind, e.Subject, e.State, e.Detail})
+		e.Digest = crypto.NewHash(append(e.Digest[:], content...))
+	}
+	e.Hash = e.computeHash()
+}
+
+func (e *AuditEntry) computeHash() crypto.Hash {
+	b := MsgpackMarshalPanic([]any{
+		e.Sequence, e.Kind, e.Subject, e.State, e.Detail, e.Consensus,
+		e.CreatedAt.UnixNano(), e.Round, e.Digest, e.Previous,
+	})
+	return crypto.NewHash(b)
+}
+
+// verify the entries are chained one by one after the last entry
+func VerifyAuditEntries(last *AuditEntry, entries []*AuditEntry) error {
+	for _, e := range entries {
+		c := *e
+		c.Chain(last)
+		if c.Sequence != e.Sequence || c.Previous != e.Previous {
+			return newConsensusError("VerifyAuditEntries", "broken chain at %d", e.Sequence)
+		}
+		if c.Round != e.Round || c.Digest != e.Digest {
+			return newConsensusError("VerifyAuditEntries", "invalid digest at %d", e.Sequence)
+		}
+		if c.Hash != e.Hash {
+			return newConsensusError("VerifyAuditEntries", "invalid hash at %d", e.Sequence)
+		}
+		last = e
+	}
+	return nil
+}
+
+// list the entries from the sequence, which starts from 1
+func (grp *Group) ExportAuditLog(from uint64, limit int) ([]*AuditEntry, error) {
+	as, ok := grp.store.(AuditStore)
+	if !ok {
+		return nil, newStoreError("Group.ListAuditEntries", errStoreCapability(grp.store, "AuditStore"))
+	}
+	entries, err := as.ListAuditEntries(from, limit)
+	return entries, newStoreError("Group.ListAuditEntries", err)
+}
+
+// write the entries in the sequence range [from, to] as json lines, and a
+// zero to exports until the last entry
+func (grp *Group) WriteAuditLog(w io.Writer, from, to uint64) error {
+	enc := json.NewEncoder(w)
+	for {
+		entries, err := grp.ExportAuditLog(from, auditVerifyBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if to > 0 && e.Sequence > to {
+				return nil
+			}
+			err = enc.Encode(e)
+			if err != nil {
+				return err
+			}
+		}
+		if len(entries) < auditVerifyBatchSize {
+			return nil
+		}
+		from = entries[len(entries)-1].Sequence + 1
+	}
+}
+
+// verify the whole chain from the first entry, and return the digest
+func (grp *Group) VerifyAuditLog() (*AuditDigest, error) {
+	var last *AuditEntry
+	for {
+		entries, err := grp.ExportAuditLog(1+last.sequence(), auditVerifyBatchSize)
+		if err != nil {
+			return nil, err
+		}
+		err = VerifyAuditEntries(last, entries)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			last = entries[len(entries)-1]
+		}
+		if len(entries) < auditVerifyBatchSize {
+			return last.digest(), nil
+		}
+	}
+}
+
+func (grp *Group) AuditDigest() (*AuditDigest, error) {
+	as, ok := grp.store.(AuditStore)
+	if !ok {
+		return nil, newStoreError("Group.ReadLastAuditEntry", errStoreCapability(grp.store, "AuditStore"))
+	}
+	last, err := as.ReadLastAuditEntry()
+	if err != nil {
+		return nil, newStoreError("Group.ReadLastAuditEntry", err)
+	}
+	return last.digest(), nil
+}
+
+func (e *AuditEntry) sequence() uint64 {
+	if e == nil {
+		return 0
+	}
+	return e.Sequence
+}
+
+func (e *AuditEntry) digest() *AuditDigest {
+	if e == nil {
+		return &AuditDigest{}
+	}
+	return &AuditDigest{Round: e.Round, Digest: e.Digest}
+}
+
+// the entry is dropped if the store has no audit log
+func (grp *Group) writeAuditEntry(kind, subject string, state int, detail string, consensus bool, ts time.Time) error {
+	as, ok := grp.store.(AuditStore)
+	if !ok {
+		return nil
+	}
+	e := &AuditEntry{
+		Kind:      kind,
+		Subject:   subject,
+		State:     state,
+		Detail:    detail,
+		Consensus: consensus,
+		CreatedAt: ts,
+	}
+	err := as.AppendAuditEntry(e)
+	logger.Verbosef("Group.writeAuditEntry(%v) => %v", *e, err)
+	if err != nil {
+		return newStoreError("Group.AppendAuditEntry", err)
+	}
+	return grp.checkpointDigest(e)
+}
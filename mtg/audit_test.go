@@ -0,0 +1,71 @@
+package mtg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditChain(t *testing.T) {
+	require := require.New(t)
+
+	var entries []*AuditEntry
+	var last *AuditEntry
+	for i := 0; i < 6; i++ {
+		e := &AuditEntry{
+			Kind:      AuditKindAction,
+			Subject:   "35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a10",
+			State:     i,
+			Consensus: i%3 != 2,
+			CreatedAt: time.Unix(0, int64(i)),
+		}
+		e.Chain(last)
+		entries = append(entries, e)
+		last = e
+	}
+	require.Equal(uint64(6), last.Sequence)
+	require.Equal(uint64(4), last.Round)
+	require.Equal(entries[4].Digest, entries[5].Digest)
+	require.Equal(entries[4].Round, entries[5].Round)
+	require.NotEqual(entries[3].Digest, entries[4].Digest)
+	require.Nil(VerifyAuditEntries(nil, entries))
+	require.Nil(VerifyAuditEntries(entries[2], entries[3:]))
+
+	// the non consensus entries only change the hash, not the digest
+	other := *entries[2]
+	other.Detail = "signed"
+	other.Chain(entries[1])
+	require.Equal(entries[2].Digest, other.Digest)
+	require.NotEqual(entries[2].Hash, other.Hash)
+
+	err := VerifyAuditEntries(nil, []*AuditEntry{entries[0], entries[2]})
+	require.Equal(ErrorKindConsensus, ErrorKindOf(err))
+	require.Contains(err.Error(), "broken chain at 3")
+
+	tampered := *entries[3]
+	tampered.Detail = "tampered"
+	err = VerifyAuditEntries(entries[2], []*AuditEntry{&tampered})
+	require.Contains(err.Error(), "invalid digest at 4")
+
+	tampered = *entries[3]
+	tampered.CreatedAt = time.Unix(1, 0)
+	err = VerifyAuditEntries(entries[2], []*AuditEntry{&tampered})
+	require.Contains(err.Error(), "invalid hash at 4")
+}
+
+func TestAuditWithoutStore(t *testing.T) {
+	require := require.New(t)
+
+	grp := &Group{store: newTestPropertyStore()}
+	require.Nil(grp.writeAuditEntry(AuditKindAction, "subject", 0, "", true, time.Unix(1, 0)))
+	_, err := grp.ExportAuditLog(1, 0)
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+	_, err = grp.AuditDigest()
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+	err = grp.SetDigestExchange(&DigestExchange{Rounds: 16})
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+	require.Nil(grp.digest)
+	err = grp.SetDigestExchange(&DigestExchange{})
+	require.Equal(ErrorKindInput, ErrorKindOf(err))
+}
@@ -0,0 +1,91 @@
+package mtg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MixinNetwork/mixin/common"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+)
+
+// an entry is an output of the batch transaction, the trace id is decided
+// by the transaction trace id and the entry index, and the state follows
+// the transaction, so the app could check each payment in the batch
+type TransactionEntry struct {
+	TraceId   string
+	Receivers []string
+	Threshold int
+	Amount    string
+	State     int
+}
+
+// all entries are paid in a single kernel transaction with the same asset,
+// the transaction fails if any entry is invalid
+func (grp *Group) BuildBatchTransaction(ctx context.Context, assetId string, entries []*TransactionEntry, memo, traceId, groupId string) error {
+	if len(entries) == 0 || len(entries) >= common.SliceCountLimit {
+		return newInputError("Group.BuildBatchTransaction", "invalid entries count %d", len(entries))
+	}
+	var total decimal.Decimal
+	var batch []*TransactionEntry
+	for i, en := range entries {
+		op := fmt.Sprintf("Group.BuildBatchTransaction(%d)", i)
+		err := checkTransactionOutput(op, en.Receivers, en.Threshold, en.Amount)
+		if err != nil {
+			return err
+		}
+		// the kernel amount has 8 decimals, and the entry is never rounded
+		amount := decimal.RequireFromString(en.Amount)
+		if !amount.Equal(amount.Truncate(8)) {
+			return newInputError(op, "invalid amount precision %s", en.Amount)
+		}
+		total = total.Add(amount)
+		batch = append(batch, &TransactionEntry{
+			TraceId:   transactionEntryTraceId(traceId, i),
+			Receivers: en.Receivers,
+			Threshold: en.Threshold,
+			Amount:    amount.StringFixed(8),
+			State:     TransactionStateInitial,
+		})
+	}
+
+	e := grp.currentEpoch()
+	now := grp.buildTime(ctx)
+	tx := &Transaction{
+		GroupId:   groupId,
+		TraceId:   traceId,
+		State:     TransactionStateInitial,
+		AssetId:   assetId,
+		Amount:    total.StringFixed(8),
+		Memo:      memo,
+		UpdatedAt: now,
+		CreatedAt: now,
+		Epoch:     e.CreatedAt,
+		Entries:   batch,
+	}
+	return grp.writeNewTransaction(ctx, tx)
+}
+
+func transactionEntryTraceId(traceId string, index int) string {
+	return mixin.UniqueConversationID(traceId, fmt.Sprintf("ENTRY:%d", index))
+}
+
+// the single receiver transaction is a batch with only one entry
+func (tx *Transaction) outputEntries() []*TransactionEntry {
+	if len(tx.Entries) > 0 {
+		return tx.Entries
+	}
+	return []*TransactionEntry{{
+		TraceId:   tx.TraceId,
+		Receivers: tx.Receivers,
+		Threshold: tx.Threshold,
+		Amount:    tx.Amount,
+		State:     tx.State,
+	}}
+}
+
+func (tx *Transaction) updateEntries() {
+	for _, en := range tx.Entries {
+		en.State = tx.State
+	}
+}
@@ -3,7 +3,6 @@ package mtg
 import (
 	"context"
 	"encoding/hex"
-	"fmt"
 	"time"
 
 	"github.com/MixinNetwork/mixin/common"
@@ -58,39 +57,40 @@ func (grp *Group) BuildCollectibleMintTransaction(ctx context.Context, receivers
 
 func (grp *Group) BuildCollectibleTransferTransaction(ctx context.Context, receivers []string, threshold int, memo string, tokenId, traceId string) error {
 	if uuid.FromStringOrNil(tokenId).String() != tokenId {
-		return fmt.Errorf("invalid collectible token id %s", tokenId)
+		return newInputError("Group.BuildCollectibleTransferTransaction", "invalid collectible token id %s", tokenId)
 	}
 	extra := EncodeMixinExtra("", traceId, memo)
 	nfo := BuildExtraNFO([]byte(extra))
 	if len(nfo) > common.ExtraSizeGeneralLimit {
-		panic(memo)
+		return newInputError("Group.BuildCollectibleTransferTransaction", "invalid memo size %d", len(memo))
 	}
 	return grp.buildCollectibleTransaction(ctx, receivers, threshold, nfo, tokenId, traceId)
 }
 
 func (grp *Group) buildCollectibleTransaction(ctx context.Context, receivers []string, threshold int, nfo []byte, tokenId, traceId string) error {
+	op := "Group.buildCollectibleTransaction"
 	if threshold <= 0 || threshold > len(receivers) {
-		return fmt.Errorf("invalid receivers threshold %d/%d", threshold, len(receivers))
+		return newInputError(op, "invalid receivers threshold %d/%d", threshold, len(receivers))
 	}
 
 	nfm, err := DecodeNFOMemo(nfo)
 	if err != nil {
-		return fmt.Errorf("invalid nfo data %x %v", nfo, err)
+		return newInputError(op, "invalid nfo data %x %v", nfo, err)
 	}
 	if nfm.WillMint() && tokenId != "" {
-		return fmt.Errorf("invalid nfo and token combination %x %s", nfo, tokenId)
+		return newInputError(op, "invalid nfo and token combination %x %s", nfo, tokenId)
 	}
 	if !nfm.WillMint() && tokenId == "" {
-		return fmt.Errorf("invalid nfo and token combination %x %s", nfo, tokenId)
+		return newInputError(op, "invalid nfo and token combination %x %s", nfo, tokenId)
 	}
 
 	if uuid.FromStringOrNil(traceId).String() != traceId {
-		return fmt.Errorf("invalid collectible trace id %s", traceId)
+		return newInputError(op, "invalid collectible trace id %s", traceId)
 	}
 
 	old, err := grp.store.ReadCollectibleTransaction(traceId)
 	if err != nil || old != nil {
-		return err
+		return newStoreError("Group.ReadCollectibleTransaction", err)
 	}
 	tx := &CollectibleTransaction{
 		TraceId:   traceId,
@@ -99,10 +99,11 @@ func (grp *Group) buildCollectibleTransaction(ctx context.Context, receivers []s
 		Threshold: threshold,
 		Amount:    "1",
 		NFO:       nfo,
-		UpdatedAt: grp.clock.Now(),
+		UpdatedAt: grp.buildTime(ctx),
 		TokenId:   tokenId,
 	}
-	return grp.store.WriteCollectibleTransaction(tx.TraceId, tx)
+	err = grp.store.WriteCollectibleTransaction(tx.TraceId, tx)
+	return newStoreError("Group.WriteCollectibleTransaction", err)
 }
 
 func (out *CollectibleOutput) StateName() string {
@@ -142,7 +143,7 @@ func (o *CollectibleOutput) Unified() *UnifiedOutput {
 func (grp *Group) signCollectibleTransaction(ctx context.Context, tx *CollectibleTransaction) ([]byte, error) {
 	outputs, err := grp.store.ListCollectibleOutputsForTransaction(tx.TraceId)
 	if err != nil {
-		return nil, err
+		return nil, newStoreError("Group.ListCollectibleOutputsForTransaction", err)
 	}
 	if len(outputs) == 0 {
 		if tx.TokenId == "" {
@@ -152,10 +153,10 @@ func (grp *Group) signCollectibleTransaction(ctx context.Context, tx *Collectibl
 		}
 	}
 	if err != nil {
-		return nil, err
+		return nil, newStoreError("Group.ListCollectibleOutputsForToken", err)
 	}
 	if len(outputs) == 0 {
-		return nil, fmt.Errorf("empty outputs %s", tx.Amount)
+		return nil, newInputError("Group.signCollectibleTransaction", "empty outputs %s", tx.Amount)
 	}
 
 	ver, err := grp.buildRawCollectibleTransaction(ctx, tx, outputs)
@@ -167,14 +168,14 @@ func (grp *Group) signCollectibleTransaction(ctx context.Context, tx *Collectibl
 	}
 
 	raw := hex.EncodeToString(ver.Marshal())
-	req, err := grp.mixin.CreateCollectibleRequest(ctx, mixin.MultisigActionSign, raw)
+	req, err := grp.network.CreateCollectibleRequest(ctx, mixin.MultisigActionSign, raw)
 	if err != nil {
-		return nil, err
+		return nil, newNetworkError("Group.CreateCollectibleRequest", err)
 	}
 
-	req, err = grp.mixin.SignCollectibleRequest(ctx, req.RequestID, grp.pin)
+	req, err = grp.network.SignCollectibleRequest(ctx, req.RequestID, grp.pin)
 	if err != nil {
-		return nil, err
+		return nil, newNetworkError("Group.SignCollectibleRequest", err)
 	}
 
 	for _, out := range outputs {
@@ -184,7 +185,7 @@ func (grp *Group) signCollectibleTransaction(ctx context.Context, tx *Collectibl
 	}
 	err = grp.store.WriteCollectibleOutputs(outputs, tx.TraceId)
 	if err != nil {
-		return nil, err
+		return nil, newStoreError("Group.WriteCollectibleOutputs", err)
 	}
 	return hex.DecodeString(req.RawTransaction)
 }
@@ -211,20 +212,21 @@ func (grp *Group) buildRawCollectibleTransaction(ctx context.Context, tx *Collec
 		ver.AddInput(out.TransactionHash, out.OutputIndex)
 	}
 	if total.Cmp(common.NewIntegerFromString(tx.Amount)) < 0 {
-		return nil, fmt.Errorf("insufficient %s %s", total, tx.Amount)
+		return nil, newInputError("Group.buildRawCollectibleTransaction", "insufficient %s %s", total, tx.Amount)
 	}
 
-	keys, err := grp.mixin.BatchReadGhostKeys(ctx, []*mixin.GhostInput{{
+	e := grp.currentEpoch()
+	keys, err := grp.network.BatchReadGhostKeys(ctx, []*mixin.GhostInput{{
 		Receivers: tx.Receivers,
 		Index:     0,
 		Hint:      tx.TraceId,
 	}, {
-		Receivers: grp.members,
+		Receivers: e.Members,
 		Index:     1,
 		Hint:      tx.TraceId,
 	}})
 	if err != nil {
-		return nil, err
+		return nil, newNetworkError("Group.BatchReadGhostKeys", err)
 	}
 
 	amount, err := decimal.NewFromString(tx.Amount)
@@ -239,7 +241,7 @@ func (grp *Group) buildRawCollectibleTransaction(ctx context.Context, tx *Collec
 		if err != nil {
 			return nil, err
 		}
-		out := keys[1].DumpOutput(uint8(grp.threshold), amount)
+		out := keys[1].DumpOutput(uint8(e.Threshold), amount)
 		ver.Outputs = append(ver.Outputs, newCommonOutput(out))
 	}
 
@@ -19,8 +19,13 @@ type Configuration struct {
 		Threshold int      `toml:"threshold"`
 		Timestamp int64    `toml:"timestamp"`
 	} `toml:"genesis"`
-	GroupSize        int   `toml:"group-size"`
-	LoopWaitDuration int64 `toml:"loop-wait-duration"`
+	Snapshot struct {
+		Path string            `toml:"path"`
+		Keys map[string]string `toml:"keys"`
+	} `toml:"snapshot"`
+	GroupSize        int    `toml:"group-size"`
+	LoopWaitDuration int64  `toml:"loop-wait-duration"`
+	DigestRounds     uint64 `toml:"digest-rounds"`
 }
 
 func Setup(path string) (*Configuration, error) {
@@ -0,0 +1,238 @@
+package mtg
+
+import (
+	"context"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/MixinNetwork/mixin/logger"
+)
+
+const (
+	consensusTimeKey = "MTG:CONSENSUS:TIME"
+	timersKey        = "MTG:CONSENSUS:TIMERS"
+)
+
+// a timer fires deterministically on all members, when the first action
+// at or after its time is handled, and never by the local time, so it
+// waits for the next action when the group is idle
+type Timer struct {
+	Id      string
+	Name    string
+	At      time.Time
+	Payload []byte
+}
+
+// the handler is called with the timer time as the consensus time, and it
+// could build transactions or schedule other timers like a worker, the
+// timer is fired again if the error is retryable, otherwise the error is
+// decided by the error handler and the timer removed if continued
+type TimerHandler func(ctx context.Context, t *Timer) error
+
+type actionContextKey struct{}
+
+type actionContext struct {
+	id string
+	at time.Time
+}
+
+// the workers are called with the action in context, so the transactions
+// built by them are recorded as consensus entries, and they could use the
+// action time as the consensus time
+func withAction(ctx context.Context, id string, at time.Time) context.Context {
+	return context.WithValue(ctx, actionContextKey{}, &actionContext{id: id, at: at})
+}
+
+func actionFromContext(ctx context.Context) string {
+	ac, _ := ctx.Value(actionContextKey{}).(*actionContext)
+	if ac == nil {
+		return ""
+	}
+	return ac.id
+}
+
+// the consensus time is the created time of the output being processed, or
+// the time of the timer being fired, it's the same on all members, and the
+// workers should use it instead of the local time
+func ConsensusTime(ctx context.Context) (time.Time, bool) {
+	ac, _ := ctx.Value(actionContextKey{}).(*actionContext)
+	if ac == nil {
+		return time.Time{}, false
+	}
+	return ac.at, true
+}
+
+// the build time of the transactions, it's the consensus time if built
+// by a worker or timer, otherwise the local time
+func (grp *Group) buildTime(ctx context.Context) time.Time {
+	if ts, ok := ConsensusTime(ctx); ok {
+		return ts
+	}
+	return grp.clock.Now()
+}
+
+// the consensus time of the last action handled
+func (grp *Group) ConsensusNow() (time.Time, error) {
+	val, err := grp.store.ReadProperty([]byte(consensusTimeKey))
+	if err != nil || len(val) != 8 {
+		return time.Time{}, newStoreError("Group.ReadProperty", err)
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(val))), nil
+}
+
+// the transactions signed are stamped with the consensus time of the last
+// action handled instead of the local time, and never before built
+func (grp *Group) signingTime(updatedAt time.Time) (time.Time, error) {
+	now, err := grp.ConsensusNow()
+	if err != nil || now.Before(updatedAt) {
+		return updatedAt, err
+	}
+	return now, nil
+}
+
+func (grp *Group) writeConsensusTime(ts time.Time) error {
+	val := binary.BigEndian.AppendUint64(nil, uint64(ts.UnixNano()))
+	err := grp.store.WriteProperty([]byte(consensusTimeKey), val)
+	return newStoreError("Group.WriteProperty", err)
+}
+
+// all members must register the same handlers before Run
+func (grp *Group) RegisterTimerHandler(name string, h TimerHandler) {
+	grp.timerHandlers[name] = h
+}
+
+// the timer must be scheduled in a worker or timer handler, after the
+// consensus time of the context, and the timer with the same id is ignored
+func (grp *Group) ScheduleTimer(ctx context.Context, t *Timer) error {
+	now, ok := ConsensusTime(ctx)
+	if !ok {
+		return newInputError("Group.ScheduleTimer", "no consensus time %s", t.Id)
+	}
+	if !t.At.After(now) {
+		return newInputError("Group.ScheduleTimer", "invalid timer time %s %s", t.Id, t.At)
+	}
+	if grp.timerHandlers[t.Name] == nil {
+		return newInputError("Group.ScheduleTimer", "invalid timer handler %s %s", t.Id, t.Name)
+	}
+	old, err := readTimer(grp.store, t.Id)
+	if err != nil || old != nil {
+		return err
+	}
+	return writeTimer(grp.store, t)
+}
+
+func (grp *Group) CancelTimer(ctx context.Context, id string) error {
+	return deleteTimer(grp.store, id)
+}
+
+// the pending timers sorted by time
+func (grp *Group) ListTimers() ([]*Timer, error) {
+	return listTimers(grp.store, 0)
+}
+
+func readTimer(store Store, id string) (*Timer, error) {
+	if ts, ok := store.(TimerStore); ok {
+		t, err := ts.ReadTimer(id)
+		return t, newStoreError("Group.ReadTimer", err)
+	}
+	timers, err := readTimersProperty(store)
+	for _, t := range timers {
+		if t.Id == id {
+			return t, nil
+		}
+	}
+	return nil, err
+}
+
+func writeTimer(store Store, t *Timer) error {
+	if ts, ok := store.(TimerStore); ok {
+		return newStoreError("Group.WriteTimer", ts.WriteTimer(t))
+	}
+	timers, err := readTimersProperty(store)
+	if err != nil {
+		return err
+	}
+	return writeTimersProperty(store, append(timers, t))
+}
+
+func deleteTimer(store Store, id string) error {
+	if ts, ok := store.(TimerStore); ok {
+		return newStoreError("Group.DeleteTimer", ts.DeleteTimer(id))
+	}
+	timers, err := readTimersProperty(store)
+	if err != nil {
+		return err
+	}
+	for i, t := range timers {
+		if t.Id == id {
+			return writeTimersProperty(store, append(timers[:i], timers[i+1:]...))
+		}
+	}
+	return nil
+}
+
+func listTimers(store Store, limit int) ([]*Timer, error) {
+	if ts, ok := store.(TimerStore); ok {
+		timers, err := ts.ListTimers(limit)
+		return timers, newStoreError("Group.ListTimers", err)
+	}
+	timers, err := readTimersProperty(store)
+	if limit > 0 && len(timers) > limit {
+		timers = timers[:limit]
+	}
+	return timers, err
+}
+
+func readTimersProperty(store Store) ([]*Timer, error) {
+	val, err := store.ReadProperty([]byte(timersKey))
+	if err != nil || len(val) == 0 {
+		return nil, newStoreError("Group.ReadProperty", err)
+	}
+	var timers []*Timer
+	err = MsgpackUnmarshal(val, &timers)
+	return timers, newStoreError("Group.ReadProperty", err)
+}
+
+func writeTimersProperty(store Store, timers []*Timer) error {
+	sort.Slice(timers, func(i, j int) bool {
+		if timers[i].At.Equal(timers[j].At) {
+			return timers[i].Id < timers[j].Id
+		}
+		return timers[i].At.Before(timers[j].At)
+	})
+	err := store.WriteProperty([]byte(timersKey), MsgpackMarshalPanic(timers))
+	return newStoreError("Group.WriteProperty", err)
+}
+
+// fire the timers due before the action one by one, because the handler
+// could schedule or cancel other timers, and the timer is removed after
+// handled like the action, so it's fired again if the node crashed
+func (grp *Group) fireTimers(ctx context.Context, now time.Time) error {
+	for {
+		timers, err := listTimers(grp.store, 1)
+		if err != nil || len(timers) == 0 || timers[0].At.After(now) {
+			return err
+		}
+		t := timers[0]
+		logger.Printf("Group.fireTimer(%s, %s, %s)\n", t.Id, t.Name, t.At)
+		h := grp.timerHandlers[t.Name]
+		if h != nil {
+			err = h(withAction(ctx, "TIMER:"+t.Id, t.At), t)
+		}
+		if IsRetryableError(err) {
+			return err
+		}
+		if err != nil && !grp.handleError(ctx, "fireTimer", err) {
+			return nil
+		}
+		err = grp.CancelTimer(ctx, t.Id)
+		if err != nil {
+			return err
+		}
+		err = grp.writeAuditEntry(AuditKindTimer, t.Id, 0, t.Name, true, t.At)
+		if err != nil {
+			return err
+		}
+	}
+}
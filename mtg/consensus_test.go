@@ -0,0 +1,43 @@
+package mtg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimersWithoutTimerStore(t *testing.T) {
+	require := require.New(t)
+
+	grp := &Group{store: newTestPropertyStore(), timerHandlers: make(map[string]TimerHandler)}
+	grp.RegisterTimerHandler("test", func(ctx context.Context, t *Timer) error { return nil })
+	now := time.Unix(0, 1000)
+	ctx := withAction(context.Background(), "action", now)
+	for i, id := range []string{"c", "a", "b"} {
+		err := grp.ScheduleTimer(ctx, &Timer{Id: id, Name: "test", At: now.Add(time.Duration(3-i) * time.Second)})
+		require.Nil(err)
+	}
+	err := grp.ScheduleTimer(ctx, &Timer{Id: "a", Name: "test", At: now.Add(time.Hour)})
+	require.Nil(err)
+	err = grp.ScheduleTimer(ctx, &Timer{Id: "d", Name: "test", At: now})
+	require.NotNil(err)
+
+	timers, err := listTimers(grp.store, 2)
+	require.Nil(err)
+	require.Len(timers, 2)
+	require.Equal("b", timers[0].Id)
+	require.Equal("a", timers[1].Id)
+	timer, err := readTimer(grp.store, "c")
+	require.Nil(err)
+	require.Equal(now.Add(3*time.Second), timer.At)
+
+	err = grp.CancelTimer(ctx, "a")
+	require.Nil(err)
+	timers, err = grp.ListTimers()
+	require.Nil(err)
+	require.Len(timers, 2)
+	require.Equal("b", timers[0].Id)
+	require.Equal("c", timers[1].Id)
+}
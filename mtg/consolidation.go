@@ -0,0 +1,172 @@
+package mtg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/MixinNetwork/mixin/logger"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	consolidationSeed = "CONSOLIDATION"
+)
+
+// the group merges the oldest OutputsBatchSize outputs of a group id and
+// asset to a single output, when its unspent outputs count exceeds the
+// threshold. it only happens in idle time, i.e. all actions handled and no
+// pending transactions of the group id and asset.
+type ConsolidationPolicy struct {
+	Threshold int
+}
+
+func DefaultConsolidationPolicy() *ConsolidationPolicy {
+	return &ConsolidationPolicy{Threshold: OutputsBatchSize * 2}
+}
+
+// the fragmentation of the unspent outputs of the current epoch
+type FragmentationStats struct {
+	GroupId       string
+	AssetId       string
+	Outputs       int
+	Total         decimal.Decimal
+	Smallest      decimal.Decimal
+	Largest       decimal.Decimal
+	Consolidating bool
+}
+
+// the consolidation is disabled with a nil policy, and all members should
+// use the same policy, otherwise the compaction transactions built by some
+// members are only signed after the others drained them. the store must
+// implement EpochAssetStore.
+func (grp *Group) SetConsolidationPolicy(p *ConsolidationPolicy) error {
+	if p != nil && p.Threshold < OutputsBatchSize {
+		return newInputError("Group.SetConsolidationPolicy", "invalid threshold %d", p.Threshold)
+	}
+	if _, ok := grp.store.(EpochAssetStore); p != nil && !ok {
+		return newStoreError("Group.SetConsolidationPolicy", errStoreCapability(grp.store, "EpochAssetStore"))
+	}
+	grp.consolidation = p
+	return nil
+}
+
+// the stats read all unspent outputs of the current epoch to sum them, so
+// they are for the operators, and never read by the group loop
+func (grp *Group) FragmentationStats() ([]*FragmentationStats, error) {
+	es, ok := grp.store.(EpochAssetStore)
+	if !ok {
+		return nil, newStoreError("Group.FragmentationStats", errStoreCapability(grp.store, "EpochAssetStore"))
+	}
+	e := grp.currentEpoch()
+	counts, err := es.CountOutputsForMembers(e.MembersHash(), e.Threshold, mixin.UTXOStateUnspent)
+	if err != nil {
+		return nil, newStoreError("Group.CountOutputsForMembers", err)
+	}
+	pendings, err := grp.listPendingTransactions()
+	if err != nil {
+		return nil, err
+	}
+
+	var stats []*FragmentationStats
+	for _, c := range counts {
+		outputs, err := es.ListOutputsForMembersAsset(e.MembersHash(), e.Threshold, mixin.UTXOStateUnspent, c.GroupId, c.AssetId, 0)
+		if err != nil {
+			return nil, newStoreError("Group.ListOutputsForMembersAsset", err)
+		} else if len(outputs) == 0 {
+			continue
+		}
+		s := &FragmentationStats{
+			GroupId:  c.GroupId,
+			AssetId:  c.AssetId,
+			Outputs:  len(outputs),
+			Smallest: outputs[0].Amount,
+			Largest:  outputs[0].Amount,
+		}
+		for _, out := range outputs {
+			s.Total = s.Total.Add(out.Amount)
+			if out.Amount.Cmp(s.Smallest) < 0 {
+				s.Smallest = out.Amount
+			}
+			if out.Amount.Cmp(s.Largest) > 0 {
+				s.Largest = out.Amount
+			}
+		}
+		s.Consolidating = pendings[fmt.Sprintf("%d:%s:%s", e.CreatedAt.UnixNano(), c.GroupId, c.AssetId)]
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// the compaction transactions use the outputs of the current epoch only,
+// because the outputs of retired epochs are migrated by the maintenance
+func (grp *Group) consolidateOutputs(ctx context.Context) error {
+	policy := grp.consolidation
+	if policy == nil {
+		return nil
+	}
+	actions, err := grp.store.ListActions(1)
+	if err != nil || len(actions) > 0 {
+		return newStoreError("Group.ListActions", err)
+	}
+	es, ok := grp.store.(EpochAssetStore)
+	if !ok {
+		return nil
+	}
+	e := grp.currentEpoch()
+	counts, err := es.CountOutputsForMembers(e.MembersHash(), e.Threshold, mixin.UTXOStateUnspent)
+	if err != nil {
+		return newStoreError("Group.CountOutputsForMembers", err)
+	}
+	pendings, err := grp.listPendingTransactions()
+	if err != nil {
+		return err
+	}
+
+	// only the oldest outputs of the group id and asset to merge are listed
+	for _, c := range counts {
+		if c.Count <= policy.Threshold {
+			continue
+		}
+		k := c.GroupId + ":" + c.AssetId
+		if pendings[fmt.Sprintf("%d:%s", e.CreatedAt.UnixNano(), k)] {
+			continue
+		}
+		outputs, err := es.ListOutputsForMembersAsset(e.MembersHash(), e.Threshold, mixin.UTXOStateUnspent, c.GroupId, c.AssetId, OutputsBatchSize)
+		if err != nil {
+			return newStoreError("Group.ListOutputsForMembersAsset", err)
+		}
+		seed := mixin.UniqueConversationID(consolidationSeed, k)
+		err = grp.compactOutputs(ctx, e, c.GroupId, c.AssetId, seed, outputs)
+		logger.Printf("Group.consolidateOutputs(%s, %d) => %v\n", k, c.Count, err)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the unspent outputs of the epoch indexed by group id and asset, and
+// sorted by created time, at most limit outputs of all group ids listed
+func (grp *Group) listEpochUnspentOutputs(e *Epoch, limit int) (map[string][]*Output, error) {
+	outputs, err := listOutputsForMembers(grp.store, e, mixin.UTXOStateUnspent, limit)
+	if err != nil {
+		return nil, newStoreError("Group.ListOutputsForMembers", err)
+	}
+	batches := make(map[string][]*Output)
+	for _, out := range outputs {
+		key := out.GroupId + ":" + out.AssetID
+		batches[key] = append(batches[key], out)
+	}
+	return batches, nil
+}
+
+func sortedOutputsBatchKeys(batches map[string][]*Output) []string {
+	keys := make([]string, 0, len(batches))
+	for k := range batches {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
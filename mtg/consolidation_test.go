@@ -0,0 +1,20 @@
+package mtg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetConsolidationPolicy(t *testing.T) {
+	require := require.New(t)
+
+	grp := &Group{store: newTestPropertyStore()}
+	err := grp.SetConsolidationPolicy(&ConsolidationPolicy{Threshold: OutputsBatchSize - 1})
+	require.Equal(ErrorKindInput, ErrorKindOf(err))
+	err = grp.SetConsolidationPolicy(DefaultConsolidationPolicy())
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+	require.Nil(grp.consolidation)
+	err = grp.SetConsolidationPolicy(nil)
+	require.Nil(err)
+}
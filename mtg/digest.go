@@ -0,0 +1,294 @@
+package mtg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/MixinNetwork/mixin/logger"
+)
+
+const (
+	digestCheckpointKeyPrefix = "MTG:DIGEST:CHECKPOINT:"
+	digestCheckpointLastKey   = "MTG:DIGEST:CHECKPOINT:LAST"
+	digestResendPeriod        = 5 * time.Minute
+	digestPeerRoundsLimit     = 16
+)
+
+var digestMessagePrefix = []byte("MTG:DIGEST:")
+
+// the messenger to exchange digests among members, e.g. the tip messenger
+// used by mvm, the messages received should be passed to the group with
+// HandleDigestMessage
+type DigestMessenger interface {
+	QueueMessage(ctx context.Context, receiver string, b []byte) error
+}
+
+// the digest of the consensus audit entries is checkpointed every rounds,
+// and members exchange the checkpoints to detect divergence. all members
+// must use the same rounds from the genesis, otherwise the checkpoints are
+// different.
+type DigestExchange struct {
+	Messenger DigestMessenger
+	Rounds    uint64
+}
+
+// the consensus content of an audit entry
+type DigestEntry struct {
+	Kind    string
+	Subject string
+	State   int
+	Detail  string
+}
+
+// the checkpoint sent to other members, with all consensus entries since
+// the previous checkpoint, so the first different entry could be found
+type StateDigest struct {
+	Epoch   int64
+	Round   uint64
+	Digest  crypto.Hash
+	Entries []*DigestEntry
+}
+
+type digestCheckpoint struct {
+	Round    uint64
+	Sequence uint64
+	Digest   crypto.Hash
+}
+
+type digestState struct {
+	sync.Mutex
+	peers   map[uint64]map[string]*StateDigest
+	alerted map[string]bool
+	sentAt  time.Time
+	sent    uint64
+}
+
+// the digests are read from the audit log, so the store must implement
+// AuditStore
+func (grp *Group) SetDigestExchange(de *DigestExchange) error {
+	if de != nil && de.Rounds == 0 {
+		return newInputError("Group.SetDigestExchange", "invalid rounds %d", de.Rounds)
+	}
+	if _, ok := grp.store.(AuditStore); de != nil && !ok {
+		return newStoreError("Group.SetDigestExchange", errStoreCapability(grp.store, "AuditStore"))
+	}
+	grp.digest = de
+	grp.digestState = &digestState{
+		peers:   make(map[uint64]map[string]*StateDigest),
+		alerted: make(map[string]bool),
+	}
+	return nil
+}
+
+// the message not a digest is returned false, so the caller could handle
+// it as other messages, the peer must be authenticated by the messenger
+func (grp *Group) HandleDigestMessage(ctx context.Context, peer string, b []byte) (bool, error) {
+	if !bytes.HasPrefix(b, digestMessagePrefix) {
+		return false, nil
+	}
+	if grp.digest == nil || !grp.currentEpoch().HasMember(peer) || peer == grp.member {
+		return true, nil
+	}
+	var sd StateDigest
+	err := MsgpackUnmarshal(decompress(b[len(digestMessagePrefix):]), &sd)
+	if err != nil {
+		return true, newInputError("Group.HandleDigestMessage", "invalid digest %s %v", peer, err)
+	}
+	if sd.Epoch != grp.currentEpoch().CreatedAt.UnixNano() || sd.Round%grp.digest.Rounds != 0 {
+		return true, nil
+	}
+
+	ds := grp.digestState
+	ds.Lock()
+	defer ds.Unlock()
+	if ds.peers[sd.Round] == nil {
+		ds.peers[sd.Round] = make(map[string]*StateDigest)
+	}
+	ds.peers[sd.Round][peer] = &sd
+	for len(ds.peers) > digestPeerRoundsLimit {
+		var oldest uint64
+		for r := range ds.peers {
+			if oldest == 0 || r < oldest {
+				oldest = r
+			}
+		}
+		delete(ds.peers, oldest)
+	}
+	logger.Verbosef("Group.HandleDigestMessage(%s, %d, %s)\n", peer, sd.Round, sd.Digest)
+	return true, nil
+}
+
+// record the checkpoint when the consensus entry reaches the rounds
+func (grp *Group) checkpointDigest(e *AuditEntry) error {
+	if grp.digest == nil || !e.Consensus || e.Round%grp.digest.Rounds != 0 {
+		return nil
+	}
+	cp := MsgpackMarshalPanic(&digestCheckpoint{Round: e.Round, Sequence: e.Sequence, Digest: e.Digest})
+	err := grp.store.WriteProperty([]byte(fmt.Sprintf("%s%d", digestCheckpointKeyPrefix, e.Round)), cp)
+	if err != nil {
+		return newStoreError("Group.WriteProperty", err)
+	}
+	err = grp.store.WriteProperty([]byte(digestCheckpointLastKey), cp)
+	return newStoreError("Group.WriteProperty", err)
+}
+
+func (grp *Group) readDigestCheckpoint(key string) (*digestCheckpoint, error) {
+	val, err := grp.store.ReadProperty([]byte(key))
+	if err != nil || len(val) == 0 {
+		return nil, newStoreError("Group.ReadProperty", err)
+	}
+	var cp digestCheckpoint
+	err = MsgpackUnmarshal(val, &cp)
+	return &cp, newStoreError("Group.ReadProperty", err)
+}
+
+func (grp *Group) readStateDigest(round uint64) (*StateDigest, error) {
+	cp, err := grp.readDigestCheckpoint(fmt.Sprintf("%s%d", digestCheckpointKeyPrefix, round))
+	if err != nil || cp == nil {
+		return nil, err
+	}
+	sd := &StateDigest{
+		Epoch:  grp.currentEpoch().CreatedAt.UnixNano(),
+		Round:  cp.Round,
+		Digest: cp.Digest,
+	}
+	prev, err := grp.readDigestCheckpoint(fmt.Sprintf("%s%d", digestCheckpointKeyPrefix, round-grp.digest.Rounds))
+	if err != nil {
+		return nil, err
+	}
+	if prev == nil && round != grp.digest.Rounds {
+		return sd, nil
+	}
+	var from uint64 = 1
+	if prev != nil {
+		from = prev.Sequence + 1
+	}
+	entries, err := grp.ExportAuditLog(from, int(cp.Sequence-from+1))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Consensus {
+			sd.Entries = append(sd.Entries, &DigestEntry{e.Kind, e.Subject, e.State, e.Detail})
+		}
+	}
+	return sd, nil
+}
+
+// send the latest checkpoint to other members when it's new or not sent for
+// a while, and compare the checkpoints received
+func (grp *Group) exchangeDigests(ctx context.Context) error {
+	if grp.digest == nil {
+		return nil
+	}
+	last, err := grp.readDigestCheckpoint(digestCheckpointLastKey)
+	if err != nil || last == nil {
+		return err
+	}
+	ds := grp.digestState
+	if last.Round > ds.sent || time.Since(ds.sentAt) > digestResendPeriod {
+		sd, err := grp.readStateDigest(last.Round)
+		if err != nil || sd == nil {
+			return err
+		}
+		msg := append([]byte{}, digestMessagePrefix...)
+		msg = append(msg, compress(MsgpackMarshalPanic(sd))...)
+		for _, m := range grp.currentEpoch().Members {
+			if m == grp.member {
+				continue
+			}
+			err = grp.digest.Messenger.QueueMessage(ctx, m, msg)
+			if err != nil {
+				return newNetworkError("DigestMessenger.QueueMessage", err)
+			}
+		}
+		ds.sent, ds.sentAt = last.Round, time.Now()
+	}
+	return grp.compareDigests(ctx, last.Round)
+}
+
+func (grp *Group) compareDigests(ctx context.Context, last uint64) error {
+	ds := grp.digestState
+	ds.Lock()
+	var rounds []uint64
+	for r := range ds.peers {
+		if r <= last {
+			rounds = append(rounds, r)
+		}
+	}
+	ds.Unlock()
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] < rounds[j] })
+
+	e := grp.currentEpoch()
+	for _, r := range rounds {
+		local, err := grp.readStateDigest(r)
+		if err != nil {
+			return err
+		} else if local == nil {
+			continue
+		}
+		ds.Lock()
+		digests := map[string]*StateDigest{grp.member: local}
+		for m, sd := range ds.peers[r] {
+			digests[m] = sd
+		}
+		ds.Unlock()
+
+		counts := make(map[crypto.Hash]int)
+		for _, sd := range digests {
+			counts[sd.Digest]++
+		}
+		var majority *StateDigest
+		for _, m := range e.Members {
+			sd := digests[m]
+			if sd != nil && counts[sd.Digest]*2 > len(e.Members) {
+				majority = sd
+				break
+			}
+		}
+		if majority == nil {
+			continue
+		}
+		for _, m := range e.Members {
+			sd := digests[m]
+			key := fmt.Sprintf("%d:%s", r, m)
+			if sd == nil || sd.Digest == majority.Digest || ds.alerted[key] {
+				continue
+			}
+			ds.alerted[key] = true
+			entry := firstDifferentEntry(majority, sd)
+			if m == grp.member {
+				err = newConsensusError("Group.compareDigests", "local digest diverged at round %d %s %s", r, sd.Digest, entry)
+			} else {
+				err = newPolicyError("Group.compareDigests", "member %s digest diverged at round %d %s %s", m, r, sd.Digest, entry)
+			}
+			if !grp.handleError(ctx, "exchangeDigests", err) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// the entry is described by the majority one, or the different one when
+// the majority has less entries
+func firstDifferentEntry(majority, sd *StateDigest) string {
+	for i, me := range majority.Entries {
+		if i >= len(sd.Entries) {
+			return fmt.Sprintf("missing %s %s", me.Kind, me.Subject)
+		}
+		if *me != *sd.Entries[i] {
+			return fmt.Sprintf("%s %s %d %s", me.Kind, me.Subject, me.State, me.Detail)
+		}
+	}
+	if len(sd.Entries) > len(majority.Entries) {
+		e := sd.Entries[len(majority.Entries)]
+		return fmt.Sprintf("extra %s %s", e.Kind, e.Subject)
+	}
+	return "unknown"
+}
@@ -3,7 +3,9 @@ package mtg
 import (
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/MixinNetwork/mixin/common"
@@ -16,69 +18,263 @@ const (
 	outputsOrderCreated = "created"
 	outputsOrderUpdated = "updated"
 	outputsDrainingKey  = "outputs-draining-checkpoint"
+
+	drainedKindOutput  = "OUT"
+	drainedKindAction  = "ACT"
+	drainedPruneMargin = time.Hour
+	drainedPruneBatch  = 1000
 )
 
-func (grp *Group) drainOutputsFromNetwork(ctx context.Context, filter map[string]bool, batch int, order string) {
-	logger.Verbosef("Group.drainOutputsFromNetwork(%d, %s)\n", batch, order)
+// the output reported is not skipped because the error handler halts
+var errDrainHalted = errors.New("drain halted")
+
+// the draining metrics since the group built, the lag is the duration since
+// the updated checkpoint of the latest epoch, and the hits are the outputs
+// skipped because they have been drained
+type DrainMetrics struct {
+	Drained uint64
+	Hits    uint64
+	Pruned  uint64
+	Lag     time.Duration
+}
+
+type drainState struct {
+	sync.Mutex
+	metrics DrainMetrics
+	head    time.Time
+}
+
+func (grp *Group) DrainMetrics() DrainMetrics {
+	grp.drainState.Lock()
+	defer grp.drainState.Unlock()
+	return grp.drainState.metrics
+}
+
+func (grp *Group) drainOutputsFromNetwork(ctx context.Context, e *Epoch, batch int, order string) error {
+	logger.Verbosef("Group.drainOutputsFromNetwork(%s, %d, %s)\n", e, batch, order)
 	if order != outputsOrderCreated && order != outputsOrderUpdated {
 		panic(order)
 	}
 
-	for {
-		checkpoint, err := grp.readDrainingCheckpoint(ctx, order)
+	for !grp.interrupted(ctx) {
+		checkpoint, err := grp.readDrainingCheckpoint(ctx, e, order)
 		if err != nil {
-			time.Sleep(3 * time.Second)
-			continue
+			return newStoreError("Group.readDrainingCheckpoint", err)
 		}
-		outputs, err := grp.readUnifiedOutputs(ctx, grp.members, uint8(grp.threshold), checkpoint, batch, order)
-		logger.Verbosef("Group.readUnifiedOutputs(%s, %s) => %d %v\n", checkpoint, order, len(outputs), err)
+		var outputs []*UnifiedOutput
+		err = grp.retry(ctx, func() error {
+			outputs, err = grp.network.ReadUnifiedOutputs(ctx, e.Members, uint8(e.Threshold), checkpoint, batch, order)
+			logger.Verbosef("Group.ReadUnifiedOutputs(%s, %s) => %d %v\n", checkpoint, order, len(outputs), err)
+			return newNetworkError("Group.ReadUnifiedOutputs", err)
+		})
 		if err != nil {
-			time.Sleep(3 * time.Second)
-			continue
+			return err
 		}
+		grp.recordNetworkHead(outputs)
 
-		checkpoint = grp.processUnifiedOutputs(ctx, filter, checkpoint, outputs, order)
-		grp.writeDrainingCheckpoint(ctx, order, checkpoint)
+		checkpoint, err = grp.processUnifiedOutputs(ctx, e, checkpoint, outputs, order)
+		if err != nil {
+			return err
+		}
+		err = grp.writeDrainingCheckpoint(ctx, e, order, checkpoint)
+		if err != nil {
+			return newStoreError("Group.writeDrainingCheckpoint", err)
+		}
+		if order == outputsOrderUpdated && e.CreatedAt.Equal(grp.currentEpoch().CreatedAt) {
+			grp.drainState.Lock()
+			grp.drainState.metrics.Lag = time.Since(checkpoint)
+			grp.drainState.Unlock()
+		}
 		if len(outputs) < batch/2 {
 			break
 		}
 	}
+	return nil
 }
 
-func (grp *Group) processUnifiedOutputs(ctx context.Context, filter map[string]bool, checkpoint time.Time, outputs []*UnifiedOutput, order string) time.Time {
+// the checkpoint is only returned after all outputs processed, and the
+// output is only marked drained after success, so a failed batch is drained
+// again, and the drained outputs are persisted to survive restarts
+func (grp *Group) processUnifiedOutputs(ctx context.Context, e *Epoch, checkpoint time.Time, outputs []*UnifiedOutput, order string) (time.Time, error) {
+	start := checkpoint
 	for _, out := range outputs {
 		if order == outputsOrderCreated {
 			checkpoint = out.CreatedAt
 		} else {
 			checkpoint = out.UpdatedAt
 		}
-		key := fmt.Sprintf("OUT:%s:%d", out.UniqueId(), out.UpdatedAt.UnixNano())
-		if filter[key] || out.UpdatedAt.Before(grp.epoch) {
+		if out.UpdatedAt.Before(e.CreatedAt) {
+			continue
+		}
+		drained, err := grp.readDrainedOutput(drainedKindOutput, out)
+		if err != nil {
+			return checkpoint, err
+		} else if drained {
 			continue
 		}
-		filter[key] = true
 		if out.Type == OutputTypeMultisig {
-			grp.processMultisigOutput(ctx, out.AsMultisig())
+			err = grp.processMultisigOutput(ctx, e, out.AsMultisig())
 		} else if out.Type == OutputTypeCollectible {
-			grp.processCollectibleOutput(out.AsCollectible())
+			err = grp.processCollectibleOutput(ctx, out.AsCollectible())
+		}
+		if err == errDrainHalted {
+			return start, nil
+		} else if err != nil {
+			return checkpoint, err
+		}
+		err = grp.writeDrainedOutput(drainedKindOutput, out)
+		if err != nil {
+			return checkpoint, err
 		}
 	}
 
+	// the outputs created after the epoch retired are not actions anymore,
+	// they are handled by the maintenance group
+	retiredAt := grp.epochRetiredAt(e)
 	for _, utxo := range outputs {
-		key := fmt.Sprintf("ACT:%s:%d", utxo.UniqueId(), utxo.UpdatedAt.UnixNano())
-		if filter[key] || utxo.UpdatedAt.Before(grp.epoch) {
+		if utxo.UpdatedAt.Before(e.CreatedAt) {
 			continue
 		}
-		filter[key] = true
-		exist, err := grp.readOldTransaction(utxo)
+		drained, err := grp.readDrainedOutput(drainedKindAction, utxo)
 		if err != nil {
-			panic(utxo.TransactionHash)
-		} else if exist {
+			return checkpoint, err
+		} else if drained {
+			continue
+		}
+		if !retiredAt.IsZero() && !utxo.CreatedAt.Before(retiredAt) {
+			err = grp.writeDrainedOutput(drainedKindAction, utxo)
+			if err != nil {
+				return checkpoint, err
+			}
 			continue
 		}
-		grp.writeAction(utxo, ActionStateInitial)
+		exist, err := grp.readOldTransaction(utxo)
+		if err != nil {
+			return checkpoint, newStoreError("Group.readOldTransaction", err)
+		}
+		if !exist {
+			err = grp.writeAction(utxo, ActionStateInitial)
+			if err != nil {
+				return checkpoint, err
+			}
+		}
+		err = grp.writeDrainedOutput(drainedKindAction, utxo)
+		if err != nil {
+			return checkpoint, err
+		}
+	}
+	return checkpoint, nil
+}
+
+func (grp *Group) recordNetworkHead(outputs []*UnifiedOutput) {
+	grp.drainState.Lock()
+	defer grp.drainState.Unlock()
+	for _, out := range outputs {
+		if out.UpdatedAt.After(grp.drainState.head) {
+			grp.drainState.head = out.UpdatedAt
+		}
+	}
+}
+
+// the drained index in memory for the store without DrainStore
+type memoryDrainStore struct {
+	sync.Mutex
+	outputs map[string]time.Time
+}
+
+func newMemoryDrainStore() *memoryDrainStore {
+	return &memoryDrainStore{outputs: make(map[string]time.Time)}
+}
+
+func (ms *memoryDrainStore) ReadDrainedOutput(kind, id string, updatedAt time.Time) (bool, error) {
+	ms.Lock()
+	defer ms.Unlock()
+	_, found := ms.outputs[memoryDrainedKey(kind, id, updatedAt)]
+	return found, nil
+}
+
+func (ms *memoryDrainStore) WriteDrainedOutput(kind, id string, updatedAt time.Time) error {
+	ms.Lock()
+	defer ms.Unlock()
+	ms.outputs[memoryDrainedKey(kind, id, updatedAt)] = updatedAt
+	return nil
+}
+
+func (ms *memoryDrainStore) PruneDrainedOutputs(before time.Time, limit int) (int, error) {
+	ms.Lock()
+	defer ms.Unlock()
+	var count int
+	for k, ts := range ms.outputs {
+		if count == limit {
+			break
+		}
+		if ts.Before(before) {
+			delete(ms.outputs, k)
+			count++
+		}
+	}
+	return count, nil
+}
+
+func memoryDrainedKey(kind, id string, updatedAt time.Time) string {
+	return fmt.Sprintf("%s:%s:%d", kind, id, updatedAt.UnixNano())
+}
+
+func (grp *Group) readDrainedOutput(kind string, out *UnifiedOutput) (bool, error) {
+	drained, err := grp.drained.ReadDrainedOutput(kind, out.UniqueId(), out.UpdatedAt)
+	if err != nil {
+		return false, newStoreError("Group.ReadDrainedOutput", err)
+	}
+	if drained {
+		grp.drainState.Lock()
+		grp.drainState.metrics.Hits++
+		grp.drainState.Unlock()
+	}
+	return drained, nil
+}
+
+func (grp *Group) writeDrainedOutput(kind string, out *UnifiedOutput) error {
+	err := grp.drained.WriteDrainedOutput(kind, out.UniqueId(), out.UpdatedAt)
+	if err != nil {
+		return newStoreError("Group.WriteDrainedOutput", err)
+	}
+	if kind == drainedKindOutput {
+		grp.drainState.Lock()
+		grp.drainState.metrics.Drained++
+		grp.drainState.Unlock()
+	}
+	return nil
+}
+
+// the outputs updated before all draining checkpoints are never drained
+// again, the margin tolerates the time precision of the network
+func (grp *Group) pruneDrainedOutputs(ctx context.Context) error {
+	var before time.Time
+	for _, e := range grp.ListEpochs() {
+		for _, order := range []string{outputsOrderCreated, outputsOrderUpdated} {
+			checkpoint, err := grp.readDrainingCheckpoint(ctx, e, order)
+			if err != nil {
+				return newStoreError("Group.readDrainingCheckpoint", err)
+			}
+			if before.IsZero() || checkpoint.Before(before) {
+				before = checkpoint
+			}
+		}
+	}
+	before = before.Add(-drainedPruneMargin)
+	for !grp.interrupted(ctx) {
+		count, err := grp.drained.PruneDrainedOutputs(before, drainedPruneBatch)
+		if err != nil {
+			return newStoreError("Group.PruneDrainedOutputs", err)
+		}
+		grp.drainState.Lock()
+		grp.drainState.metrics.Pruned += uint64(count)
+		grp.drainState.Unlock()
+		if count < drainedPruneBatch {
+			break
+		}
 	}
-	return checkpoint
+	return nil
 }
 
 func (grp *Group) readOldTransaction(utxo *UnifiedOutput) (bool, error) {
@@ -92,32 +288,27 @@ func (grp *Group) readOldTransaction(utxo *UnifiedOutput) (bool, error) {
 	panic(utxo.Type)
 }
 
-func (grp *Group) processMultisigOutput(ctx context.Context, out *Output) {
+func (grp *Group) processMultisigOutput(ctx context.Context, e *Epoch, out *Output) error {
 	logger.Verbosef("Group.processMultisigOutput(%v)", out)
+	// the output signed with an invalid raw is reported and skipped, so
+	// the draining checkpoint still advances, unless the handler halts
 	ver, extra := decodeTransactionWithExtra(out.SignedTx)
 	if out.SignedTx != "" && ver == nil {
-		panic(out.SignedTx)
+		return grp.skipInvalidOutput(ctx, "processMultisigOutput", newInputError("Group.processMultisigOutput", "invalid signed transaction %s %s", out.UTXOID, out.SignedTx))
 	}
-	// FIXME do more consensus check to unlock transactions
 	if ver != nil && ver.Version < common.TxVersionReferences &&
 		ver.AggregatedSignature == nil && len(ver.SignaturesMap) == 0 {
-		req, err := grp.createMultisigUntilSufficient(ctx, mixin.MultisigActionUnlock, out.SignedTx)
-		if err != nil {
-			panic(err)
-		}
-		err = grp.mixin.UnlockMultisig(ctx, req.RequestID, grp.pin)
-		if err != nil {
-			panic(err)
+		unlocked, err := grp.unlockMultisigOutput(ctx, out, ver)
+		if err != nil || unlocked {
+			return err
 		}
-		return
 	}
-	if grp.checkCompactTransactionRequest(ctx, ver, extra) {
+	if grp.checkCompactTransactionRequest(ctx, e, ver, extra) {
 		amount := ver.Outputs[0].Amount.String()
-		receivers, threshold := grp.GetMembers(), grp.GetThreshold()
-		err := grp.buildTransaction(ctx, out.AssetID, receivers, threshold, amount, CompactionTransactionMemo, extra.T.String(), extra.G, time.Unix(0, 0), nil)
+		err := grp.buildTransaction(ctx, out.AssetID, e.Members, e.Threshold, amount, CompactionTransactionMemo, extra.T.String(), extra.G, time.Unix(0, 0), nil, e)
 		logger.Printf("Group.drainCompactTransaction(%s, %s, %s) => %v\n", extra.G, extra.T.String(), amount, err)
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
 	var groupId, traceId string
@@ -131,8 +322,7 @@ func (grp *Group) processMultisigOutput(ctx context.Context, out *Output) {
 	// FIXME get trace id from other members could break the consensus
 	// this in theory won't affect asset security though
 	if out.State == OutputStateUnspent || (ver.AggregatedSignature == nil && len(ver.SignaturesMap) == 0) {
-		grp.writeOutputOrPanic(out, traceId)
-		return
+		return grp.writeOutput(out, traceId)
 	}
 	tx := &Transaction{
 		GroupId: groupId,
@@ -143,43 +333,109 @@ func (grp *Group) processMultisigOutput(ctx context.Context, out *Output) {
 	}
 
 	out.State = OutputStateSpent
-	grp.writeOutputOrPanic(out, tx.TraceId)
+	err := grp.writeOutput(out, tx.TraceId)
+	if err != nil {
+		return err
+	}
 
 	old, err := grp.store.ReadTransactionByTraceId(tx.TraceId)
 	if err != nil {
-		panic(err)
+		return newStoreError("Group.ReadTransactionByTraceId", err)
 	}
 	if old != nil && old.State >= TransactionStateSigned {
-		return
+		return nil
+	}
+	// keep the transaction details built by this node, e.g. the entries
+	if old != nil {
+		old.State, old.Raw, old.Hash = tx.State, tx.Raw, tx.Hash
+		tx = old
+	}
+	var usages map[string][]byte
+	if tx.AssetId != "" {
+		usages, err = grp.countOutflowUsage(tx)
+		if err != nil {
+			return err
+		}
+	}
+	return grp.writeTransactionWithProperties(tx, usages)
+}
+
+// the unlock refused by the signing policy is reported to the error handler,
+// and the output is processed as usual
+func (grp *Group) unlockMultisigOutput(ctx context.Context, out *Output, ver *common.VersionedTransaction) (bool, error) {
+	tx, err := grp.store.ReadTransactionByHash(ver.PayloadHash())
+	if err != nil {
+		return false, newStoreError("Group.ReadTransactionByHash", err)
+	}
+	err = grp.checkSigningRequest(ctx, &SigningRequest{
+		Action:      mixin.MultisigActionUnlock,
+		Raw:         ver,
+		Transaction: tx,
+		Outputs:     []*Output{out},
+	})
+	if ErrorKindOf(err) == ErrorKindPolicy {
+		return false, grp.skipInvalidOutput(ctx, "processMultisigOutput", err)
+	} else if err != nil {
+		return false, err
 	}
-	grp.writeTansactionOrPanic(tx)
+
+	req, err := grp.createMultisigUntilSufficient(ctx, mixin.MultisigActionUnlock, out.SignedTx)
+	if err != nil {
+		return false, err
+	}
+	err = checkRequestedRaw(ver, req.RawTransaction)
+	if err != nil {
+		return false, grp.skipInvalidOutput(ctx, "processMultisigOutput", err)
+	}
+	err = grp.retry(ctx, func() error {
+		err := grp.network.UnlockMultisig(ctx, req.RequestID, grp.pin)
+		return newNetworkError("Group.UnlockMultisig", err)
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, grp.writeAuditEntry(AuditKindUnlock, out.UTXOID, 0, ver.PayloadHash().String(), false, grp.clock.Now())
 }
 
-func (grp *Group) writeOutputOrPanic(out *Output, traceId string) {
+// the invalid output is skipped if the error handler continues, otherwise
+// the batch is not drained, and the output is drained again after resumed
+func (grp *Group) skipInvalidOutput(ctx context.Context, stage string, err error) error {
+	if grp.handleError(ctx, stage, err) {
+		return nil
+	}
+	return errDrainHalted
+}
+
+func (grp *Group) writeOutput(out *Output, traceId string) error {
 	// FIXME some invalid memo could also be randomly decoded
 	// thus result in incorrect group id
+	out.GroupId = grp.outputGroupId(out)
+	logger.Verbosef("Group.writeOutput(%v, %s)", out, traceId)
+	err := grp.store.WriteOutput(out, traceId)
+	return newStoreError("Group.WriteOutput", err)
+}
+
+func (grp *Group) outputGroupId(out *Output) string {
 	p := DecodeMixinExtra(out.Memo)
 	if p != nil && p.G != "" {
-		out.GroupId = p.G
+		return p.G
 	} else if grp.grouper != nil {
-		out.GroupId = grp.grouper(out)
-	}
-	logger.Verbosef("Group.writeOutputOrPanic(%v, %s)", out, traceId)
-	err := grp.store.WriteOutput(out, traceId)
-	if err != nil {
-		panic(err)
+		return grp.grouper(out)
 	}
+	return out.GroupId
 }
 
-func (grp *Group) processCollectibleOutput(out *CollectibleOutput) {
+func (grp *Group) processCollectibleOutput(ctx context.Context, out *CollectibleOutput) error {
 	logger.Verbosef("Group.processCollectibleOutput(%v)", out)
 	ver, extra := decodeCollectibleTransactionWithExtra(out.SignedTx)
 	if out.SignedTx != "" && ver == nil {
-		panic(out.SignedTx)
+		return grp.skipInvalidOutput(ctx, "processCollectibleOutput", newInputError("Group.processCollectibleOutput", "invalid signed transaction %s %s", out.OutputId, out.SignedTx))
 	}
 	if out.State == OutputStateUnspent {
-		grp.writeCollectibleOutputOrPanic(out, "", nil)
-		return
+		return grp.writeCollectibleOutput(out, "", nil)
+	}
+	if ver == nil || extra == nil {
+		return grp.skipInvalidOutput(ctx, "processCollectibleOutput", newInputError("Group.processCollectibleOutput", "invalid signed transaction extra %s %s", out.OutputId, out.SignedTx))
 	}
 	tx := &CollectibleTransaction{
 		TraceId: extra.T.String(),
@@ -192,70 +448,64 @@ func (grp *Group) processCollectibleOutput(out *CollectibleOutput) {
 		out.State = OutputStateSpent
 		tx.State = TransactionStateSigned
 	}
-	grp.writeCollectibleOutputOrPanic(out, tx.TraceId, tx)
+	return grp.writeCollectibleOutput(out, tx.TraceId, tx)
 }
 
-func (grp *Group) writeCollectibleOutputOrPanic(out *CollectibleOutput, traceId string, tx *CollectibleTransaction) {
-	logger.Verbosef("Group.writeCollectibleOutputOrPanic(%v, %s, %v)", out, traceId, tx)
-	err := grp.store.WriteCollectibleOutput(out, traceId)
+func (grp *Group) writeCollectibleOutput(out *CollectibleOutput, traceId string, tx *CollectibleTransaction) error {
+	logger.Verbosef("Group.writeCollectibleOutput(%v, %s, %v)", out, traceId, tx)
+	err := grp.markSnapshotCollectibles()
 	if err != nil {
-		panic(err)
+		return err
+	}
+	err = grp.store.WriteCollectibleOutput(out, traceId)
+	if err != nil {
+		return newStoreError("Group.WriteCollectibleOutput", err)
 	}
 	if traceId == "" {
-		return
+		return nil
 	}
 	old, err := grp.store.ReadCollectibleTransaction(traceId)
 	if err != nil {
-		panic(err)
+		return newStoreError("Group.ReadCollectibleTransaction", err)
 	}
 	if old != nil && old.State >= TransactionStateSigned {
-		return
+		return nil
 	}
 	err = grp.store.WriteCollectibleTransaction(traceId, tx)
-	if err != nil {
-		panic(err)
+	return newStoreError("Group.WriteCollectibleTransaction", err)
+}
+
+func (grp *Group) markSnapshotCollectibles() error {
+	val, err := grp.store.ReadProperty([]byte(snapshotCollectiblesKey))
+	if err != nil || len(val) > 0 {
+		return newStoreError("Group.ReadProperty", err)
 	}
+	err = grp.store.WriteProperty([]byte(snapshotCollectiblesKey), []byte{1})
+	return newStoreError("Group.WriteProperty", err)
 }
 
-func (grp *Group) readDrainingCheckpoint(ctx context.Context, order string) (time.Time, error) {
-	key := fmt.Sprintf("%s-by-%s", outputsDrainingKey, order)
+func (grp *Group) readDrainingCheckpoint(ctx context.Context, e *Epoch, order string) (time.Time, error) {
+	key := grp.drainingCheckpointKey(e, order)
 	val, err := grp.store.ReadProperty([]byte(key))
 	if err != nil || len(val) == 0 {
-		return grp.epoch, err
+		return e.CreatedAt, err
 	}
 	ts := int64(binary.BigEndian.Uint64(val))
 	return time.Unix(0, ts), nil
 }
 
-func (grp *Group) writeDrainingCheckpoint(ctx context.Context, order string, ckpt time.Time) error {
+func (grp *Group) writeDrainingCheckpoint(ctx context.Context, e *Epoch, order string, ckpt time.Time) error {
 	val := make([]byte, 8)
 	ts := uint64(ckpt.UnixNano())
 	binary.BigEndian.PutUint64(val, ts)
-	key := fmt.Sprintf("%s-by-%s", outputsDrainingKey, order)
+	key := grp.drainingCheckpointKey(e, order)
 	return grp.store.WriteProperty([]byte(key), val)
 }
 
-func (grp *Group) readUnifiedOutputs(ctx context.Context, members []string, threshold uint8, offset time.Time, limit int, order string) ([]*UnifiedOutput, error) {
-	params := make(map[string]string)
-	if !offset.IsZero() {
-		params["offset"] = offset.UTC().Format(time.RFC3339Nano)
-	}
-	if limit > 0 {
-		params["limit"] = fmt.Sprint(limit)
-	}
-	if order == outputsOrderCreated || order == outputsOrderUpdated {
-		params["order"] = order
-	}
-	if threshold < 1 || int(threshold) > len(members) {
-		return nil, fmt.Errorf("invalid members %v %d", members, threshold)
-	}
-	params["members"] = mixin.HashMembers(members)
-	params["threshold"] = fmt.Sprint(threshold)
-
-	var outputs []*UnifiedOutput
-	err := grp.mixin.Get(ctx, "/outputs", params, &outputs)
-	if err != nil {
-		return nil, err
+// the genesis epoch keeps the old key to be compatible with old nodes
+func (grp *Group) drainingCheckpointKey(e *Epoch, order string) string {
+	if e.CreatedAt.Equal(grp.genesis.CreatedAt) {
+		return fmt.Sprintf("%s-by-%s", outputsDrainingKey, order)
 	}
-	return outputs, nil
+	return fmt.Sprintf("%s-%s-by-%s", outputsDrainingKey, e, order)
 }
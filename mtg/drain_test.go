@@ -0,0 +1,37 @@
+package mtg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryDrainStore(t *testing.T) {
+	require := require.New(t)
+
+	ms := newMemoryDrainStore()
+	for i := 0; i < 5; i++ {
+		err := ms.WriteDrainedOutput(drainedKindOutput, "id", time.Unix(0, int64(i)*1000))
+		require.Nil(err)
+	}
+	found, err := ms.ReadDrainedOutput(drainedKindOutput, "id", time.Unix(0, 2000))
+	require.Nil(err)
+	require.True(found)
+	found, err = ms.ReadDrainedOutput(drainedKindAction, "id", time.Unix(0, 2000))
+	require.Nil(err)
+	require.False(found)
+
+	count, err := ms.PruneDrainedOutputs(time.Unix(0, 3000), 2)
+	require.Nil(err)
+	require.Equal(2, count)
+	count, err = ms.PruneDrainedOutputs(time.Unix(0, 3000), 2)
+	require.Nil(err)
+	require.Equal(1, count)
+	found, err = ms.ReadDrainedOutput(drainedKindOutput, "id", time.Unix(0, 2000))
+	require.Nil(err)
+	require.False(found)
+	found, err = ms.ReadDrainedOutput(drainedKindOutput, "id", time.Unix(0, 3000))
+	require.Nil(err)
+	require.True(found)
+}
@@ -0,0 +1,200 @@
+package mtg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/MixinNetwork/mixin/logger"
+	"github.com/fox-one/mixin-sdk-go"
+)
+
+type ErrorKind int
+
+const (
+	// the network may recover, so the request could be retried
+	ErrorKindNetwork ErrorKind = iota + 1
+	// the store fails to read or write, the state may be inconsistent
+	ErrorKindStore
+	// the group members disagree, or the data breaks the mtg rules
+	ErrorKindConsensus
+	// the request or data is invalid, including rejected api requests
+	ErrorKindInput
+	// the signing policy refuses to sign or unlock a raw transaction
+	ErrorKindPolicy
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindNetwork:
+		return "network"
+	case ErrorKindStore:
+		return "store"
+	case ErrorKindConsensus:
+		return "consensus"
+	case ErrorKindInput:
+		return "input"
+	case ErrorKindPolicy:
+		return "policy"
+	}
+	return fmt.Sprintf("unknown(%d)", int(k))
+}
+
+type Error struct {
+	Kind ErrorKind
+	Op   string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Kind, e.Op, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// the network errors are retryable, all others need operator decision
+func IsRetryableError(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Kind == ErrorKindNetwork
+}
+
+func ErrorKindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return 0
+}
+
+func newStoreError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: ErrorKindStore, Op: op, Err: err}
+}
+
+func newConsensusError(op string, format string, args ...interface{}) error {
+	return &Error{Kind: ErrorKindConsensus, Op: op, Err: fmt.Errorf(format, args...)}
+}
+
+func newInputError(op string, format string, args ...interface{}) error {
+	return &Error{Kind: ErrorKindInput, Op: op, Err: fmt.Errorf(format, args...)}
+}
+
+func newPolicyError(op string, format string, args ...interface{}) error {
+	return &Error{Kind: ErrorKindPolicy, Op: op, Err: fmt.Errorf(format, args...)}
+}
+
+// the mixin api errors are retryable only for server failures and rate
+// limit, any other responses mean the request is rejected
+func newNetworkError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	kind := ErrorKindInput
+	var me *mixin.Error
+	var ne net.Error
+	switch {
+	case errors.Is(err, context.Canceled):
+	case errors.As(err, &me):
+		if me.Status >= 500 || me.Status == 429 || me.Code == 429 || (me.Code >= 500 && me.Code < 600) {
+			kind = ErrorKindNetwork
+		}
+	case errors.As(err, &ne), errors.Is(err, context.DeadlineExceeded):
+		kind = ErrorKindNetwork
+	}
+	return &Error{Kind: kind, Op: op, Err: err}
+}
+
+// the delay grows from the initial delay by the multiplier until the max
+// delay, and zero max attempts means retry until the group stopped
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Multiplier   float64
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		InitialDelay: 3 * time.Second,
+		MaxDelay:     time.Minute,
+		Multiplier:   2,
+	}
+}
+
+func (p *RetryPolicy) Delay(attempt int) time.Duration {
+	d := float64(p.InitialDelay)
+	for i := 0; i < attempt && d < float64(p.MaxDelay); i++ {
+		d = d * p.Multiplier
+	}
+	if p.MaxDelay > 0 && d > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(d)
+}
+
+// the handler decides whether the group continues after the error, and a
+// false return value halts the group after the current stage
+type ErrorHandler func(ctx context.Context, err *Error) bool
+
+// the network and input errors are handled again in the next round, and
+// the policy refusals are only logged, but the store or consensus errors
+// halt the group
+func DefaultErrorHandler(ctx context.Context, err *Error) bool {
+	switch err.Kind {
+	case ErrorKindNetwork, ErrorKindInput, ErrorKindPolicy:
+		return true
+	}
+	return false
+}
+
+func (grp *Group) SetRetryPolicy(p *RetryPolicy) {
+	grp.retryPolicy = p
+}
+
+func (grp *Group) SetErrorHandler(h ErrorHandler) {
+	grp.errorHandler = h
+}
+
+// retry the function by the policy until the error is not retryable
+func (grp *Group) retry(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !IsRetryableError(err) || grp.interrupted(ctx) {
+			return err
+		}
+		p := grp.retryPolicy
+		if p.MaxAttempts > 0 && attempt+1 >= p.MaxAttempts {
+			return err
+		}
+		grp.sleep(ctx, p.Delay(attempt))
+	}
+}
+
+// the errors returned by the stages are passed to the handler, and the
+// unknown errors are treated as consensus violations to be safe
+func (grp *Group) handleError(ctx context.Context, stage string, err error) bool {
+	grp.recordStage(stage, err)
+	if err == nil {
+		return true
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Kind: ErrorKindConsensus, Op: stage, Err: err}
+	}
+	next := grp.errorHandler(ctx, e)
+	logger.Printf("Group.handleError(%s, %v) => %t\n", stage, e, next)
+	if !next {
+		grp.Stop()
+	}
+	return next
+}
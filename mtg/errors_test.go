@@ -0,0 +1,94 @@
+package mtg
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorKinds(t *testing.T) {
+	require := require.New(t)
+
+	require.Nil(newNetworkError("op", nil))
+	require.Nil(newStoreError("op", nil))
+
+	err := newNetworkError("op", &mixin.Error{Status: 502, Code: 502, Description: "Bad Gateway"})
+	require.Equal(ErrorKindNetwork, ErrorKindOf(err))
+	require.True(IsRetryableError(err))
+	err = newNetworkError("op", &mixin.Error{Status: 202, Code: 500, Description: "Internal Server Error"})
+	require.True(IsRetryableError(err))
+	err = newNetworkError("op", &mixin.Error{Status: 202, Code: 429, Description: "Too Many Requests"})
+	require.True(IsRetryableError(err))
+	err = newNetworkError("op", &mixin.Error{Status: 202, Code: mixin.InsufficientBalance})
+	require.Equal(ErrorKindInput, ErrorKindOf(err))
+	require.False(IsRetryableError(err))
+	err = newNetworkError("op", &net.OpError{Op: "dial", Err: fmt.Errorf("connection refused")})
+	require.True(IsRetryableError(err))
+	err = newNetworkError("op", fmt.Errorf("wrapped %w", context.DeadlineExceeded))
+	require.True(IsRetryableError(err))
+	err = newNetworkError("op", context.Canceled)
+	require.False(IsRetryableError(err))
+	require.Equal(err, newNetworkError("again", err))
+
+	err = newStoreError("op", fmt.Errorf("disk full"))
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+	require.Equal("store op: disk full", err.Error())
+	require.Equal(ErrorKind(0), ErrorKindOf(fmt.Errorf("unknown")))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	require := require.New(t)
+
+	p := &RetryPolicy{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+	require.Equal(time.Second, p.Delay(0))
+	require.Equal(2*time.Second, p.Delay(1))
+	require.Equal(4*time.Second, p.Delay(2))
+	require.Equal(5*time.Second, p.Delay(3))
+	require.Equal(5*time.Second, p.Delay(100))
+
+	grp := &Group{stop: make(chan struct{})}
+	grp.SetRetryPolicy(&RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond, Multiplier: 1})
+	var attempts int
+	err := grp.retry(context.Background(), func() error {
+		attempts += 1
+		return newNetworkError("op", &mixin.Error{Status: 500})
+	})
+	require.True(IsRetryableError(err))
+	require.Equal(3, attempts)
+
+	attempts = 0
+	err = grp.retry(context.Background(), func() error {
+		attempts += 1
+		return newNetworkError("op", &mixin.Error{Status: 202, Code: 403})
+	})
+	require.Equal(ErrorKindInput, ErrorKindOf(err))
+	require.Equal(1, attempts)
+}
+
+func TestErrorHandler(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	grp := &Group{stop: make(chan struct{})}
+	grp.SetErrorHandler(DefaultErrorHandler)
+	require.True(grp.handleError(ctx, "stage", nil))
+	require.True(grp.handleError(ctx, "stage", newInputError("op", "invalid")))
+	require.False(grp.interrupted(ctx))
+	require.False(grp.handleError(ctx, "stage", fmt.Errorf("unknown")))
+	require.True(grp.interrupted(ctx))
+
+	var handled *Error
+	grp = &Group{stop: make(chan struct{})}
+	grp.SetErrorHandler(func(ctx context.Context, err *Error) bool {
+		handled = err
+		return true
+	})
+	require.True(grp.handleError(ctx, "stage", newStoreError("op", fmt.Errorf("disk full"))))
+	require.Equal(ErrorKindStore, handled.Kind)
+	require.False(grp.interrupted(ctx))
+}
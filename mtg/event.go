@@ -0,0 +1,92 @@
+package mtg
+
+import (
+	"time"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/MixinNetwork/mixin/logger"
+)
+
+const (
+	EventTransactionQueued   = "transaction.queued"
+	EventTransactionHeld     = "transaction.held"
+	EventTransactionSigning  = "transaction.signing"
+	EventTransactionSigned   = "transaction.signed"
+	EventTransactionSnapshot = "transaction.snapshot"
+	EventTransactionUnlocked = "transaction.unlocked"
+	EventCompactionCreated   = "compaction.created"
+	EventCollectibleMinted   = "collectible.minted"
+)
+
+// the event is emitted after the state written to the store, and the
+// transaction is nil for the collectible events
+type Event struct {
+	Kind        string
+	TraceId     string
+	GroupId     string
+	State       int
+	Hash        crypto.Hash
+	Transaction *Transaction
+	Collectible *CollectibleTransaction
+	CreatedAt   time.Time
+}
+
+// the listeners are called in the Run loop in the order added, so they
+// should return quickly, and the events are not persisted, so the events
+// emitted before a restart may be missed or emitted again
+type EventListener func(e *Event)
+
+func (grp *Group) AddEventListener(l EventListener) {
+	grp.listeners = append(grp.listeners, l)
+}
+
+// the transaction only drained from the network has no details to listen,
+// and the unknown state has no event
+func (grp *Group) emitTransactionEvent(kind string, tx *Transaction) {
+	if kind == "" || tx.AssetId == "" {
+		return
+	}
+	grp.emitEvent(&Event{
+		Kind:        kind,
+		TraceId:     tx.TraceId,
+		GroupId:     tx.GroupId,
+		State:       tx.State,
+		Hash:        tx.Hash,
+		Transaction: tx,
+		CreatedAt:   time.Now(),
+	})
+}
+
+func (grp *Group) emitCollectibleEvent(kind string, tx *CollectibleTransaction) {
+	grp.emitEvent(&Event{
+		Kind:        kind,
+		TraceId:     tx.TraceId,
+		State:       tx.State,
+		Hash:        tx.Hash,
+		Collectible: tx,
+		CreatedAt:   time.Now(),
+	})
+}
+
+func (grp *Group) emitEvent(e *Event) {
+	logger.Verbosef("Group.emitEvent(%s, %s, %d)\n", e.Kind, e.TraceId, e.State)
+	for _, l := range grp.listeners {
+		l(e)
+	}
+}
+
+func transactionStateEvent(state int) string {
+	switch state {
+	case TransactionStateHeld:
+		return EventTransactionHeld
+	case TransactionStateInitial:
+		return EventTransactionUnlocked
+	case TransactionStateSigning:
+		return EventTransactionSigning
+	case TransactionStateSigned:
+		return EventTransactionSigned
+	case TransactionStateSnapshot:
+		return EventTransactionSnapshot
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+package mtg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionStateEvent(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(EventTransactionHeld, transactionStateEvent(TransactionStateHeld))
+	require.Equal(EventTransactionUnlocked, transactionStateEvent(TransactionStateInitial))
+	require.Equal(EventTransactionSigning, transactionStateEvent(TransactionStateSigning))
+	require.Equal(EventTransactionSigned, transactionStateEvent(TransactionStateSigned))
+	require.Equal(EventTransactionSnapshot, transactionStateEvent(TransactionStateSnapshot))
+	require.Equal("", transactionStateEvent(0))
+	require.Equal("", transactionStateEvent(TransactionStateSnapshot+1))
+
+	var kinds []string
+	grp := &Group{}
+	grp.AddEventListener(func(e *Event) { kinds = append(kinds, e.Kind) })
+	tx := &Transaction{TraceId: "trace", State: TransactionStateSigned}
+	grp.emitTransactionEvent(transactionStateEvent(tx.State), tx)
+	require.Len(kinds, 0)
+	tx.AssetId = StorageAssetId
+	grp.emitTransactionEvent(transactionStateEvent(tx.State), tx)
+	grp.emitTransactionEvent(transactionStateEvent(100), tx)
+	require.Equal([]string{EventTransactionSigned}, kinds)
+}
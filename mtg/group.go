@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/MixinNetwork/mixin/common"
@@ -21,29 +22,42 @@ const (
 )
 
 type Group struct {
-	mixin        *mixin.Client
-	store        Store
-	workers      []Worker
-	grouper      func(*Output) string
-	groupSize    int
-	waitDuration time.Duration
+	network       Network
+	store         Store
+	workers       []*routedWorker
+	grouper       func(*Output) string
+	selector      CoinSelector
+	signingPolicy SigningPolicy
+	limits        *OutflowLimits
+	consolidation *ConsolidationPolicy
+	refund        *RefundPolicy
+	timerHandlers map[string]TimerHandler
+	listeners     []EventListener
+	digest        *DigestExchange
+	digestState   *digestState
+	drainState    *drainState
+	drained       DrainStore
+	stageState    stageState
+	groupSize     int
+	waitDuration  time.Duration
 
 	clock     *Clock
 	id        string
-	members   []string
-	epoch     time.Time
-	threshold int
+	member    string
+	genesis   *Epoch
+	epochs    []*Epoch
+	epochLock sync.RWMutex
 	pin       string
+
+	retryPolicy  *RetryPolicy
+	errorHandler ErrorHandler
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
 }
 
 func BuildGroup(ctx context.Context, store Store, conf *Configuration) (*Group, error) {
-	if cg := conf.Genesis; len(cg.Members) < cg.Threshold || cg.Threshold < 1 {
-		return nil, fmt.Errorf("invalid group threshold %d %d", len(cg.Members), cg.Threshold)
-	}
-	if !strings.Contains(strings.Join(conf.Genesis.Members, ","), conf.App.ClientId) {
-		return nil, fmt.Errorf("app %s not belongs to the group", conf.App.ClientId)
-	}
-
 	s := &mixin.Keystore{
 		ClientID:   conf.App.ClientId,
 		SessionID:  conf.App.SessionId,
@@ -54,28 +68,47 @@ func BuildGroup(ctx context.Context, store Store, conf *Configuration) (*Group,
 	if err != nil {
 		return nil, err
 	}
-	err = client.VerifyPin(ctx, conf.App.PIN)
+	return BuildGroupWithNetwork(ctx, store, conf, NewMixinNetwork(client))
+}
+
+// the network must act as the app in the configuration
+func BuildGroupWithNetwork(ctx context.Context, store Store, conf *Configuration, network Network) (*Group, error) {
+	if cg := conf.Genesis; len(cg.Members) < cg.Threshold || cg.Threshold < 1 {
+		return nil, fmt.Errorf("invalid group threshold %d %d", len(cg.Members), cg.Threshold)
+	}
+	if !strings.Contains(strings.Join(conf.Genesis.Members, ","), conf.App.ClientId) {
+		return nil, fmt.Errorf("app %s not belongs to the group", conf.App.ClientId)
+	}
+
+	err := network.VerifyPin(ctx, conf.App.PIN)
 	if err != nil {
 		return nil, err
 	}
 
 	grp := &Group{
-		mixin:        client,
-		store:        store,
-		pin:          conf.App.PIN,
-		id:           generateGenesisId(conf),
-		groupSize:    conf.GroupSize,
-		waitDuration: time.Duration(conf.LoopWaitDuration),
+		network:       network,
+		drainState:    &drainState{},
+		timerHandlers: make(map[string]TimerHandler),
+		retryPolicy:   DefaultRetryPolicy(),
+		errorHandler:  DefaultErrorHandler,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+		store:         store,
+		pin:           conf.App.PIN,
+		id:            generateGenesisId(conf),
+		member:        conf.App.ClientId,
+		groupSize:     conf.GroupSize,
+		waitDuration:  time.Duration(conf.LoopWaitDuration),
 	}
 	if grp.groupSize <= 0 {
 		grp.groupSize = OutputsBatchSize
 	}
-
-	clock, err := NewClock(store)
-	if err != nil {
-		return nil, err
+	grp.selector = &OldestFirstSelector{Minimum: grp.groupSize}
+	grp.drained, _ = store.(DrainStore)
+	if grp.drained == nil {
+		grp.drained = newMemoryDrainStore()
 	}
-	grp.clock = clock
+	grp.signingPolicy = &LocalSigningPolicy{}
 
 	oid, err := store.ReadProperty([]byte(groupGenesisId))
 	if err != nil {
@@ -84,6 +117,18 @@ func BuildGroup(ctx context.Context, store Store, conf *Configuration) (*Group,
 	if len(oid) > 0 && string(oid) != grp.id {
 		return nil, fmt.Errorf("malformed group genesis id %s %s", string(oid), grp.id)
 	}
+	if len(oid) == 0 && conf.Snapshot.Path != "" {
+		err = importSnapshotFile(store, conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	clock, err := NewClock(store)
+	if err != nil {
+		return nil, err
+	}
+	grp.clock = clock
 	err = store.WriteProperty([]byte(groupGenesisId), []byte(grp.id))
 	if err != nil {
 		return nil, err
@@ -94,20 +139,26 @@ func BuildGroup(ctx context.Context, store Store, conf *Configuration) (*Group,
 		return nil, err
 	}
 
+	grp.genesis = &Epoch{
+		Members:   conf.Genesis.Members,
+		Threshold: conf.Genesis.Threshold,
+		CreatedAt: time.Unix(0, conf.Genesis.Timestamp),
+	}
 	for _, id := range conf.Genesis.Members {
-		ts := time.Unix(0, conf.Genesis.Timestamp)
-		err = grp.AddNode(id, conf.Genesis.Threshold, ts)
+		err = store.WriteIteration(&Iteration{
+			Action:    IterationActionAdd,
+			NodeId:    id,
+			Threshold: conf.Genesis.Threshold,
+			CreatedAt: grp.genesis.CreatedAt,
+		})
 		if err != nil {
 			return nil, err
 		}
 	}
-	members, threshold, epoch, err := grp.ListActiveNodes()
+	err = grp.loadEpochs()
 	if err != nil {
 		return nil, err
 	}
-	grp.members = members
-	grp.threshold = threshold
-	grp.epoch = epoch
 	return grp, nil
 }
 
@@ -115,16 +166,21 @@ func (grp *Group) SetOutputGrouper(per func(out *Output) string) {
 	grp.grouper = per
 }
 
+// all members must use the same selector, or the transactions never signed
+func (grp *Group) SetCoinSelector(s CoinSelector) {
+	grp.selector = s
+}
+
 func (grp *Group) GenesisId() string {
 	return grp.id
 }
 
 func (grp *Group) GetMembers() []string {
-	return grp.members
+	return grp.currentEpoch().Members
 }
 
 func (grp *Group) GetThreshold() int {
-	return grp.threshold
+	return grp.currentEpoch().Threshold
 }
 
 func (grp *Group) Synced() (bool, error) {
@@ -132,52 +188,169 @@ func (grp *Group) Synced() (bool, error) {
 	return bytes.Equal(v, []byte{1}), err
 }
 
-func (grp *Group) AddWorker(wkr Worker) {
-	grp.workers = append(grp.workers, wkr)
-}
-
+// the loop returns when the context is done or the group is stopped, and
+// it always finishes the current stage before return
 func (grp *Group) Run(ctx context.Context) {
-	logger.Printf("Group(%s, %d, %s).Run(v0.6.1)\n", mixin.HashMembers(grp.members), grp.threshold, grp.GenesisId())
-	filter := make(map[string]bool)
+	logger.Printf("Group(%s, %s).Run(v0.6.1)\n", grp.currentEpoch(), grp.GenesisId())
+	defer close(grp.done)
+
 	for {
-		time.Sleep(grp.waitDuration)
-		// drain all the utxos in the order of created time
-		logger.Verbosef("Group.Run(drainOutputsFromNetwork) created\n")
-		grp.drainOutputsFromNetwork(ctx, filter, 500, "created")
-		logger.Verbosef("Group.Run(drainOutputsFromNetwork) updated\n")
-		grp.drainOutputsFromNetwork(ctx, filter, 500, "updated")
-		grp.store.WriteProperty([]byte(groupBootSynced), []byte{1})
-
-		// handle the utxos queue by created time
-		logger.Verbosef("Group.Run(handleActionsQueue)\n")
-		grp.handleActionsQueue(ctx)
-
-		// because some utxos are unlocked for these signing transactions
-		logger.Verbosef("Group.Run(unlockExpiredTransactions)\n")
-		grp.unlockExpiredTransactions(ctx)
-
-		// sing any possible transactions from BuildTransaction
-		logger.Verbosef("Group.Run(signTransactions)\n")
-		grp.signTransactions(ctx)
-
-		// publish all signed transactions to the mainnet
-		logger.Verbosef("Group.Run(publishTransactions)\n")
-		grp.publishTransactions(ctx)
-
-		logger.Verbosef("Group.Run(signCollectibleTransaction)\n")
-		grp.signCollectibleTransactions(ctx)
-		logger.Verbosef("Group.Run(publishCollectibleTransactions)\n")
-		grp.publishCollectibleTransactions(ctx)
+		grp.sleep(ctx, grp.waitDuration)
+		if grp.interrupted(ctx) {
+			return
+		}
+		grp.RunOnce(ctx)
+	}
+}
+
+// stop the loop after the current stage, safe to call multiple times
+func (grp *Group) Stop() {
+	grp.stopOnce.Do(func() { close(grp.stop) })
+}
+
+// wait until the Run loop returned, must be called after Run started
+func (grp *Group) Wait() {
+	<-grp.done
+}
+
+// a single round of the group loop, the tests could step the group with it
+func (grp *Group) RunOnce(ctx context.Context) {
+	// drain all the utxos in the order of created time, the old epochs
+	// are also drained because they are still in the maintenance mode
+	for _, e := range grp.ListEpochs() {
+		logger.Verbosef("Group.Run(drainOutputsFromNetwork) %s created\n", e)
+		err := grp.drainOutputsFromNetwork(ctx, e, 500, "created")
+		if !grp.handleError(ctx, "drainOutputsFromNetwork", err) || grp.interrupted(ctx) {
+			return
+		}
+		logger.Verbosef("Group.Run(drainOutputsFromNetwork) %s updated\n", e)
+		err = grp.drainOutputsFromNetwork(ctx, e, 500, "updated")
+		if !grp.handleError(ctx, "drainOutputsFromNetwork", err) || grp.interrupted(ctx) {
+			return
+		}
+	}
+	err := grp.pruneDrainedOutputs(ctx)
+	if !grp.handleError(ctx, "pruneDrainedOutputs", err) || grp.interrupted(ctx) {
+		return
+	}
+	err = grp.store.WriteProperty([]byte(groupBootSynced), []byte{1})
+	if !grp.handleError(ctx, "writeBootSynced", newStoreError("Group.WriteProperty", err)) {
+		return
+	}
+
+	// handle the utxos queue by created time
+	logger.Verbosef("Group.Run(handleActionsQueue)\n")
+	err = grp.handleActionsQueue(ctx)
+	if !grp.handleError(ctx, "handleActionsQueue", err) || grp.interrupted(ctx) {
+		return
+	}
+
+	// compare the state with other members
+	logger.Verbosef("Group.Run(exchangeDigests)\n")
+	err = grp.exchangeDigests(ctx)
+	if !grp.handleError(ctx, "exchangeDigests", err) || grp.interrupted(ctx) {
+		return
+	}
+
+	// transfer the old utxos to the new group and refund late payments
+	logger.Verbosef("Group.Run(maintainRetiredEpochs)\n")
+	err = grp.maintainRetiredEpochs(ctx)
+	if !grp.handleError(ctx, "maintainRetiredEpochs", err) || grp.interrupted(ctx) {
+		return
+	}
+
+	// merge the fragmented utxos when there are no other transactions
+	logger.Verbosef("Group.Run(consolidateOutputs)\n")
+	err = grp.consolidateOutputs(ctx)
+	if !grp.handleError(ctx, "consolidateOutputs", err) || grp.interrupted(ctx) {
+		return
+	}
+
+	// because some utxos are unlocked for these signing transactions
+	logger.Verbosef("Group.Run(unlockExpiredTransactions)\n")
+	err = grp.unlockExpiredTransactions(ctx)
+	if !grp.handleError(ctx, "unlockExpiredTransactions", err) || grp.interrupted(ctx) {
+		return
+	}
+
+	// the halted group still drains and handles actions, but never signs
+	// or publishes any transaction
+	halted, err := grp.Halted()
+	if !grp.handleError(ctx, "readHaltState", err) || halted {
+		return
+	}
+
+	// sing any possible transactions from BuildTransaction
+	logger.Verbosef("Group.Run(signTransactions)\n")
+	err = grp.signTransactions(ctx)
+	if !grp.handleError(ctx, "signTransactions", err) || grp.interrupted(ctx) {
+		return
+	}
+
+	// publish all signed transactions to the mainnet
+	logger.Verbosef("Group.Run(publishTransactions)\n")
+	err = grp.publishTransactions(ctx)
+	if !grp.handleError(ctx, "publishTransactions", err) || grp.interrupted(ctx) {
+		return
+	}
+
+	logger.Verbosef("Group.Run(signCollectibleTransaction)\n")
+	err = grp.signCollectibleTransactions(ctx)
+	if !grp.handleError(ctx, "signCollectibleTransactions", err) || grp.interrupted(ctx) {
+		return
+	}
+	logger.Verbosef("Group.Run(publishCollectibleTransactions)\n")
+	err = grp.publishCollectibleTransactions(ctx)
+	grp.handleError(ctx, "publishCollectibleTransactions", err)
+}
+
+// the stages check this between their atomic steps, so that a stopped
+// group never leaves a half written batch
+func (grp *Group) interrupted(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	case <-grp.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (grp *Group) sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-grp.stop:
+	case <-time.After(d):
 	}
 }
 
+// the store lists the outputs by the created time
 func (grp *Group) ListOutputsForAsset(groupId, assetId, state string, limit int) ([]*Output, error) {
-	outputs, err := grp.store.ListOutputsForAsset(groupId, state, assetId, limit)
+	return grp.store.ListOutputsForAsset(groupId, state, assetId, limit)
+}
+
+// the outputs of all epochs are stored together, so filter them when there
+// are old epochs still in maintenance
+func (grp *Group) listEpochOutputsForAsset(e *Epoch, groupId, assetId, state string, limit int) ([]*Output, error) {
+	if len(grp.ListEpochs()) == 1 {
+		return grp.ListOutputsForAsset(groupId, assetId, state, limit)
+	}
+	outputs, err := grp.ListOutputsForAsset(groupId, assetId, state, 0)
 	if err != nil {
 		return nil, err
 	}
-	sort.Slice(outputs, func(i, j int) bool { return outputs[i].CreatedAt.Before(outputs[j].CreatedAt) })
-	return outputs, nil
+	var filtered []*Output
+	for _, out := range outputs {
+		if !e.Match(out.Members, int(out.Threshold)) {
+			continue
+		}
+		filtered = append(filtered, out)
+		if len(filtered) == limit {
+			break
+		}
+	}
+	return filtered, nil
 }
 
 func (grp *Group) ListOutputsForTransaction(traceId string) ([]*Output, error) {
@@ -185,41 +358,73 @@ func (grp *Group) ListOutputsForTransaction(traceId string) ([]*Output, error) {
 	if err != nil {
 		return nil, err
 	}
-	sort.Slice(outputs, func(i, j int) bool { return outputs[i].CreatedAt.Before(outputs[j].CreatedAt) })
+	sortOutputsByCreated(outputs)
 	return outputs, nil
 }
 
+// the transactions failed to sign are retried in the next round, unless
+// the failure is from the store or consensus, and the held transactions
+// are only signed after approved
 func (grp *Group) signTransactions(ctx context.Context) error {
 	txs, err := grp.store.ListTransactions(TransactionStateInitial, 0)
 	if err != nil {
-		return err
+		return newStoreError("Group.ListTransactions", err)
+	}
+	held, err := grp.store.ListTransactions(TransactionStateHeld, 0)
+	if err != nil {
+		return newStoreError("Group.ListTransactions", err)
 	}
+	txs = append(txs, held...)
 
 	for _, tx := range txs {
-		raw, err := grp.signTransaction(ctx, tx)
-		logger.Verbosef("Group.signTransaction(%v) => %s %v", *tx, hex.EncodeToString(raw), err)
+		if grp.interrupted(ctx) {
+			return nil
+		}
+		allowed, usages, err := grp.checkTransactionLimits(ctx, tx)
 		if err != nil {
+			return err
+		} else if !allowed {
+			continue
+		}
+		raw, outputs, err := grp.signTransaction(ctx, tx)
+		logger.Verbosef("Group.signTransaction(%v) => %s %v", *tx, hex.EncodeToString(raw), err)
+		if k := ErrorKindOf(err); k == ErrorKindStore || k == ErrorKindConsensus {
+			return err
+		} else if k == ErrorKindPolicy && !grp.handleError(ctx, "signTransaction", err) {
+			return nil
+		} else if err != nil {
 			continue
 		}
+		signedAt, err := grp.signingTime(tx.UpdatedAt)
+		if err != nil {
+			return err
+		}
 		ver, _ := common.UnmarshalVersionedTransaction(raw)
 		tx.Raw = raw
 		tx.Hash = ver.PayloadHash()
-		tx.UpdatedAt = grp.clock.Now()
+		tx.UpdatedAt = signedAt
 		tx.State = TransactionStateSigning
 
 		if ver.AggregatedSignature != nil || len(ver.SignaturesMap) > 0 {
 			tx.State = TransactionStateSigned
 		} else {
 			p := DecodeMixinExtra(string(ver.Extra))
-			if p.T.String() != tx.TraceId {
-				panic(hex.EncodeToString(raw))
-			}
-			if p.G != tx.GroupId {
-				panic(hex.EncodeToString(raw))
+			if p == nil || p.T.String() != tx.TraceId || p.G != tx.GroupId {
+				return newConsensusError("Group.signTransaction", "invalid signed transaction %s %s", tx.TraceId, hex.EncodeToString(raw))
 			}
 		}
 
-		grp.writeTansactionOrPanic(tx)
+		tx.updateEntries()
+		err = writeOutputsAndTransaction(grp.store, outputs, tx, usages)
+		logger.Printf("Group.WriteOutputsAndTransaction(%d, %v) => %v", len(outputs), *tx, err)
+		if err != nil {
+			return newStoreError("Group.WriteOutputsAndTransaction", err)
+		}
+		err = grp.writeAuditEntry(AuditKindTransaction, tx.TraceId, tx.State, tx.Hash.String(), false, tx.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		grp.emitTransactionEvent(transactionStateEvent(tx.State), tx)
 	}
 
 	return nil
@@ -228,30 +433,31 @@ func (grp *Group) signTransactions(ctx context.Context) error {
 func (grp *Group) unlockExpiredTransactions(ctx context.Context) error {
 	txs, err := grp.store.ListTransactions(TransactionStateSigning, 0)
 	if err != nil || len(txs) == 0 {
-		return err
+		return newStoreError("Group.ListTransactions", err)
 	}
 	for _, tx := range txs {
 		outputs, err := grp.ListOutputsForTransaction(tx.TraceId)
 		if err != nil {
-			return err
+			return newStoreError("Group.ListOutputsForTransaction", err)
 		}
 		if len(outputs) > 0 && outputs[0].SignedBy == tx.Hash.String() {
 			continue
 		}
-		// FIXME do more check about compaction transaction
-		if tx.Memo == CompactionTransactionMemo {
-			err := grp.store.DeleteTransaction(tx)
-			logger.Verbosef("Group.deleteTransaction(%v) => %v", *tx, err)
-			if err != nil {
-				return err
-			}
-			continue
+		// the compaction transaction is also unlocked, and it expires when
+		// signing again if the outputs changed, so the outputs unlocked by
+		// other members won't result in a different compaction transaction
+		err = grp.writeAuditEntry(AuditKindUnlock, tx.TraceId, tx.State, tx.Hash.String(), false, grp.clock.Now())
+		if err != nil {
+			return err
 		}
 		tx.State = TransactionStateInitial
 		tx.Hash = crypto.Hash{}
 		tx.Raw = nil
-		grp.writeTansactionOrPanic(tx)
-		logger.Verbosef("Group.unlockTransaction(%v)", *tx)
+		err = grp.writeTransaction(tx)
+		logger.Verbosef("Group.unlockTransaction(%v) => %v", *tx, err)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -259,9 +465,12 @@ func (grp *Group) unlockExpiredTransactions(ctx context.Context) error {
 func (grp *Group) publishTransactions(ctx context.Context) error {
 	txs, err := grp.store.ListTransactions(TransactionStateSigned, 0)
 	if err != nil || len(txs) == 0 {
-		return err
+		return newStoreError("Group.ListTransactions", err)
 	}
 	for _, tx := range txs {
+		if grp.interrupted(ctx) {
+			return nil
+		}
 		snapshot, err := grp.snapshotTransaction(ctx, tx.Hash, tx.Raw)
 		if err != nil {
 			return err
@@ -269,7 +478,10 @@ func (grp *Group) publishTransactions(ctx context.Context) error {
 			continue
 		}
 		tx.State = TransactionStateSnapshot
-		grp.writeTansactionOrPanic(tx)
+		err = grp.writeTransaction(tx)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -277,7 +489,7 @@ func (grp *Group) publishTransactions(ctx context.Context) error {
 func (grp *Group) signCollectibleTransactions(ctx context.Context) error {
 	txs, err := grp.store.ListCollectibleTransactions(TransactionStateInitial, 1)
 	if err != nil || len(txs) != 1 {
-		return err
+		return newStoreError("Group.ListCollectibleTransactions", err)
 	}
 	tx := txs[0]
 	raw, err := grp.signCollectibleTransaction(ctx, tx)
@@ -285,26 +497,29 @@ func (grp *Group) signCollectibleTransactions(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	signedAt, err := grp.signingTime(tx.UpdatedAt)
+	if err != nil {
+		return err
+	}
 	ver, _ := common.UnmarshalVersionedTransaction(raw)
 	tx.Raw = raw
 	tx.Hash = ver.PayloadHash()
-	tx.UpdatedAt = grp.clock.Now()
+	tx.UpdatedAt = signedAt
 	tx.State = TransactionStateSigning
 
 	nfm, err := DecodeNFOMemo(ver.Extra)
-	if err != nil {
-		panic(hex.EncodeToString(raw))
-	} else if nfm.WillMint() && nfoTraceId(ver.Extra) != tx.TraceId {
-		panic(hex.EncodeToString(raw))
+	if err != nil || (nfm.WillMint() && nfoTraceId(ver.Extra) != tx.TraceId) {
+		return newConsensusError("Group.signCollectibleTransaction", "invalid signed transaction %s %s", tx.TraceId, hex.EncodeToString(raw))
 	}
 
-	return grp.store.WriteCollectibleTransaction(tx.TraceId, tx)
+	err = grp.store.WriteCollectibleTransaction(tx.TraceId, tx)
+	return newStoreError("Group.WriteCollectibleTransaction", err)
 }
 
 func (grp *Group) publishCollectibleTransactions(ctx context.Context) error {
 	txs, err := grp.store.ListCollectibleTransactions(TransactionStateSigned, 0)
 	if err != nil || len(txs) == 0 {
-		return err
+		return newStoreError("Group.ListCollectibleTransactions", err)
 	}
 	for _, tx := range txs {
 		snapshot, err := grp.snapshotTransaction(ctx, tx.Hash, tx.Raw)
@@ -316,7 +531,10 @@ func (grp *Group) publishCollectibleTransactions(ctx context.Context) error {
 		tx.State = TransactionStateSnapshot
 		err = grp.store.WriteCollectibleTransaction(tx.TraceId, tx)
 		if err != nil {
-			return err
+			return newStoreError("Group.WriteCollectibleTransaction", err)
+		}
+		if nfm, _ := DecodeNFOMemo(tx.NFO); nfm != nil && nfm.WillMint() {
+			grp.emitCollectibleEvent(EventCollectibleMinted, tx)
 		}
 	}
 	return nil
@@ -328,14 +546,14 @@ func (grp *Group) snapshotTransaction(ctx context.Context, tx crypto.Hash, b []b
 		return true, nil
 	}
 	raw := hex.EncodeToString(b)
-	h, err := grp.mixin.SendRawTransaction(ctx, raw)
+	h, err := grp.network.SendRawTransaction(ctx, raw)
 	logger.Verbosef("Group.snapshotTransaction(%s) => %s, %v", raw, h, err)
 	if err != nil {
-		return false, err
+		return false, newNetworkError("Group.SendRawTransaction", err)
 	}
-	s, err := grp.mixin.GetRawTransaction(ctx, *h)
+	s, err := grp.network.GetRawTransaction(ctx, *h)
 	if err != nil {
-		return false, err
+		return false, newNetworkError("Group.GetRawTransaction", err)
 	}
 	return s.Snapshot != nil && s.Snapshot.HasValue(), nil
 }
@@ -0,0 +1,90 @@
+package mtg
+
+import (
+	"context"
+
+	"github.com/MixinNetwork/mixin/logger"
+)
+
+const (
+	HaltMemo   = "MTG:HALT"
+	ResumeMemo = "MTG:RESUME"
+
+	haltStateKey       = "MTG:HALT:STATE"
+	haltVotesKeyPrefix = "MTG:HALT:VOTES:"
+)
+
+// the group is halted in emergency, e.g. a vulnerability found, it still
+// drains the outputs and handles the actions, but never signs or publishes
+// any transaction until resumed
+func (grp *Group) Halted() (bool, error) {
+	val, err := grp.store.ReadProperty([]byte(haltStateKey))
+	if err != nil {
+		return false, newStoreError("Group.ReadProperty", err)
+	}
+	return len(val) > 0 && val[0] == 1, nil
+}
+
+// a member votes by sending any amount to the group with the halt or resume
+// memo, and the operation takes effect after a threshold of the members of
+// the current epoch voted. the votes are actions, so all nodes switch the
+// state at the same point of the queue.
+func (grp *Group) handleHaltOutput(ctx context.Context, out *Output) (bool, error) {
+	if out.Memo != HaltMemo && out.Memo != ResumeMemo {
+		return false, nil
+	}
+	e := grp.currentEpoch()
+	if out.Sender == "" || !e.HasMember(out.Sender) {
+		return false, nil
+	}
+	halted, err := grp.Halted()
+	if err != nil {
+		return false, err
+	}
+	if halted == (out.Memo == HaltMemo) {
+		return true, nil
+	}
+
+	key := []byte(haltVotesKeyPrefix + out.Memo)
+	val, err := grp.store.ReadProperty(key)
+	if err != nil {
+		return false, newStoreError("Group.ReadProperty", err)
+	}
+	var members []string
+	if len(val) > 0 {
+		err = MsgpackUnmarshal(val, &members)
+		if err != nil {
+			return false, newStoreError("Group.ReadProperty", err)
+		}
+	}
+	for _, m := range members {
+		if m == out.Sender {
+			return true, nil
+		}
+	}
+	members = append(members, out.Sender)
+	logger.Printf("Group.handleHaltOutput(%s, %s) => %d\n", out.Memo, out.Sender, len(members))
+	if len(members) < e.Threshold {
+		err = grp.store.WriteProperty(key, MsgpackMarshalPanic(members))
+		return true, newStoreError("Group.WriteProperty", err)
+	}
+
+	// the votes of both operations are cleared, so they are counted again
+	// after the state switched
+	for _, op := range []string{HaltMemo, ResumeMemo} {
+		err = grp.store.WriteProperty([]byte(haltVotesKeyPrefix+op), []byte{})
+		if err != nil {
+			return false, newStoreError("Group.WriteProperty", err)
+		}
+	}
+	state := []byte{0}
+	if out.Memo == HaltMemo {
+		state = []byte{1}
+	}
+	err = grp.store.WriteProperty([]byte(haltStateKey), state)
+	if err != nil {
+		return false, newStoreError("Group.WriteProperty", err)
+	}
+	grp.handleError(ctx, "handleActionsQueue", newPolicyError("Group.handleHaltOutput", "group %s by %v", out.Memo, members))
+	return true, nil
+}
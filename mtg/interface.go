@@ -2,6 +2,9 @@ package mtg
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"time"
 
 	"github.com/MixinNetwork/mixin/crypto"
 )
@@ -19,6 +22,8 @@ type Store interface {
 	ListOutputsForTransaction(traceId string) ([]*Output, error)
 	ListOutputsForAsset(groupId string, state, assetId string, limit int) ([]*Output, error)
 
+	// the action is never written back to a lower state, and the initial
+	// action written again with a later time is moved back in the queue
 	WriteAction(act *Action) error
 	ListActions(limit int) ([]*UnifiedOutput, error)
 
@@ -39,8 +44,152 @@ type Store interface {
 	ListCollectibleTransactions(state int, limit int) ([]*CollectibleTransaction, error)
 }
 
+// the optional capabilities of the store are checked with type assertions,
+// and the features depending on them are refused if not implemented, so a
+// store only implementing Store still runs the group
+
+// the evolution and consolidation list the outputs of an epoch
+type EpochOutputStore interface {
+	ListOutputsForMembers(membersHash string, threshold int, state string, limit int) ([]*Output, error)
+}
+
+// the consolidation counts the outputs of an epoch by group id and asset,
+// and only lists the oldest outputs of the group id and asset to merge, so
+// the idle rounds never read all outputs of the epoch
+type EpochAssetStore interface {
+	CountOutputsForMembers(membersHash string, threshold int, state string) ([]*AssetOutputs, error)
+	ListOutputsForMembersAsset(membersHash string, threshold int, state, groupId, assetId string, limit int) ([]*Output, error)
+}
+
+type AssetOutputs struct {
+	GroupId string
+	AssetId string
+	Count   int
+}
+
+// the snapshot and replay list the outputs of all groups
+type OutputStateStore interface {
+	ListOutputsForState(state string, limit int) ([]*Output, error)
+}
+
+// the audit log is not written without it, and the audit export, digest
+// exchange and snapshots are refused. the consensus entry of each round is
+// indexed, so the digest of a round is read without scanning the log
+type AuditStore interface {
+	AppendAuditEntry(entry *AuditEntry) error
+	ReadLastAuditEntry() (*AuditEntry, error)
+	ReadAuditEntryByRound(round uint64) (*AuditEntry, error)
+	ListAuditEntries(from uint64, limit int) ([]*AuditEntry, error)
+}
+
+// the outputs drained are skipped when drained again, and the index is
+// kept in memory without it, so all outputs after the checkpoints are
+// processed again after restarted
+type DrainStore interface {
+	ReadDrainedOutput(kind, id string, updatedAt time.Time) (bool, error)
+	WriteDrainedOutput(kind, id string, updatedAt time.Time) error
+	PruneDrainedOutputs(before time.Time, limit int) (int, error)
+}
+
+// the status counts the actions and transactions by the state indexes with
+// it, without reading them, and the counts are omitted without it
+type CountStore interface {
+	CountActions(state int) (int, error)
+	CountTransactions(state int) (int, error)
+	CountCollectibleTransactions(state int) (int, error)
+}
+
+// the group queries and the reconciliation page the outputs and transactions
+// with it, the cursor is the last item listed, and the cursor not listed by
+// the store is refused with ErrInvalidCursor wrapped
+type QueryStore interface {
+	ListOutputsForAssetAfter(groupId string, state, assetId string, cursor string, limit int) ([]*Output, string, error)
+	ListOutputsForStateAfter(state string, cursor string, limit int) ([]*Output, string, error)
+	ListTransactionsAfter(groupId string, state int, cursor string, limit int) ([]*Transaction, string, error)
+	ListTransactionsForAssetAfter(groupId, assetId string, state int, cursor string, limit int) ([]*Transaction, string, error)
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// the snapshot export lists the group properties with it
+type PropertyStore interface {
+	ListProperties(prefix []byte) (map[string][]byte, error)
+}
+
+// the signed outputs, the transaction state and the properties changed by
+// the transaction, e.g. the outflow usages, are written atomically, so that
+// a crash could never leave signed outputs for an initial transaction
+type AtomicStore interface {
+	WriteOutputsAndTransaction(utxos []*Output, tx *Transaction, properties map[string][]byte) error
+}
+
+// the snapshot exports the actions of all states with it, so the actions
+// handled are never handled again by the node imported, and the snapshots
+// are refused without it
+type ActionStore interface {
+	ListActionsForState(state int, limit int) ([]*Action, error)
+}
+
+// the timers are written one record per timer id with it, otherwise all
+// pending timers are kept in one property rewritten on every change
+type TimerStore interface {
+	WriteTimer(t *Timer) error
+	ReadTimer(id string) (*Timer, error)
+	DeleteTimer(id string) error
+	ListTimers(limit int) ([]*Timer, error)
+}
+
+func listOutputsForMembers(store Store, e *Epoch, state string, limit int) ([]*Output, error) {
+	s, ok := store.(EpochOutputStore)
+	if !ok {
+		return nil, errStoreCapability(store, "EpochOutputStore")
+	}
+	return s.ListOutputsForMembers(e.MembersHash(), e.Threshold, state, limit)
+}
+
+func listOutputsForState(store Store, state string, limit int) ([]*Output, error) {
+	s, ok := store.(OutputStateStore)
+	if !ok {
+		return nil, errStoreCapability(store, "OutputStateStore")
+	}
+	return s.ListOutputsForState(state, limit)
+}
+
+// the properties and outputs are written before the transaction without
+// AtomicStore, and the signing is retried after a crash, because the
+// transaction is initial, and the properties are idempotent
+func writeOutputsAndTransaction(store Store, utxos []*Output, tx *Transaction, properties map[string][]byte) error {
+	if s, ok := store.(AtomicStore); ok {
+		return s.WriteOutputsAndTransaction(utxos, tx, properties)
+	}
+	for k, v := range properties {
+		err := store.WriteProperty([]byte(k), v)
+		if err != nil {
+			return err
+		}
+	}
+	if len(utxos) > 0 {
+		err := store.WriteOutputs(utxos, tx.TraceId)
+		if err != nil {
+			return err
+		}
+	}
+	return store.WriteTransaction(tx)
+}
+
+func errStoreCapability(store Store, capability string) error {
+	return fmt.Errorf("%T not implements %s", store, capability)
+}
+
 type Worker interface {
 	// handle the output and a true return value interrupts workers loop
 	ProcessOutput(context.Context, *Output) bool
 	ProcessCollectibleOutput(context.Context, *CollectibleOutput) bool
 }
+
+// the worker with typed results, the workers retried must be idempotent,
+// because all routed workers are called again for the output retried
+type TypedWorker interface {
+	HandleOutput(context.Context, *Output) *WorkerResult
+	HandleCollectibleOutput(context.Context, *CollectibleOutput) *WorkerResult
+}
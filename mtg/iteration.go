@@ -1,6 +1,13 @@
 package mtg
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/MixinNetwork/mixin/logger"
+	"github.com/fox-one/mixin-sdk-go"
+)
 
 const (
 	IterationActionAdd    = 11
@@ -9,7 +16,6 @@ const (
 
 // a node joins or leaves the group with an iteration
 // this is for the evolution mechanism of MTG
-// TODO not implemented yet
 type Iteration struct {
 	Action    int
 	NodeId    string
@@ -17,6 +23,34 @@ type Iteration struct {
 	CreatedAt time.Time
 }
 
+// an epoch is the group members and threshold after all iterations
+// at the same timestamp applied, the latest epoch is the working group
+// and all the old epochs enter the maintenance mode
+type Epoch struct {
+	Members   []string
+	Threshold int
+	CreatedAt time.Time
+}
+
+func (e *Epoch) MembersHash() string {
+	return hashMembers(e.Members)
+}
+
+func (e *Epoch) Match(members []string, threshold int) bool {
+	return e.Threshold == threshold && e.MembersHash() == hashMembers(members)
+}
+
+func (e *Epoch) HasMember(id string) bool {
+	return containsMember(e.Members, id)
+}
+
+func (e *Epoch) String() string {
+	return fmt.Sprintf("%s:%d:%d", e.MembersHash(), e.Threshold, e.CreatedAt.UnixNano())
+}
+
+// the iteration timestamp must be decided by the group consensus, e.g.
+// the created time of the output triggers the iteration, otherwise the
+// group members will switch to the new epoch at different points
 func (grp *Group) AddNode(id string, threshold int, timestamp time.Time) error {
 	ir := &Iteration{
 		Action:    IterationActionAdd,
@@ -24,7 +58,7 @@ func (grp *Group) AddNode(id string, threshold int, timestamp time.Time) error {
 		Threshold: threshold,
 		CreatedAt: timestamp,
 	}
-	return grp.store.WriteIteration(ir)
+	return grp.writeIteration(ir)
 }
 
 func (grp *Group) RemoveNode(id string, threshold int, timestamp time.Time) error {
@@ -34,20 +68,181 @@ func (grp *Group) RemoveNode(id string, threshold int, timestamp time.Time) erro
 		Threshold: threshold,
 		CreatedAt: timestamp,
 	}
-	return grp.store.WriteIteration(ir)
+	return grp.writeIteration(ir)
 }
 
 func (grp *Group) ListActiveNodes() ([]string, int, time.Time, error) {
+	epochs, err := grp.readEpochsFromStore()
+	if err != nil || len(epochs) == 0 {
+		return nil, 0, time.Time{}, err
+	}
+	e := epochs[len(epochs)-1]
+	return e.Members, e.Threshold, e.CreatedAt, nil
+}
+
+// all epochs ordered by created time, the last one is the working group,
+// the epochs are copied so the caller can't change the group
+func (grp *Group) ListEpochs() []*Epoch {
+	grp.epochLock.RLock()
+	defer grp.epochLock.RUnlock()
+
+	epochs := make([]*Epoch, len(grp.epochs))
+	for i, e := range grp.epochs {
+		epochs[i] = &Epoch{
+			Members:   append([]string{}, e.Members...),
+			Threshold: e.Threshold,
+			CreatedAt: e.CreatedAt,
+		}
+	}
+	return epochs
+}
+
+// the iterations are written by any store, but the retired epochs are only
+// maintained with the EpochOutputStore capability
+func (grp *Group) writeIteration(ir *Iteration) error {
+	if ir.Action != IterationActionAdd && ir.Action != IterationActionRemove {
+		return fmt.Errorf("invalid iteration action %d", ir.Action)
+	}
+	irs, err := grp.store.ListIterations()
+	if err != nil {
+		return err
+	}
+	if l := len(irs); l > 0 && irs[l-1].CreatedAt.After(ir.CreatedAt) {
+		return fmt.Errorf("invalid iteration timestamp %s %s", ir.CreatedAt, irs[l-1].CreatedAt)
+	}
+	_, err = buildEpochs(grp.genesis, append(irs, ir))
+	if err != nil {
+		return err
+	}
+
+	err = grp.store.WriteIteration(ir)
+	if err != nil {
+		return err
+	}
+	return grp.loadEpochs()
+}
+
+func (grp *Group) loadEpochs() error {
+	epochs, err := grp.readEpochsFromStore()
+	if err != nil {
+		return err
+	}
+
+	grp.epochLock.Lock()
+	defer grp.epochLock.Unlock()
+
+	if l := len(grp.epochs); l > 0 && l != len(epochs) {
+		e := epochs[len(epochs)-1]
+		logger.Printf("Group.evolve(%s) => %s\n", grp.epochs[l-1], e)
+	}
+	grp.epochs = epochs
+	return nil
+}
+
+func (grp *Group) readEpochsFromStore() ([]*Epoch, error) {
 	irs, err := grp.store.ListIterations()
-	var actives []string
+	if err != nil {
+		return nil, err
+	}
+	return buildEpochs(grp.genesis, irs)
+}
+
+func (grp *Group) currentEpoch() *Epoch {
+	grp.epochLock.RLock()
+	defer grp.epochLock.RUnlock()
+
+	return grp.epochs[len(grp.epochs)-1]
+}
+
+// the epoch active at the timestamp, any timestamp before the genesis
+// belongs to the genesis epoch
+func (grp *Group) readEpoch(ts time.Time) *Epoch {
+	grp.epochLock.RLock()
+	defer grp.epochLock.RUnlock()
+
+	e := grp.epochs[0]
+	for _, ne := range grp.epochs[1:] {
+		if ne.CreatedAt.After(ts) {
+			break
+		}
+		e = ne
+	}
+	return e
+}
+
+// the time when the epoch enters maintenance mode, zero if still working
+func (grp *Group) epochRetiredAt(e *Epoch) time.Time {
+	grp.epochLock.RLock()
+	defer grp.epochLock.RUnlock()
+
+	for i, ne := range grp.epochs {
+		if ne.CreatedAt.Equal(e.CreatedAt) && i+1 < len(grp.epochs) {
+			return grp.epochs[i+1].CreatedAt
+		}
+	}
+	return time.Time{}
+}
+
+// the genesis epoch is always decided by the configuration, then all
+// iterations after the genesis are applied in order, and the iterations
+// with the same timestamp result in a single epoch
+func buildEpochs(genesis *Epoch, irs []*Iteration) ([]*Epoch, error) {
+	sort.SliceStable(irs, func(i, j int) bool { return irs[i].CreatedAt.Before(irs[j].CreatedAt) })
+
+	epochs := []*Epoch{genesis}
 	for _, ir := range irs {
-		if ir.Action == IterationActionAdd {
-			actives = append(actives, ir.NodeId)
+		if !ir.CreatedAt.After(genesis.CreatedAt) {
+			continue
+		}
+		e := epochs[len(epochs)-1]
+		if !e.CreatedAt.Equal(ir.CreatedAt) {
+			e = &Epoch{
+				Members:   append([]string{}, e.Members...),
+				CreatedAt: ir.CreatedAt,
+			}
+			epochs = append(epochs, e)
 		}
+		switch ir.Action {
+		case IterationActionAdd:
+			if !containsMember(e.Members, ir.NodeId) {
+				e.Members = append(e.Members, ir.NodeId)
+			}
+		case IterationActionRemove:
+			e.Members = removeMember(e.Members, ir.NodeId)
+		default:
+			return nil, fmt.Errorf("invalid iteration action %d", ir.Action)
+		}
+		e.Threshold = ir.Threshold
 	}
-	if err != nil || len(actives) == 0 {
-		return nil, 0, time.Time{}, err
+
+	for _, e := range epochs {
+		if e.Threshold < 1 || e.Threshold > len(e.Members) {
+			return nil, fmt.Errorf("invalid epoch threshold %d/%d at %s", e.Threshold, len(e.Members), e.CreatedAt)
+		}
 	}
-	last := irs[len(irs)-1]
-	return actives, last.Threshold, last.CreatedAt, nil
+	return epochs, nil
+}
+
+func containsMember(members []string, id string) bool {
+	for _, m := range members {
+		if m == id {
+			return true
+		}
+	}
+	return false
+}
+
+func removeMember(members []string, id string) []string {
+	var filtered []string
+	for _, m := range members {
+		if m != id {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
+
+// mixin.HashMembers sorts the slice in place
+func hashMembers(members []string) string {
+	return mixin.HashMembers(append([]string{}, members...))
 }
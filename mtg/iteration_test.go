@@ -0,0 +1,102 @@
+package mtg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEpochs(t *testing.T) {
+	require := require.New(t)
+
+	genesis := &Epoch{Members: []string{"a", "b", "c"}, Threshold: 2, CreatedAt: time.Unix(100, 0)}
+	irs := []*Iteration{
+		{Action: IterationActionRemove, NodeId: "c", Threshold: 2, CreatedAt: time.Unix(300, 0)},
+		{Action: IterationActionAdd, NodeId: "d", Threshold: 3, CreatedAt: time.Unix(200, 0)},
+		{Action: IterationActionAdd, NodeId: "e", Threshold: 3, CreatedAt: time.Unix(300, 0)},
+		{Action: IterationActionAdd, NodeId: "x", Threshold: 1, CreatedAt: time.Unix(50, 0)},
+	}
+	epochs, err := buildEpochs(genesis, irs)
+	require.Nil(err)
+	require.Len(epochs, 3)
+	require.Equal(genesis, epochs[0])
+	require.Equal([]string{"a", "b", "c", "d"}, epochs[1].Members)
+	require.Equal(3, epochs[1].Threshold)
+	require.Equal([]string{"a", "b", "d", "e"}, epochs[2].Members)
+	require.Equal(3, epochs[2].Threshold)
+	require.Equal(time.Unix(300, 0), epochs[2].CreatedAt)
+	require.Equal([]string{"a", "b", "c"}, genesis.Members)
+
+	_, err = buildEpochs(genesis, []*Iteration{{Action: IterationActionRemove, NodeId: "a", Threshold: 3, CreatedAt: time.Unix(200, 0)}})
+	require.NotNil(err)
+	_, err = buildEpochs(genesis, []*Iteration{{Action: 1, NodeId: "d", Threshold: 2, CreatedAt: time.Unix(200, 0)}})
+	require.NotNil(err)
+}
+
+func TestReadEpoch(t *testing.T) {
+	require := require.New(t)
+
+	genesis := &Epoch{Members: []string{"a", "b", "c"}, Threshold: 2, CreatedAt: time.Unix(100, 0)}
+	epochs, err := buildEpochs(genesis, []*Iteration{
+		{Action: IterationActionAdd, NodeId: "d", Threshold: 3, CreatedAt: time.Unix(200, 0)},
+		{Action: IterationActionRemove, NodeId: "a", Threshold: 2, CreatedAt: time.Unix(300, 0)},
+	})
+	require.Nil(err)
+	grp := &Group{genesis: genesis, epochs: epochs}
+
+	require.Equal(epochs[0], grp.readEpoch(time.Unix(0, 0)))
+	require.Equal(epochs[0], grp.readEpoch(time.Unix(199, 0)))
+	require.Equal(epochs[1], grp.readEpoch(time.Unix(200, 0)))
+	require.Equal(epochs[2], grp.readEpoch(time.Unix(400, 0)))
+	require.Equal(epochs[2], grp.currentEpoch())
+
+	require.Equal(time.Unix(200, 0), grp.epochRetiredAt(epochs[0]))
+	require.Equal(time.Unix(300, 0), grp.epochRetiredAt(epochs[1]))
+	require.True(grp.epochRetiredAt(epochs[2]).IsZero())
+
+	// the change of the retired epochs goes to the working group
+	require.Equal(epochs[2], grp.readChangeEpoch(epochs[0]))
+	require.Equal(epochs[2], grp.readChangeEpoch(epochs[2]))
+
+	listed := grp.ListEpochs()
+	require.Equal(epochs, listed)
+	listed[0].Members[0] = "x"
+	listed[1] = nil
+	require.Equal("a", grp.epochs[0].Members[0])
+	require.NotNil(grp.epochs[1])
+}
+
+type testIterationStore struct {
+	*testPropertyStore
+	irs []*Iteration
+}
+
+func (s *testIterationStore) WriteIteration(ir *Iteration) error {
+	s.irs = append(s.irs, ir)
+	return nil
+}
+
+func (s *testIterationStore) ListIterations() ([]*Iteration, error) {
+	return s.irs, nil
+}
+
+func TestWriteIterationWithoutEpochOutputs(t *testing.T) {
+	require := require.New(t)
+
+	genesis := &Epoch{Members: []string{"a", "b", "c"}, Threshold: 2, CreatedAt: time.Unix(100, 0)}
+	grp := &Group{store: &testIterationStore{testPropertyStore: newTestPropertyStore()}, genesis: genesis}
+	err := grp.loadEpochs()
+	require.Nil(err)
+	err = grp.AddNode("d", 3, time.Unix(200, 0))
+	require.Nil(err)
+	err = grp.RemoveNode("a", 2, time.Unix(300, 0))
+	require.Nil(err)
+	require.Len(grp.ListEpochs(), 3)
+	require.Equal([]string{"b", "c", "d"}, grp.currentEpoch().Members)
+
+	// the retired epochs are not maintained without the capability
+	err = grp.maintainRetiredEpochs(context.Background())
+	require.Nil(err)
+}
@@ -0,0 +1,220 @@
+package mtg
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/mixin/logger"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ApprovalMemoPrefix = "MTG:APPROVE:"
+
+	outflowUsageKeyPrefix  = "MTG:OUTFLOW:USAGE:"
+	outflowTraceKeyPrefix  = "MTG:OUTFLOW:TRACE:"
+	approvalStoreKeyPrefix = "MTG:APPROVAL:"
+)
+
+// the limits of the value sent out of the group, all indexed by asset id,
+// and the hourly and daily limits are counted in fixed time windows. the
+// compaction and evolution migration transactions are not limited.
+type OutflowLimits struct {
+	PerTransaction map[string]decimal.Decimal
+	PerAssetHour   map[string]decimal.Decimal
+	PerReceiverDay map[string]decimal.Decimal
+}
+
+// the transaction over the limits is held until a threshold of members
+// approve it, and a nil limits disables the check
+func (grp *Group) SetOutflowLimits(l *OutflowLimits) {
+	grp.limits = l
+}
+
+func (grp *Group) ListHeldTransactions() ([]*Transaction, error) {
+	return grp.store.ListTransactions(TransactionStateHeld, 0)
+}
+
+// a member approves the held transaction by sending any amount to the
+// group with this memo
+func EncodeApprovalMemo(traceId string) string {
+	return ApprovalMemoPrefix + traceId
+}
+
+func (grp *Group) ReadApprovals(traceId string) ([]string, error) {
+	val, err := grp.store.ReadProperty([]byte(approvalStoreKeyPrefix + traceId))
+	if err != nil || len(val) == 0 {
+		return nil, err
+	}
+	var members []string
+	err = MsgpackUnmarshal(val, &members)
+	return members, err
+}
+
+// the approval is an action, so all nodes count the approvals in the same
+// order, only the members of the current epoch could approve
+func (grp *Group) handleApprovalOutput(out *Output) (bool, error) {
+	if !strings.HasPrefix(out.Memo, ApprovalMemoPrefix) {
+		return false, nil
+	}
+	e := grp.currentEpoch()
+	if out.Sender == "" || !e.HasMember(out.Sender) {
+		return false, nil
+	}
+	traceId := strings.TrimPrefix(out.Memo, ApprovalMemoPrefix)
+	members, err := grp.ReadApprovals(traceId)
+	if err != nil {
+		return false, newStoreError("Group.ReadApprovals", err)
+	}
+	for _, m := range members {
+		if m == out.Sender {
+			return true, nil
+		}
+	}
+	members = append(members, out.Sender)
+	err = grp.store.WriteProperty([]byte(approvalStoreKeyPrefix+traceId), MsgpackMarshalPanic(members))
+	logger.Printf("Group.handleApprovalOutput(%s, %s) => %d %v\n", traceId, out.Sender, len(members), err)
+	return true, newStoreError("Group.WriteProperty", err)
+}
+
+func (grp *Group) checkApproved(tx *Transaction) (bool, error) {
+	members, err := grp.ReadApprovals(tx.TraceId)
+	if err != nil {
+		return false, newStoreError("Group.ReadApprovals", err)
+	}
+	return len(members) >= grp.currentEpoch().Threshold, nil
+}
+
+// the usage is only counted once for each transaction, even if it is
+// unlocked and signed again, and the approved transaction is also counted.
+// the usages are returned as properties, to be written with the signed
+// transaction in the same store transaction.
+func (grp *Group) checkOutflowLimits(tx *Transaction) (bool, map[string][]byte, error) {
+	if grp.limits == nil || tx.Memo == CompactionTransactionMemo || tx.Memo == EvolutionTransactionMemo {
+		return true, nil, nil
+	}
+	counted, err := grp.store.ReadProperty([]byte(outflowTraceKeyPrefix + tx.TraceId))
+	if err != nil {
+		return false, nil, newStoreError("Group.ReadProperty", err)
+	} else if len(counted) > 0 {
+		return true, nil, nil
+	}
+	approved, err := grp.checkApproved(tx)
+	if err != nil {
+		return false, nil, err
+	}
+	usages, exceeded, err := grp.readOutflowUsages(tx)
+	if err != nil || (exceeded && !approved) {
+		return false, nil, err
+	}
+	return true, outflowUsageProperties(tx, usages), nil
+}
+
+// the transaction signed by other members without this node is counted
+// when drained, so all nodes have the same usages
+func (grp *Group) countOutflowUsage(tx *Transaction) (map[string][]byte, error) {
+	if grp.limits == nil || tx.Memo == CompactionTransactionMemo || tx.Memo == EvolutionTransactionMemo {
+		return nil, nil
+	}
+	counted, err := grp.store.ReadProperty([]byte(outflowTraceKeyPrefix + tx.TraceId))
+	if err != nil || len(counted) > 0 {
+		return nil, newStoreError("Group.ReadProperty", err)
+	}
+	usages, _, err := grp.readOutflowUsages(tx)
+	if err != nil {
+		return nil, err
+	}
+	return outflowUsageProperties(tx, usages), nil
+}
+
+// the windows are decided by the consensus time when the transaction built,
+// so all members count the transaction in the same windows
+func (grp *Group) readOutflowUsages(tx *Transaction) (map[string]decimal.Decimal, bool, error) {
+	l := grp.limits
+	hour, day := outflowWindows(tx)
+	amount := decimal.RequireFromString(tx.Amount)
+	usages := make(map[string]decimal.Decimal)
+	exceeded := false
+	if max, ok := l.PerTransaction[tx.AssetId]; ok && amount.Cmp(max) > 0 {
+		exceeded = true
+	}
+	key := fmt.Sprintf("%s:%d", tx.AssetId, hour)
+	err := grp.addOutflowUsage(usages, key, amount)
+	if err != nil {
+		return nil, false, err
+	}
+	if max, ok := l.PerAssetHour[tx.AssetId]; ok && usages[key].Cmp(max) > 0 {
+		exceeded = true
+	}
+	for _, en := range tx.outputEntries() {
+		key := fmt.Sprintf("%s:%s:%d", tx.AssetId, hashMembers(en.Receivers), day)
+		err = grp.addOutflowUsage(usages, key, decimal.RequireFromString(en.Amount))
+		if err != nil {
+			return nil, false, err
+		}
+		if max, ok := l.PerReceiverDay[tx.AssetId]; ok && usages[key].Cmp(max) > 0 {
+			exceeded = true
+		}
+	}
+	return usages, exceeded, nil
+}
+
+// the hour and day windows start, the transactions built before the created
+// time recorded use the updated time
+func outflowWindows(tx *Transaction) (int64, int64) {
+	ts := tx.CreatedAt
+	if ts.IsZero() {
+		ts = tx.UpdatedAt
+	}
+	return ts.Truncate(time.Hour).Unix(), ts.Truncate(24 * time.Hour).Unix()
+}
+
+func outflowUsageProperties(tx *Transaction, usages map[string]decimal.Decimal) map[string][]byte {
+	props := make(map[string][]byte)
+	for k, v := range usages {
+		props[outflowUsageKeyPrefix+k] = []byte(v.String())
+	}
+	props[outflowTraceKeyPrefix+tx.TraceId] = []byte{1}
+	return props
+}
+
+func (grp *Group) addOutflowUsage(usages map[string]decimal.Decimal, key string, amount decimal.Decimal) error {
+	if _, ok := usages[key]; !ok {
+		val, err := grp.store.ReadProperty([]byte(outflowUsageKeyPrefix + key))
+		if err != nil {
+			return newStoreError("Group.ReadProperty", err)
+		}
+		usages[key] = decimal.Zero
+		if len(val) > 0 {
+			usages[key] = decimal.RequireFromString(string(val))
+		}
+	}
+	usages[key] = usages[key].Add(amount)
+	return nil
+}
+
+// hold the transaction over the limits, or release the held one approved,
+// and the transaction allowed to sign is returned true, with the usages to
+// be written when signed
+func (grp *Group) checkTransactionLimits(ctx context.Context, tx *Transaction) (bool, map[string][]byte, error) {
+	if tx.State == TransactionStateHeld {
+		approved, err := grp.checkApproved(tx)
+		if err != nil || !approved {
+			return false, nil, err
+		}
+	}
+	allowed, usages, err := grp.checkOutflowLimits(tx)
+	if err != nil || allowed || tx.State == TransactionStateHeld {
+		return allowed, usages, err
+	}
+
+	tx.State = TransactionStateHeld
+	err = grp.writeTransaction(tx)
+	if err != nil {
+		return false, nil, err
+	}
+	grp.handleError(ctx, "signTransactions", newPolicyError("Group.checkTransactionLimits", "transaction held %s %s %s", tx.TraceId, tx.AssetId, tx.Amount))
+	return false, nil, nil
+}
@@ -0,0 +1,102 @@
+package mtg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// only the properties are implemented, any other store call panics
+type testPropertyStore struct {
+	Store
+	properties map[string][]byte
+}
+
+func newTestPropertyStore() *testPropertyStore {
+	return &testPropertyStore{properties: make(map[string][]byte)}
+}
+
+func (s *testPropertyStore) WriteProperty(key, val []byte) error {
+	s.properties[string(key)] = val
+	return nil
+}
+
+func (s *testPropertyStore) ReadProperty(key []byte) ([]byte, error) {
+	return s.properties[string(key)], nil
+}
+
+func TestOutflowWindows(t *testing.T) {
+	require := require.New(t)
+
+	ts := time.Date(2022, 3, 4, 10, 30, 0, 0, time.UTC)
+	hour, day := outflowWindows(&Transaction{CreatedAt: ts, UpdatedAt: ts.Add(48 * time.Hour)})
+	require.Equal(time.Date(2022, 3, 4, 10, 0, 0, 0, time.UTC).Unix(), hour)
+	require.Equal(time.Date(2022, 3, 4, 0, 0, 0, 0, time.UTC).Unix(), day)
+
+	hour, day = outflowWindows(&Transaction{UpdatedAt: ts.Add(48 * time.Hour)})
+	require.Equal(time.Date(2022, 3, 6, 10, 0, 0, 0, time.UTC).Unix(), hour)
+	require.Equal(time.Date(2022, 3, 6, 0, 0, 0, 0, time.UTC).Unix(), day)
+}
+
+func TestCheckOutflowLimits(t *testing.T) {
+	require := require.New(t)
+
+	assetId := "c6d0c728-2624-429b-8e0d-d9d19b6592fa"
+	store := newTestPropertyStore()
+	genesis := &Epoch{Members: []string{"a", "b", "c"}, Threshold: 2, CreatedAt: time.Unix(100, 0)}
+	grp := &Group{store: store, genesis: genesis, epochs: []*Epoch{genesis}}
+	grp.SetOutflowLimits(&OutflowLimits{
+		PerTransaction: map[string]decimal.Decimal{assetId: decimal.NewFromInt(4)},
+		PerAssetHour:   map[string]decimal.Decimal{assetId: decimal.NewFromInt(5)},
+		PerReceiverDay: map[string]decimal.Decimal{assetId: decimal.NewFromInt(8)},
+	})
+	ts := time.Date(2022, 3, 4, 10, 10, 0, 0, time.UTC)
+	build := func(traceId, receiver, amount string, at time.Time) *Transaction {
+		return &Transaction{
+			TraceId:   traceId,
+			AssetId:   assetId,
+			Receivers: []string{receiver},
+			Threshold: 1,
+			Amount:    amount,
+			CreatedAt: at,
+			UpdatedAt: time.Now(),
+		}
+	}
+	check := func(tx *Transaction) bool {
+		allowed, usages, err := grp.checkOutflowLimits(tx)
+		require.Nil(err)
+		for k, v := range usages {
+			require.Nil(store.WriteProperty([]byte(k), v))
+		}
+		return allowed
+	}
+
+	// the usages are only written by the caller, so the check has no effect
+	first := build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a10", "x", "3", ts)
+	allowed, usages, err := grp.checkOutflowLimits(first)
+	require.Nil(err)
+	require.True(allowed)
+	require.Len(usages, 3)
+	require.Len(store.properties, 0)
+
+	require.True(check(first))
+	require.True(check(first))
+	require.False(check(build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a11", "y", "3", ts.Add(40*time.Minute))))
+	require.False(check(build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a12", "y", "5", ts.Add(time.Hour))))
+	require.True(check(build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a13", "x", "3", ts.Add(time.Hour))))
+	require.False(check(build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a14", "x", "3", ts.Add(2*time.Hour))))
+	require.True(check(build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a15", "x", "3", ts.Add(24*time.Hour))))
+
+	// the compaction and migration transactions are never limited
+	compaction := build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a16", "x", "100", ts)
+	compaction.Memo = CompactionTransactionMemo
+	require.True(check(compaction))
+	migration := build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a17", "x", "100", ts)
+	migration.Memo = EvolutionTransactionMemo
+	require.True(check(migration))
+	refund := build("35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a18", "x", "100", ts)
+	refund.Memo = EncodeEvolutionMemo(genesis)
+	require.False(check(refund))
+}
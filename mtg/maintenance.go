@@ -0,0 +1,251 @@
+package mtg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/mixin/common"
+	"github.com/MixinNetwork/mixin/logger"
+	"github.com/fox-one/mixin-sdk-go"
+)
+
+const (
+	EvolutionTransactionMemo = "EVOLUTION"
+
+	maintenanceOutputsLimit = 1000
+)
+
+// the refund memo tells the user the new group to retry the transaction
+// EVOLUTION:members hash:threshold:epoch timestamp
+type EvolutionMemo struct {
+	MembersHash string
+	Threshold   int
+	Timestamp   time.Time
+}
+
+func EncodeEvolutionMemo(e *Epoch) string {
+	return fmt.Sprintf("%s:%s", EvolutionTransactionMemo, e)
+}
+
+func DecodeEvolutionMemo(memo string) (*EvolutionMemo, error) {
+	parts := strings.Split(memo, ":")
+	if len(parts) != 4 || parts[0] != EvolutionTransactionMemo {
+		return nil, fmt.Errorf("invalid evolution memo %s", memo)
+	}
+	threshold, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	ts, err := strconv.ParseInt(parts[3], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &EvolutionMemo{
+		MembersHash: parts[1],
+		Threshold:   threshold,
+		Timestamp:   time.Unix(0, ts),
+	}, nil
+}
+
+// the maintenance group transfers the old utxos to the new group, and
+// refunds the payments received after the evolution with evolution memo,
+// only one maintenance transaction for each group id and asset is built
+// at a time, so that they won't compete for the same utxos. the retired
+// epochs only list their own outputs, at most maintenanceOutputsLimit of
+// them each round. the store without EpochOutputStore skips the maintenance,
+// so the outputs of the retired epochs stay there until the store upgraded.
+func (grp *Group) maintainRetiredEpochs(ctx context.Context) error {
+	epochs := grp.ListEpochs()
+	if len(epochs) < 2 {
+		return nil
+	}
+	if _, ok := grp.store.(EpochOutputStore); !ok {
+		logger.Verbosef("Group.maintainRetiredEpochs(%d) => %v\n", len(epochs), errStoreCapability(grp.store, "EpochOutputStore"))
+		return nil
+	}
+	pendings, err := grp.listPendingTransactions()
+	if err != nil {
+		return err
+	}
+
+	for _, e := range epochs[:len(epochs)-1] {
+		batches, err := grp.listEpochUnspentOutputs(e, maintenanceOutputsLimit)
+		if err != nil {
+			return err
+		}
+		signed, err := listOutputsForMembers(grp.store, e, mixin.UTXOStateSigned, maintenanceOutputsLimit)
+		if err != nil {
+			return newStoreError("Group.ListOutputsForMembers", err)
+		}
+		for _, out := range signed {
+			if checkMaintenanceOutput(out) {
+				key := out.GroupId + ":" + out.AssetID
+				batches[key] = append(batches[key], out)
+			}
+		}
+		for _, k := range sortedOutputsBatchKeys(batches) {
+			if pendings[fmt.Sprintf("%d:%s", e.CreatedAt.UnixNano(), k)] {
+				continue
+			}
+			first := batches[k][0]
+			err := grp.maintainEpochOutputs(ctx, e, first.GroupId, first.AssetID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (grp *Group) maintainEpochOutputs(ctx context.Context, e *Epoch, groupId, assetId string) error {
+	late, migrated, err := grp.planEpochMaintenance(e, groupId, assetId)
+	if err != nil {
+		return err
+	}
+	successor := grp.readEpoch(grp.epochRetiredAt(e))
+
+	if late != nil {
+		memo := EncodeEvolutionMemo(successor)
+		traceId := mixin.UniqueConversationID(late.UTXOID, EvolutionTransactionMemo)
+		err := grp.buildTransaction(ctx, assetId, []string{late.Sender}, 1, late.Amount.String(), memo, traceId, groupId, late.CreatedAt, nil, e)
+		logger.Printf("Group.refundEvolution(%s, %s, %s) => %v\n", e, late.UTXOID, traceId, err)
+		return err
+	}
+
+	total, traceId := migrationTransaction(e, migrated)
+	ts := migrated[len(migrated)-1].CreatedAt
+	err = grp.buildTransaction(ctx, assetId, successor.Members, successor.Threshold, total.String(), EvolutionTransactionMemo, traceId, groupId, ts, nil, e)
+	logger.Printf("Group.migrateEvolution(%s, %s, %d, %s) => %s %v\n", e, successor, len(migrated), total, traceId, err)
+	return err
+}
+
+// the outputs are decided one by one in the created order, the first late
+// deposit is refunded alone, otherwise all outputs before the next late
+// deposit are migrated together. the outputs signed by other maintenance
+// transactions are decided as well, so all nodes make the same plan no matter
+// whether they have drained the signing requests. the signing decides the
+// outputs again, so the maintenance transactions never spend the outputs of
+// each other.
+func (grp *Group) planEpochMaintenance(e *Epoch, groupId, assetId string) (*Output, []*Output, error) {
+	outputs, err := grp.listEpochMaintenanceOutputs(e, groupId, assetId)
+	if err != nil {
+		return nil, nil, err
+	}
+	var migrated []*Output
+	for _, out := range outputs {
+		late, err := grp.checkLateDeposit(e, out)
+		if err != nil {
+			return nil, nil, err
+		}
+		if late && len(migrated) == 0 {
+			return out, nil, nil
+		} else if late {
+			break
+		}
+		migrated = append(migrated, out)
+	}
+	return nil, migrated, nil
+}
+
+func (grp *Group) listEpochMaintenanceOutputs(e *Epoch, groupId, assetId string) ([]*Output, error) {
+	outputs, err := grp.listEpochOutputsForAsset(e, groupId, assetId, mixin.UTXOStateUnspent, OutputsBatchSize)
+	if err != nil {
+		return nil, newStoreError("Group.listEpochOutputsForAsset", err)
+	}
+	signed, err := grp.listEpochOutputsForAsset(e, groupId, assetId, mixin.UTXOStateSigned, OutputsBatchSize)
+	if err != nil {
+		return nil, newStoreError("Group.listEpochOutputsForAsset", err)
+	}
+	for _, out := range signed {
+		if checkMaintenanceOutput(out) {
+			outputs = append(outputs, out)
+		}
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		if outputs[i].CreatedAt.Equal(outputs[j].CreatedAt) {
+			return outputs[i].UTXOID < outputs[j].UTXOID
+		}
+		return outputs[i].CreatedAt.Before(outputs[j].CreatedAt)
+	})
+	if len(outputs) > OutputsBatchSize {
+		outputs = outputs[:OutputsBatchSize]
+	}
+	return outputs, nil
+}
+
+// the outputs spent by the maintenance transaction, nil if they are not
+// the same as the outputs decided when built, e.g. some spent already
+func (grp *Group) listMaintenanceOutputs(e *Epoch, tx *Transaction) ([]*Output, error) {
+	late, migrated, err := grp.planEpochMaintenance(e, tx.GroupId, tx.AssetId)
+	if err != nil {
+		return nil, err
+	}
+	if late != nil && mixin.UniqueConversationID(late.UTXOID, EvolutionTransactionMemo) == tx.TraceId {
+		return []*Output{late}, nil
+	}
+	if _, traceId := migrationTransaction(e, migrated); len(migrated) > 0 && traceId == tx.TraceId {
+		return migrated, nil
+	}
+	return nil, nil
+}
+
+func migrationTransaction(e *Epoch, outputs []*Output) (common.Integer, string) {
+	var total common.Integer
+	traceId := mixin.UniqueConversationID(EvolutionTransactionMemo, e.String())
+	for _, out := range outputs {
+		total = total.Add(common.NewIntegerFromString(out.Amount.String()))
+		traceId = mixin.UniqueConversationID(traceId, out.UTXOID)
+	}
+	return total, traceId
+}
+
+// the output signed by a maintenance transaction of any node
+func checkMaintenanceOutput(out *Output) bool {
+	_, extra := decodeTransactionWithExtra(out.SignedTx)
+	return extra != nil && strings.HasPrefix(extra.M, EvolutionTransactionMemo)
+}
+
+// the migration and late deposit refunds of the retired epochs
+func isMaintenanceTransaction(tx *Transaction) bool {
+	return strings.HasPrefix(tx.Memo, EvolutionTransactionMemo)
+}
+
+// a late deposit is a payment received after the epoch retired, but not the
+// change of the transactions sent by the group
+func (grp *Group) checkLateDeposit(e *Epoch, out *Output) (bool, error) {
+	retiredAt := grp.epochRetiredAt(e)
+	if out.Sender == "" || out.CreatedAt.Before(retiredAt) {
+		return false, nil
+	}
+	tx, err := grp.store.ReadTransactionByHash(out.TransactionHash)
+	return tx == nil, newStoreError("Group.ReadTransactionByHash", err)
+}
+
+// all unfinished transactions indexed by epoch, group id and asset
+func (grp *Group) listPendingTransactions() (map[string]bool, error) {
+	pendings := make(map[string]bool)
+	for _, state := range []int{TransactionStateHeld, TransactionStateInitial, TransactionStateSigning, TransactionStateSigned} {
+		txs, err := grp.store.ListTransactions(state, 0)
+		if err != nil {
+			return nil, newStoreError("Group.ListTransactions", err)
+		}
+		for _, tx := range txs {
+			e := grp.readEpoch(tx.Epoch)
+			pendings[fmt.Sprintf("%d:%s:%s", e.CreatedAt.UnixNano(), tx.GroupId, tx.AssetId)] = true
+		}
+	}
+	return pendings, nil
+}
+
+// the change of any transaction spending the outputs of a retired epoch
+// goes to the working group, so the old members never receive new outputs
+func (grp *Group) readChangeEpoch(e *Epoch) *Epoch {
+	if grp.epochRetiredAt(e).IsZero() {
+		return e
+	}
+	return grp.currentEpoch()
+}
@@ -0,0 +1,76 @@
+package mtgtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessAuditLog(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+
+	var traces []string
+	for _, amount := range []string{"1", "2.5", "3"} {
+		out := h.Transfer(DefaultSender, DefaultAssetId, amount, "hello")
+		traces = append(traces, RefundWorkerTraceId(out))
+	}
+	done := h.RunUntil(12, func() bool {
+		for _, id := range traces {
+			tx, err := h.Nodes[0].Store.ReadTransactionByTraceId(id)
+			require.Nil(err)
+			if tx == nil || tx.State != mtg.TransactionStateSnapshot {
+				return false
+			}
+		}
+		return true
+	})
+	require.True(done)
+
+	// the signing entries differ among members, but the digests are the same
+	var digest *mtg.AuditDigest
+	for _, n := range h.Nodes {
+		d, err := n.Group.VerifyAuditLog()
+		require.Nil(err)
+		require.Equal(uint64(6), d.Round)
+		last, err := n.Group.AuditDigest()
+		require.Nil(err)
+		require.Equal(d, last)
+		if digest != nil {
+			require.Equal(digest, d)
+		}
+		digest = d
+	}
+
+	var buf bytes.Buffer
+	err := h.Nodes[1].Group.WriteAuditLog(&buf, 2, 4)
+	require.Nil(err)
+	var entries []*mtg.AuditEntry
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var e mtg.AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		require.Nil(err)
+		entries = append(entries, &e)
+	}
+	require.Len(entries, 3)
+	require.Equal(uint64(2), entries[0].Sequence)
+	require.Equal(uint64(4), entries[2].Sequence)
+	require.Equal(entries[0].Hash, entries[1].Previous)
+
+	all, err := h.Nodes[1].Group.ExportAuditLog(1, 0)
+	require.Nil(err)
+	require.Nil(mtg.VerifyAuditEntries(nil, all))
+	var kinds = map[string]int{}
+	for _, e := range all {
+		kinds[e.Kind]++
+	}
+	require.Equal(3, kinds[mtg.AuditKindAction])
+	require.Less(6, kinds[mtg.AuditKindTransaction])
+}
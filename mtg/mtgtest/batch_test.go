@@ -0,0 +1,96 @@
+package mtgtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// pay the amount equally to all payees in a batch transaction
+type payrollWorker struct {
+	grp    *mtg.Group
+	payees []string
+}
+
+func (pw *payrollWorker) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
+	if out.Memo != "payroll" {
+		return true
+	}
+	var entries []*mtg.TransactionEntry
+	amount := out.Amount.Div(decimal.NewFromInt(int64(len(pw.payees))))
+	for _, p := range pw.payees {
+		entries = append(entries, &mtg.TransactionEntry{
+			Receivers: []string{p},
+			Threshold: 1,
+			Amount:    amount.String(),
+		})
+	}
+	traceId := mixin.UniqueConversationID(out.UTXOID, "payroll")
+	err := pw.grp.BuildBatchTransaction(ctx, out.AssetID, entries, "payroll", traceId, "")
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+func (pw *payrollWorker) ProcessCollectibleOutput(ctx context.Context, out *mtg.CollectibleOutput) bool {
+	return false
+}
+
+func TestHarnessBatchTransaction(t *testing.T) {
+	require := require.New(t)
+
+	var payees []string
+	for i := 0; i < 20; i++ {
+		payees = append(payees, mixin.UniqueConversationID("payee", fmt.Sprint(i)))
+	}
+	h := NewDefaultHarness(t)
+	h.AddWorker(func(n *Node) mtg.Worker { return &payrollWorker{grp: n.Group, payees: payees} })
+
+	h.Transfer(DefaultSender, DefaultAssetId, "3", "deposit")
+	out := h.Transfer(DefaultSender, DefaultAssetId, "10", "payroll")
+
+	traceId := mixin.UniqueConversationID(out.UnifiedUTXOID, "payroll")
+	done := h.RunUntilState(8, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.RequireTransactionState(traceId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "3")
+	for _, p := range payees {
+		h.RequireBalance([]string{p}, 1, DefaultAssetId, "0.5")
+	}
+
+	for _, n := range h.Nodes {
+		tx, err := n.Store.ReadTransactionByTraceId(traceId)
+		require.Nil(err)
+		require.Equal("10.00000000", tx.Amount, n.Id)
+		require.Len(tx.Entries, len(payees))
+		for i, en := range tx.Entries {
+			require.Equal(payees[i], en.Receivers[0])
+			require.Equal("0.50000000", en.Amount)
+			require.Equal(mtg.TransactionStateSnapshot, en.State)
+			require.Equal(mixin.UniqueConversationID(traceId, fmt.Sprintf("ENTRY:%d", i)), en.TraceId)
+		}
+	}
+
+	err := h.Nodes[0].Group.BuildBatchTransaction(context.Background(), DefaultAssetId, nil, "", traceId, "")
+	require.Equal(mtg.ErrorKindInput, mtg.ErrorKindOf(err))
+	err = h.Nodes[0].Group.BuildBatchTransaction(context.Background(), DefaultAssetId, []*mtg.TransactionEntry{{
+		Receivers: []string{DefaultSender},
+		Threshold: 1,
+		Amount:    "0",
+	}}, "", traceId, "")
+	require.Equal(mtg.ErrorKindInput, mtg.ErrorKindOf(err))
+	err = h.Nodes[0].Group.BuildBatchTransaction(context.Background(), DefaultAssetId, []*mtg.TransactionEntry{{
+		Receivers: []string{DefaultSender},
+		Threshold: 1,
+		Amount:    "0.123456789",
+	}}, "", traceId, "")
+	require.Equal(mtg.ErrorKindInput, mtg.ErrorKindOf(err))
+	require.Contains(err.Error(), "invalid amount precision")
+}
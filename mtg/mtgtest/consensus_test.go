@@ -0,0 +1,196 @@
+package mtgtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+// the escrow worker locks the payment, and refunds it after an hour, the
+// expiry is decided by the consensus time
+type escrowWorker struct {
+	grp   *mtg.Group
+	times []time.Time
+}
+
+func (ew *escrowWorker) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
+	now, ok := mtg.ConsensusTime(ctx)
+	if !ok || !now.Equal(out.CreatedAt) {
+		panic(now)
+	}
+	ew.times = append(ew.times, now)
+	if out.Memo != "lock" {
+		return true
+	}
+	err := ew.grp.ScheduleTimer(ctx, &mtg.Timer{
+		Id:      mixin.UniqueConversationID(out.UTXOID, "expiry"),
+		Name:    "expiry",
+		At:      now.Add(time.Hour),
+		Payload: mtg.MsgpackMarshalPanic(out),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+func (ew *escrowWorker) ProcessCollectibleOutput(ctx context.Context, out *mtg.CollectibleOutput) bool {
+	return false
+}
+
+func (ew *escrowWorker) expire(ctx context.Context, t *mtg.Timer) error {
+	now, _ := mtg.ConsensusTime(ctx)
+	ew.times = append(ew.times, now)
+	var out mtg.Output
+	err := mtg.MsgpackUnmarshal(t.Payload, &out)
+	if err != nil {
+		return err
+	}
+	traceId := mixin.UniqueConversationID(out.UTXOID, "refund")
+	return ew.grp.BuildTransaction(ctx, out.AssetID, []string{out.Sender}, 1, out.Amount.String(), "expired", traceId, "")
+}
+
+func TestHarnessConsensusTimers(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	workers := make([]*escrowWorker, len(h.Nodes))
+	for i, n := range h.Nodes {
+		ew := &escrowWorker{grp: n.Group}
+		n.Group.RegisterTimerHandler("expiry", ew.expire)
+		n.Group.AddWorker(ew)
+		workers[i] = ew
+	}
+
+	lock := h.Transfer(DefaultSender, DefaultAssetId, "7.5", "lock")
+	traceId := RefundWorkerTraceId(lock)
+	second := h.Transfer(DefaultSender, DefaultAssetId, "1", "hello")
+	h.Steps(4)
+	for _, n := range h.Nodes {
+		timers, err := n.Group.ListTimers()
+		require.Nil(err)
+		require.Len(timers, 1)
+		require.Equal(lock.CreatedAt.Add(time.Hour), timers[0].At)
+		tx, err := n.Store.ReadTransactionByTraceId(traceId)
+		require.Nil(err)
+		require.Nil(tx)
+	}
+
+	// the timer fires before the first action after the expiry
+	h.Network.Advance(2 * time.Hour)
+	last := h.Transfer(DefaultSender, DefaultAssetId, "1", "hello")
+	done := h.RunUntilState(8, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+	h.RequireTransactionState(traceId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "7.5")
+
+	expected := []time.Time{lock.CreatedAt, second.CreatedAt, lock.CreatedAt.Add(time.Hour), last.CreatedAt}
+	for i, n := range h.Nodes {
+		timers, err := n.Group.ListTimers()
+		require.Nil(err)
+		require.Len(timers, 0)
+		now, err := n.Group.ConsensusNow()
+		require.Nil(err)
+		require.True(now.Equal(last.CreatedAt))
+		require.Len(workers[i].times, 4)
+		for j, ts := range expected {
+			require.True(ts.Equal(workers[i].times[j]), ts)
+		}
+	}
+}
+
+func TestHarnessConsensusIdleTimers(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	workers := make([]*escrowWorker, len(h.Nodes))
+	for i, n := range h.Nodes {
+		ew := &escrowWorker{grp: n.Group}
+		n.Group.RegisterTimerHandler("expiry", ew.expire)
+		n.Group.AddWorker(ew)
+		workers[i] = ew
+	}
+
+	lock := h.Transfer(DefaultSender, DefaultAssetId, "7.5", "lock")
+	traceId := RefundWorkerTraceId(lock)
+	h.Steps(4)
+
+	// the timer is never fired by the local time when the group is idle
+	h.Network.Advance(2 * time.Hour)
+	h.Steps(4)
+	for i, n := range h.Nodes {
+		timers, err := n.Group.ListTimers()
+		require.Nil(err)
+		require.Len(timers, 1)
+		require.Len(workers[i].times, 1)
+		tx, err := n.Store.ReadTransactionByTraceId(traceId)
+		require.Nil(err)
+		require.Nil(tx)
+	}
+
+	// the timer fires before the next action, with its own time, and the
+	// transaction signed is never stamped with the local time
+	last := h.Transfer(DefaultSender, DefaultAssetId, "1", "hello")
+	done := h.RunUntilState(8, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+	h.RequireTransactionState(traceId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "7.5")
+
+	expected := []time.Time{lock.CreatedAt, lock.CreatedAt.Add(time.Hour), last.CreatedAt}
+	for i, n := range h.Nodes {
+		timers, err := n.Group.ListTimers()
+		require.Nil(err)
+		require.Len(timers, 0)
+		now, err := n.Group.ConsensusNow()
+		require.Nil(err)
+		require.True(now.Equal(last.CreatedAt))
+		require.Len(workers[i].times, 3)
+		for j, ts := range expected {
+			require.True(ts.Equal(workers[i].times[j]), ts)
+		}
+		tx, err := n.Store.ReadTransactionByTraceId(traceId)
+		require.Nil(err)
+		if tx.AssetId != "" {
+			require.True(tx.CreatedAt.Equal(lock.CreatedAt.Add(time.Hour)))
+			require.False(tx.UpdatedAt.After(last.CreatedAt))
+		}
+	}
+}
+
+func TestHarnessConsensusTimerError(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	for _, n := range h.Nodes {
+		ew := &escrowWorker{grp: n.Group}
+		n.Group.RegisterTimerHandler("expiry", func(ctx context.Context, t *mtg.Timer) error {
+			return fmt.Errorf("broken timer %s", t.Id)
+		})
+		n.Group.AddWorker(ew)
+	}
+
+	h.Transfer(DefaultSender, DefaultAssetId, "7.5", "lock")
+	h.Steps(4)
+	h.Network.Advance(2 * time.Hour)
+	h.Transfer(DefaultSender, DefaultAssetId, "1", "hello")
+	h.Steps(2)
+
+	// the unknown error halts the group, and the timer is kept
+	for _, n := range h.Nodes {
+		timers, err := n.Group.ListTimers()
+		require.Nil(err)
+		require.Len(timers, 1)
+		status, err := n.Group.Status(context.Background())
+		require.Nil(err)
+		require.Contains(status.Stages["fireTimer"].Error, "broken timer")
+	}
+}
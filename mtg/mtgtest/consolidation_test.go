@@ -0,0 +1,73 @@
+package mtgtest
+
+import (
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessConsolidation(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddWorker(func(n *Node) mtg.Worker {
+		err := n.Group.SetConsolidationPolicy(&mtg.ConsolidationPolicy{Threshold: 72})
+		require.Nil(err)
+		return &payWorker{grp: n.Group}
+	})
+
+	for i := 0; i < 80; i++ {
+		h.Transfer(DefaultSender, DefaultAssetId, "0.01", "deposit")
+	}
+
+	// the actions are handled in batches, and the consolidation waits until
+	// all of them handled
+	var stats []*mtg.FragmentationStats
+	for i := 0; i < 8; i++ {
+		h.StepNode(0)
+		var err error
+		stats, err = h.Nodes[0].Group.FragmentationStats()
+		require.Nil(err)
+		if stats[0].Consolidating {
+			break
+		}
+	}
+	require.Len(stats, 1)
+	require.Equal(DefaultAssetId, stats[0].AssetId)
+	require.True(stats[0].Consolidating)
+	// the outputs signed by the compaction transaction are not unspent
+	require.Equal(44, stats[0].Outputs)
+	require.Equal("0.44", stats[0].Total.String())
+	require.Equal("0.01", stats[0].Smallest.String())
+
+	done := h.RunUntil(8, func() bool {
+		return countUnspent(h) == 45
+	})
+	require.True(done)
+	h.Steps(3)
+	require.Equal(45, countUnspent(h))
+	h.RequireConsensus()
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "0.8")
+
+	for _, n := range h.Nodes {
+		stats, err := n.Group.FragmentationStats()
+		require.Nil(err)
+		require.Len(stats, 1)
+		require.Equal(45, stats[0].Outputs)
+		require.Equal("0.8", stats[0].Total.String())
+		require.Equal("0.36", stats[0].Largest.String())
+		require.False(stats[0].Consolidating)
+	}
+}
+
+func countUnspent(h *Harness) int {
+	var count int
+	for _, o := range h.Network.ListOutputs(h.Members, h.Threshold) {
+		if o.State == mixin.UTXOStateUnspent {
+			count += 1
+		}
+	}
+	return count
+}
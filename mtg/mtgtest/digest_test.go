@@ -0,0 +1,66 @@
+package mtgtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+// the buggy worker ignores some outputs, so its node diverges
+type buggyWorker struct {
+	refundWorker
+}
+
+func (bw *buggyWorker) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
+	if out.Memo == "bug" {
+		return false
+	}
+	return bw.refundWorker.ProcessOutput(ctx, out)
+}
+
+func TestHarnessDigestExchange(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.EnableDigestExchange(4)
+	alerts := make(map[string][]*mtg.Error)
+	for i, n := range h.Nodes {
+		id := n.Id
+		n.Group.SetErrorHandler(func(ctx context.Context, err *mtg.Error) bool {
+			if err.Op == "Group.compareDigests" {
+				alerts[id] = append(alerts[id], err)
+				return true
+			}
+			return mtg.DefaultErrorHandler(ctx, err)
+		})
+		if i == 2 {
+			n.Group.AddWorker(&buggyWorker{refundWorker{grp: n.Group}})
+		} else {
+			n.Group.AddWorker(&refundWorker{grp: n.Group})
+		}
+	}
+
+	h.Transfer(DefaultSender, DefaultAssetId, "1", "hello")
+	bug := h.Transfer(DefaultSender, DefaultAssetId, "2", "bug")
+	h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	h.Steps(8)
+
+	for _, n := range h.Nodes {
+		d, err := n.Group.AuditDigest()
+		require.Nil(err)
+		require.GreaterOrEqual(d.Round, uint64(4))
+	}
+	traceId := RefundWorkerTraceId(bug)
+	require.Len(alerts[h.Members[2]], 1)
+	require.Equal(mtg.ErrorKindConsensus, alerts[h.Members[2]][0].Kind)
+	require.Contains(alerts[h.Members[2]][0].Error(), "local digest diverged at round 4")
+	require.Contains(alerts[h.Members[2]][0].Error(), traceId)
+	for _, m := range h.Members[:2] {
+		require.Len(alerts[m], 1)
+		require.Equal(mtg.ErrorKindPolicy, alerts[m][0].Kind)
+		require.Contains(alerts[m][0].Error(), "member "+h.Members[2])
+		require.Contains(alerts[m][0].Error(), traceId)
+	}
+}
@@ -0,0 +1,122 @@
+package mtgtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessDrainDedupe(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+
+	first := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	firstId := RefundWorkerTraceId(first)
+	h.RunUntilState(12, firstId, mtg.TransactionStateSnapshot)
+	h.RequireTransactionState(firstId, mtg.TransactionStateSnapshot)
+	metrics := h.Nodes[0].Group.DrainMetrics()
+	require.True(metrics.Drained > 0)
+	require.True(metrics.Hits > 0)
+	require.Equal(uint64(0), metrics.Pruned)
+	// the lag is measured after the updated outputs of the current epoch
+	// drained, with the epoch listed by value
+	require.True(metrics.Lag > 0)
+
+	// the restarted node skips the outputs drained before
+	n := h.Nodes[0]
+	grp, err := mtg.BuildGroupWithNetwork(context.Background(), n.Store, n.Conf, h.Network.Client(n.Id, nodePIN))
+	require.Nil(err)
+	grp.AddWorker(&refundWorker{grp: grp})
+	n.Group = grp
+	h.StepNode(0)
+	metrics = grp.DrainMetrics()
+	require.Equal(uint64(0), metrics.Drained)
+	require.True(metrics.Hits > 0)
+
+	// the outputs far before the checkpoints are pruned
+	h.Network.Advance(2 * time.Hour)
+	second := h.Transfer(DefaultSender, DefaultAssetId, "2", "hello")
+	secondId := RefundWorkerTraceId(second)
+	h.RunUntil(12, func() bool {
+		tx, err := n.Store.ReadTransactionByTraceId(secondId)
+		require.Nil(err)
+		return tx != nil && tx.State == mtg.TransactionStateSnapshot
+	})
+	h.Steps(3)
+	h.RequireTransactionState(secondId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "5")
+	require.True(grp.DrainMetrics().Pruned > 0)
+}
+
+func TestHarnessDrainInvalidSignedTx(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	out := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	h.Steps(2)
+
+	// the output is signed by a raw not decodable, e.g. a new kernel version
+	h.Network.mutex.Lock()
+	for _, u := range h.Network.outputs {
+		if u.UnifiedUTXOID == out.UnifiedUTXOID {
+			u.State = mixin.UTXOStateSigned
+			u.SignedTx = "invalid"
+			u.UpdatedAt = h.Network.now()
+		}
+	}
+	h.Network.mutex.Unlock()
+
+	second := h.Transfer(DefaultSender, DefaultAssetId, "2", "hello")
+	h.Steps(2)
+	for _, n := range h.Nodes {
+		s, err := n.Group.Status(context.Background())
+		require.Nil(err)
+		require.False(s.Draining.Updated.Before(second.UpdatedAt))
+		require.Contains(s.Stages["processMultisigOutput"].Error, "invalid signed transaction")
+	}
+	h.RequireConsensus()
+}
+
+func TestHarnessDrainInvalidSignedTxHalted(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	var reported int
+	h.Nodes[0].Group.SetErrorHandler(func(ctx context.Context, err *mtg.Error) bool {
+		reported++
+		return false
+	})
+	out := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	h.Steps(2)
+
+	h.Network.mutex.Lock()
+	updated := h.Network.now()
+	for _, u := range h.Network.outputs {
+		if u.UnifiedUTXOID == out.UnifiedUTXOID {
+			u.State = mixin.UTXOStateSigned
+			u.SignedTx = "invalid"
+			u.UpdatedAt = updated
+		}
+	}
+	h.Network.mutex.Unlock()
+	h.Steps(2)
+	require.Equal(1, reported)
+	s, err := h.Nodes[0].Group.Status(context.Background())
+	require.Nil(err)
+	require.True(s.Draining.Updated.Before(updated))
+
+	// the output is not drained by the halted node, so it is reported again
+	n := h.Restart(0)
+	h.StepNode(0)
+	s, err = n.Group.Status(context.Background())
+	require.Nil(err)
+	require.Contains(s.Stages["processMultisigOutput"].Error, "invalid signed transaction")
+	require.False(s.Draining.Updated.Before(updated))
+}
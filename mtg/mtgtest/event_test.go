@@ -0,0 +1,43 @@
+package mtgtest
+
+import (
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessEvents(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+	events := make(map[string][]*mtg.Event)
+	for _, n := range h.Nodes {
+		id := n.Id
+		n.Group.AddEventListener(func(e *mtg.Event) { events[id] = append(events[id], e) })
+	}
+
+	out := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	traceId := RefundWorkerTraceId(out)
+	done := h.RunUntilState(12, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+
+	for _, n := range h.Nodes {
+		tx, err := n.Store.ReadTransactionByTraceId(traceId)
+		require.Nil(err)
+		var kinds []string
+		for _, e := range events[n.Id] {
+			require.Equal(traceId, e.TraceId)
+			kinds = append(kinds, e.Kind)
+		}
+		require.Equal(mtg.EventTransactionQueued, kinds[0])
+		require.Equal(mtg.TransactionStateInitial, events[n.Id][0].State)
+		require.Contains(kinds, mtg.EventTransactionSigned)
+		last := events[n.Id][len(kinds)-1]
+		require.Equal(mtg.EventTransactionSnapshot, last.Kind)
+		require.Equal(tx.Hash, last.Hash)
+		require.Equal(mtg.TransactionStateSnapshot, last.Transaction.State)
+	}
+}
@@ -0,0 +1,99 @@
+package mtgtest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessAddRemoveNode(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	grp := h.Nodes[0].Group
+	genesis := grp.ListEpochs()[0]
+	newcomer := "2ec6fcc4-5f5f-4b3c-9a3b-0b5f4bd7a0c1"
+
+	ts := genesis.CreatedAt.Add(time.Hour)
+	require.Nil(grp.AddNode(newcomer, 3, ts))
+	require.Nil(grp.RemoveNode(h.Members[0], 2, ts))
+	members, threshold, at, err := grp.ListActiveNodes()
+	require.Nil(err)
+	require.ElementsMatch([]string{h.Members[1], h.Members[2], newcomer}, members)
+	require.Equal(2, threshold)
+	require.Equal(ts, at)
+
+	// the iterations are persisted and only appended in time order
+	require.NotNil(grp.AddNode(h.Members[0], 2, genesis.CreatedAt.Add(time.Minute)))
+	require.NotNil(grp.RemoveNode(h.Members[1], 3, ts.Add(time.Hour)))
+	irs, err := h.Nodes[0].Store.ListIterations()
+	require.Nil(err)
+	irs = irs[len(irs)-2:]
+	require.Equal(mtg.IterationActionAdd, irs[0].Action)
+	require.Equal(newcomer, irs[0].NodeId)
+	require.Equal(mtg.IterationActionRemove, irs[1].Action)
+	require.Equal(h.Members[0], irs[1].NodeId)
+
+	epochs := grp.ListEpochs()
+	require.Len(epochs, 2)
+	require.True(epochs[0].HasMember(h.Members[0]))
+	require.False(epochs[1].HasMember(h.Members[0]))
+	require.True(epochs[1].Match([]string{newcomer, h.Members[2], h.Members[1]}, 2))
+}
+
+func TestHarnessEvolutionMaintenance(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	genesis := h.Nodes[0].Group.ListEpochs()[0]
+	newcomer := "2ec6fcc4-5f5f-4b3c-9a3b-0b5f4bd7a0c1"
+	h.Transfer(DefaultSender, DefaultAssetId, "3", "deposit")
+	h.Transfer(DefaultSender, DefaultAssetId, "2", "deposit")
+	h.Steps(2)
+
+	ts := genesis.CreatedAt.Add(time.Hour)
+	for _, n := range h.Nodes {
+		require.Nil(n.Group.AddNode(newcomer, 2, ts))
+	}
+	successor := append([]string{newcomer}, h.Members...)
+	h.Network.Advance(2 * time.Hour)
+	late := h.Transfer(DefaultSender, DefaultAssetId, "1.5", "late")
+
+	// the old outputs are migrated to the successor, and the late deposit
+	// refunded to the sender with the memo of the successor
+	done := h.RunUntil(64, func() bool {
+		return h.Balance(successor, 2, DefaultAssetId).Equal(decimal.RequireFromString("5")) &&
+			h.Balance([]string{DefaultSender}, 1, DefaultAssetId).Equal(decimal.RequireFromString("1.5"))
+	})
+	require.True(done)
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "0")
+
+	refund := mixin.UniqueConversationID(late.UnifiedUTXOID, mtg.EvolutionTransactionMemo)
+	require.True(h.RunUntilState(16, refund, mtg.TransactionStateSnapshot))
+	// the nodes only drained the transactions built by others have no memo
+	migrations := make(map[string]bool)
+	for _, n := range h.Nodes {
+		tx, err := n.Store.ReadTransactionByTraceId(refund)
+		require.Nil(err)
+		if tx.AssetId != "" {
+			memo, err := mtg.DecodeEvolutionMemo(tx.Memo)
+			require.Nil(err)
+			require.Equal(2, memo.Threshold)
+			require.Equal(ts, memo.Timestamp)
+		}
+		txs, err := n.Store.ListTransactions(mtg.TransactionStateSnapshot, 0)
+		require.Nil(err)
+		for _, tx := range txs {
+			if tx.Memo == mtg.EvolutionTransactionMemo {
+				migrations[tx.TraceId] = true
+				require.ElementsMatch(successor, tx.Receivers)
+			}
+		}
+	}
+	require.Len(migrations, 1)
+	h.RequireConsensus()
+}
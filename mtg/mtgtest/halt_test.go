@@ -0,0 +1,55 @@
+package mtgtest
+
+import (
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessHaltResume(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+
+	// the votes from non members are passed to the workers and refunded,
+	// and the duplicated votes are ignored
+	h.Transfer(DefaultSender, DefaultAssetId, "0.0001", mtg.HaltMemo)
+	h.Transfer(h.Members[0], DefaultAssetId, "0.0001", mtg.HaltMemo)
+	h.Transfer(h.Members[0], DefaultAssetId, "0.0001", mtg.HaltMemo)
+	h.Steps(8)
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "0.0001")
+	for _, n := range h.Nodes {
+		halted, err := n.Group.Halted()
+		require.Nil(err)
+		require.False(halted)
+	}
+
+	h.Transfer(h.Members[1], DefaultAssetId, "0.0001", mtg.HaltMemo)
+	out := h.Transfer(DefaultSender, DefaultAssetId, "7.5", "hello")
+	traceId := RefundWorkerTraceId(out)
+	h.Steps(8)
+	for _, n := range h.Nodes {
+		halted, err := n.Group.Halted()
+		require.Nil(err)
+		require.True(halted)
+	}
+	h.RequireTransactionState(traceId, mtg.TransactionStateInitial)
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "0.0001")
+
+	h.Transfer(h.Members[2], DefaultAssetId, "0.0001", mtg.ResumeMemo)
+	h.Transfer(h.Members[0], DefaultAssetId, "0.0001", mtg.ResumeMemo)
+	done := h.RunUntilState(8, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+	for _, n := range h.Nodes {
+		halted, err := n.Group.Halted()
+		require.Nil(err)
+		require.False(halted)
+	}
+	h.RequireTransactionState(traceId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "7.5001")
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "0.0005")
+}
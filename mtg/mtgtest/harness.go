@@ -0,0 +1,242 @@
+package mtgtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/MixinNetwork/trusted-group/mtg/store"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	nodePIN = "123456"
+
+	// the user and asset paid to the group in most tests
+	DefaultSender  = "e8e8a0d2-51d5-4a4d-a5b5-8f9a0f3c6a11"
+	DefaultAssetId = "c6d0c728-2624-429b-8e0d-d9d19b6592fa"
+)
+
+type Node struct {
+	Id    string
+	Conf  *mtg.Configuration
+	Group *mtg.Group
+	Store *store.BadgerStore
+}
+
+// the harness boots several groups on the same fake network, each node has
+// its own in memory store, and the groups are only advanced by Step, so
+// the tests are fully deterministic
+type Harness struct {
+	t         testing.TB
+	ctx       context.Context
+	Network   *Network
+	Nodes     []*Node
+	Members   []string
+	Threshold int
+}
+
+func NewHarness(t testing.TB, size, threshold int) *Harness {
+	require := require.New(t)
+	ctx := context.Background()
+
+	var members []string
+	for i := 0; i < size; i++ {
+		members = append(members, mixin.UniqueConversationID("mtgtest", fmt.Sprintf("node:%d", i)))
+	}
+	genesis := time.Unix(1600000000, 0)
+	h := &Harness{
+		t:         t,
+		ctx:       ctx,
+		Network:   NewNetwork(genesis),
+		Members:   members,
+		Threshold: threshold,
+	}
+
+	for _, id := range members {
+		db, err := store.OpenMemoryBadger(ctx)
+		require.Nil(err)
+		t.Cleanup(func() { db.Close() })
+
+		conf := &mtg.Configuration{}
+		conf.App.ClientId = id
+		conf.App.PIN = nodePIN
+		conf.Genesis.Members = append([]string{}, members...)
+		conf.Genesis.Threshold = threshold
+		conf.Genesis.Timestamp = genesis.UnixNano()
+		grp, err := mtg.BuildGroupWithNetwork(ctx, db, conf, h.Network.Client(id, nodePIN))
+		require.Nil(err)
+		h.Nodes = append(h.Nodes, &Node{Id: id, Conf: conf, Group: grp, Store: db})
+	}
+	return h
+}
+
+// rebuild the group of the node on its store, to simulate a restart, and
+// the workers must be added to the new group again
+func (h *Harness) Restart(i int) *Node {
+	n := h.Nodes[i]
+	grp, err := mtg.BuildGroupWithNetwork(h.ctx, n.Store, n.Conf, h.Network.Client(n.Id, nodePIN))
+	require.Nil(h.t, err)
+	n.Group = grp
+	return n
+}
+
+// three nodes with threshold two, which is enough for most tests
+func NewDefaultHarness(t testing.TB) *Harness {
+	return NewHarness(t, 3, 2)
+}
+
+// every node gets its own worker, because the worker usually holds the group
+func (h *Harness) AddWorker(build func(node *Node) mtg.Worker) {
+	for _, n := range h.Nodes {
+		n.Group.AddWorker(build(n))
+	}
+}
+
+// all outputs are refunded to the sender, see RefundWorkerTraceId
+func (h *Harness) AddRefundWorker() {
+	h.AddWorker(func(n *Node) mtg.Worker { return &refundWorker{grp: n.Group} })
+}
+
+// a user pays the group with the memo
+func (h *Harness) Transfer(sender, assetId, amount, memo string) *mtg.UnifiedOutput {
+	return h.Network.Transfer(sender, assetId, amount, memo, h.Members, h.Threshold)
+}
+
+// a single round of the Run loop for all nodes in order
+func (h *Harness) Step() {
+	for i := range h.Nodes {
+		h.StepNode(i)
+	}
+}
+
+func (h *Harness) StepNode(i int) {
+	h.Nodes[i].Group.RunOnce(h.ctx)
+}
+
+// step all nodes rounds times
+func (h *Harness) Steps(rounds int) {
+	for i := 0; i < rounds; i++ {
+		h.Step()
+	}
+}
+
+// step all nodes until the condition satisfied, at most rounds times
+func (h *Harness) RunUntil(rounds int, done func() bool) bool {
+	for i := 0; i < rounds; i++ {
+		if done() {
+			return true
+		}
+		h.Step()
+	}
+	return done()
+}
+
+// step all nodes until the transaction is in the state on all of them
+func (h *Harness) RunUntilState(rounds int, traceId string, state int) bool {
+	return h.RunUntil(rounds, func() bool {
+		for _, n := range h.Nodes {
+			tx, err := n.Store.ReadTransactionByTraceId(traceId)
+			require.Nil(h.t, err)
+			if tx == nil || tx.State != state {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (h *Harness) Balance(members []string, threshold int, assetId string) decimal.Decimal {
+	return h.Network.Balance(members, threshold, assetId)
+}
+
+func (h *Harness) GroupBalance(assetId string) decimal.Decimal {
+	return h.Network.Balance(h.Members, h.Threshold, assetId)
+}
+
+func (h *Harness) RequireBalance(members []string, threshold int, assetId, amount string) {
+	balance := h.Balance(members, threshold, assetId)
+	require.True(h.t, balance.Equal(decimal.RequireFromString(amount)), "balance %s %s", balance, amount)
+}
+
+// the transaction must be in the same state on all nodes
+func (h *Harness) RequireTransactionState(traceId string, state int) {
+	for _, n := range h.Nodes {
+		tx, err := n.Store.ReadTransactionByTraceId(traceId)
+		require.Nil(h.t, err)
+		require.NotNil(h.t, tx, "transaction %s not found on %s", traceId, n.Id)
+		require.Equal(h.t, state, tx.State, "transaction %s state on %s", traceId, n.Id)
+	}
+}
+
+// all nodes must build the same transactions, any difference means a
+// consensus bug in the workers or the group, the transactions drained from
+// network instead of built by workers are only compared by hash
+func (h *Harness) RequireConsensus() {
+	base := h.listTransactions(h.Nodes[0])
+	for _, n := range h.Nodes[1:] {
+		for id, other := range h.listTransactions(n) {
+			tx := base[id]
+			if tx == nil {
+				base[id] = other
+				continue
+			}
+			if tx.AssetId != "" && other.AssetId != "" {
+				require.Equal(h.t, tx.AssetId, other.AssetId, id)
+				require.Equal(h.t, tx.Receivers, other.Receivers, id)
+				require.Equal(h.t, tx.Threshold, other.Threshold, id)
+				require.Equal(h.t, tx.Amount, other.Amount, id)
+				require.Equal(h.t, tx.Memo, other.Memo, id)
+			}
+			if tx.State >= mtg.TransactionStateSigned && other.State >= mtg.TransactionStateSigned {
+				require.Equal(h.t, tx.Hash, other.Hash, id)
+			}
+		}
+	}
+}
+
+func (h *Harness) listTransactions(n *Node) map[string]*mtg.Transaction {
+	txs := make(map[string]*mtg.Transaction)
+	for _, state := range []int{
+		mtg.TransactionStateHeld,
+		mtg.TransactionStateInitial,
+		mtg.TransactionStateSigning,
+		mtg.TransactionStateSigned,
+		mtg.TransactionStateSnapshot,
+	} {
+		list, err := n.Store.ListTransactions(state, 0)
+		require.Nil(h.t, err)
+		for _, tx := range list {
+			txs[tx.TraceId] = tx
+		}
+	}
+	return txs
+}
+
+// the worker refunds all outputs to the sender with the trace id decided by
+// the output, so all nodes build the same transaction
+type refundWorker struct {
+	grp *mtg.Group
+}
+
+func (rw *refundWorker) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
+	receivers := []string{out.Sender}
+	traceId := mixin.UniqueConversationID(out.UTXOID, "refund")
+	err := rw.grp.BuildTransaction(ctx, out.AssetID, receivers, 1, out.Amount.String(), "refund", traceId, "")
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+func (rw *refundWorker) ProcessCollectibleOutput(ctx context.Context, out *mtg.CollectibleOutput) bool {
+	return false
+}
+
+func RefundWorkerTraceId(out *mtg.UnifiedOutput) string {
+	return mixin.UniqueConversationID(out.UnifiedUTXOID, "refund")
+}
@@ -0,0 +1,59 @@
+package mtgtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessRefund(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+
+	out := h.Transfer(DefaultSender, DefaultAssetId, "7.5", "hello")
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "7.5")
+
+	traceId := RefundWorkerTraceId(out)
+	done := h.RunUntilState(8, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.RequireTransactionState(traceId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "0")
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "7.5")
+}
+
+func TestGroupStop(t *testing.T) {
+	require := require.New(t)
+
+	h := NewHarness(t, 2, 2)
+	grp := h.Nodes[0].Group
+	go grp.Run(context.Background())
+	grp.Stop()
+	grp.Stop()
+	require.True(waitGroup(grp, 5*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	grp = h.Nodes[1].Group
+	go grp.Run(ctx)
+	cancel()
+	require.True(waitGroup(grp, 5*time.Second))
+}
+
+func waitGroup(grp *mtg.Group, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		grp.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
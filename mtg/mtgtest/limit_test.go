@@ -0,0 +1,68 @@
+package mtgtest
+
+import (
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessOutflowLimits(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddWorker(func(n *Node) mtg.Worker {
+		n.Group.SetOutflowLimits(&mtg.OutflowLimits{
+			PerTransaction: map[string]decimal.Decimal{DefaultAssetId: decimal.RequireFromString("5")},
+			PerReceiverDay: map[string]decimal.Decimal{DefaultAssetId: decimal.RequireFromString("8")},
+		})
+		return &refundWorker{grp: n.Group}
+	})
+
+	small := h.Transfer(DefaultSender, DefaultAssetId, "4", "hello")
+	large := h.Transfer(DefaultSender, DefaultAssetId, "7.5", "hello")
+	h.RunUntil(8, func() bool {
+		held, err := h.Nodes[0].Group.ListHeldTransactions()
+		require.Nil(err)
+		return len(held) == 1
+	})
+	h.Steps(3)
+	smallId := RefundWorkerTraceId(small)
+	largeId := RefundWorkerTraceId(large)
+	h.RequireTransactionState(smallId, mtg.TransactionStateSnapshot)
+	h.RequireTransactionState(largeId, mtg.TransactionStateHeld)
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "4")
+	for _, n := range h.Nodes {
+		held, err := n.Group.ListHeldTransactions()
+		require.Nil(err)
+		require.Len(held, 1)
+		require.Equal(largeId, held[0].TraceId)
+	}
+
+	// the approval from non members and the duplicated approvals are ignored
+	memo := mtg.EncodeApprovalMemo(largeId)
+	h.Transfer(DefaultSender, DefaultAssetId, "0.0001", memo)
+	h.Transfer(h.Members[0], DefaultAssetId, "0.0001", memo)
+	h.Transfer(h.Members[0], DefaultAssetId, "0.0001", memo)
+	h.Steps(3)
+	h.RequireTransactionState(largeId, mtg.TransactionStateHeld)
+	approvals, err := h.Nodes[2].Group.ReadApprovals(largeId)
+	require.Nil(err)
+	require.Equal([]string{h.Members[0]}, approvals)
+
+	h.Transfer(h.Members[1], DefaultAssetId, "0.0001", memo)
+	done := h.RunUntilState(8, largeId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+	h.RequireTransactionState(largeId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	// the approval from the DefaultSender is refunded by the worker
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "11.5001")
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "0.0003")
+
+	// the daily limit of the receiver is reached
+	third := h.Transfer(DefaultSender, DefaultAssetId, "1", "hello")
+	h.Steps(4)
+	h.RequireTransactionState(RefundWorkerTraceId(third), mtg.TransactionStateHeld)
+}
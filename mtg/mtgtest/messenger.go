@@ -0,0 +1,35 @@
+package mtgtest
+
+import (
+	"context"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+// the messenger delivers the messages to the receiver node immediately,
+// so the digest exchange is as deterministic as the steps
+type Messenger struct {
+	harness *Harness
+	sender  string
+}
+
+func (m *Messenger) QueueMessage(ctx context.Context, receiver string, b []byte) error {
+	for _, n := range m.harness.Nodes {
+		if n.Id != receiver {
+			continue
+		}
+		_, err := n.Group.HandleDigestMessage(ctx, m.sender, b)
+		return err
+	}
+	return nil
+}
+
+// all nodes exchange the digest checkpoints every rounds
+func (h *Harness) EnableDigestExchange(rounds uint64) {
+	for _, n := range h.Nodes {
+		m := &Messenger{harness: h, sender: n.Id}
+		err := n.Group.SetDigestExchange(&mtg.DigestExchange{Messenger: m, Rounds: rounds})
+		require.Nil(h.t, err)
+	}
+}
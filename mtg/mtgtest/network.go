@@ -0,0 +1,569 @@
+// Package mtgtest runs mtg groups against a local fake mixin network, so
+// that workers could be tested without any live mixin credentials.
+package mtgtest
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MixinNetwork/mixin/common"
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+)
+
+// the in memory mixin network shared by all nodes, it simulates the
+// multisig utxos, ghost keys, multisig requests and snapshots, all
+// timestamps are from a logical clock to make the groups deterministic
+type Network struct {
+	mutex    sync.Mutex
+	clock    time.Time
+	sequence uint64
+	pins     map[string]string
+	assets   map[crypto.Hash]string
+	keys     map[crypto.Key]string
+	outputs  []*utxo
+	requests map[string]*request
+	signers  map[crypto.Hash]map[string]bool
+	txs      map[crypto.Hash]*crypto.Hash
+}
+
+type utxo struct {
+	mtg.UnifiedOutput
+}
+
+type request struct {
+	id     string
+	user   string
+	action string
+	hash   crypto.Hash
+}
+
+type client struct {
+	network *Network
+	user    string
+}
+
+func NewNetwork(start time.Time) *Network {
+	return &Network{
+		clock:    start,
+		pins:     make(map[string]string),
+		assets:   make(map[crypto.Hash]string),
+		keys:     make(map[crypto.Key]string),
+		requests: make(map[string]*request),
+		signers:  make(map[crypto.Hash]map[string]bool),
+		txs:      make(map[crypto.Hash]*crypto.Hash),
+	}
+}
+
+// the network used by the group of the user, the pin is required to
+// sign or unlock multisig requests
+func (n *Network) Client(user, pin string) mtg.Network {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.pins[user] = pin
+	return &client{network: n, user: user}
+}
+
+// a user pays the amount to the members with the memo, the returned
+// output is the one that will be drained by the group
+func (n *Network) Transfer(sender, assetId, amount, memo string, members []string, threshold int) *mtg.UnifiedOutput {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.sequence += 1
+	seed := fmt.Sprintf("TRANSFER:%s:%s:%d", sender, assetId, n.sequence)
+	hash := crypto.NewHash([]byte(seed))
+	n.assets[crypto.NewHash([]byte(assetId))] = assetId
+	out := n.writeOutput(hash, 0, assetId, decimal.RequireFromString(amount), memo, sender, members, threshold)
+	return &out.UnifiedOutput
+}
+
+// the total unspent amount owned by the members with the threshold
+func (n *Network) Balance(members []string, threshold int, assetId string) decimal.Decimal {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	hash := hashMembers(members)
+	total := decimal.Zero
+	for _, out := range n.outputs {
+		if out.State == mixin.UTXOStateSpent || out.UnifiedAssetId != assetId {
+			continue
+		}
+		if int(out.UnifiedThreshold) != threshold || hashMembers(out.UnifiedMembers) != hash {
+			continue
+		}
+		total = total.Add(out.Amount)
+	}
+	return total
+}
+
+// all outputs of the members with the threshold, ordered by created time
+func (n *Network) ListOutputs(members []string, threshold int) []*mtg.UnifiedOutput {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	var outputs []*mtg.UnifiedOutput
+	hash := hashMembers(members)
+	for _, out := range n.outputs {
+		if int(out.UnifiedThreshold) != threshold || hashMembers(out.UnifiedMembers) != hash {
+			continue
+		}
+		o := out.UnifiedOutput
+		outputs = append(outputs, &o)
+	}
+	return outputs
+}
+
+// move the logical clock forward, e.g. to fire the timers
+func (n *Network) Advance(d time.Duration) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.clock = n.clock.Add(d)
+}
+
+func (n *Network) now() time.Time {
+	n.clock = n.clock.Add(time.Millisecond)
+	return n.clock
+}
+
+func (n *Network) writeOutput(hash crypto.Hash, index int, assetId string, amount decimal.Decimal, memo, sender string, members []string, threshold int) *utxo {
+	now := n.now()
+	out := &utxo{mtg.UnifiedOutput{
+		Type:             mtg.OutputTypeMultisig,
+		TransactionHash:  hash,
+		OutputIndex:      index,
+		Amount:           amount,
+		Memo:             memo,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+		State:            mixin.UTXOStateUnspent,
+		UnifiedUTXOID:    mixin.UniqueConversationID(hash.String(), fmt.Sprint(index)),
+		UnifiedAssetId:   assetId,
+		UnifiedThreshold: int64(threshold),
+		UnifiedMembers:   append([]string{}, members...),
+		UnifiedSender:    sender,
+	}}
+	n.outputs = append(n.outputs, out)
+	return out
+}
+
+func (n *Network) readOutput(hash crypto.Hash, index int) *utxo {
+	for _, out := range n.outputs {
+		if out.TransactionHash == hash && out.OutputIndex == index {
+			return out
+		}
+	}
+	return nil
+}
+
+func (n *Network) readInputs(ver *common.VersionedTransaction, user string) ([]*utxo, error) {
+	var inputs []*utxo
+	for _, in := range ver.Inputs {
+		out := n.readOutput(in.Hash, in.Index)
+		if out == nil {
+			return nil, fmt.Errorf("input not found %s:%d", in.Hash, in.Index)
+		}
+		if user != "" && !containsMember(out.UnifiedMembers, user) {
+			return nil, fmt.Errorf("input %s:%d not owned by %s", in.Hash, in.Index, user)
+		}
+		inputs = append(inputs, out)
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("empty inputs %s", ver.PayloadHash())
+	}
+	return inputs, nil
+}
+
+func (n *Network) verifyPin(user, pin string) error {
+	if p, found := n.pins[user]; !found || p != pin {
+		return fmt.Errorf("invalid pin %s", user)
+	}
+	return nil
+}
+
+func (c *client) VerifyPin(ctx context.Context, pin string) error {
+	c.network.mutex.Lock()
+	defer c.network.mutex.Unlock()
+
+	return c.network.verifyPin(c.user, pin)
+}
+
+func (c *client) ReadUnifiedOutputs(ctx context.Context, members []string, threshold uint8, offset time.Time, limit int, order string) ([]*mtg.UnifiedOutput, error) {
+	if threshold < 1 || int(threshold) > len(members) {
+		return nil, fmt.Errorf("invalid members %v %d", members, threshold)
+	}
+	if !containsMember(members, c.user) {
+		return nil, fmt.Errorf("user %s not belongs to members %v", c.user, members)
+	}
+
+	c.network.mutex.Lock()
+	defer c.network.mutex.Unlock()
+
+	orderTime := func(out *utxo) time.Time {
+		if order == "updated" {
+			return out.UpdatedAt
+		}
+		return out.CreatedAt
+	}
+	hash := hashMembers(members)
+	var filtered []*utxo
+	for _, out := range c.network.outputs {
+		if int(out.UnifiedThreshold) != int(threshold) || hashMembers(out.UnifiedMembers) != hash {
+			continue
+		}
+		if orderTime(out).Before(offset) {
+			continue
+		}
+		filtered = append(filtered, out)
+	}
+	sort.SliceStable(filtered, func(i, j int) bool { return orderTime(filtered[i]).Before(orderTime(filtered[j])) })
+	if limit > 0 && len(filtered) > limit {
+		filtered = filtered[:limit]
+	}
+
+	outputs := make([]*mtg.UnifiedOutput, len(filtered))
+	for i, out := range filtered {
+		o := out.UnifiedOutput
+		o.UserId = c.user
+		o.UnifiedMembers = append([]string{}, out.UnifiedMembers...)
+		outputs[i] = &o
+	}
+	return outputs, nil
+}
+
+// the ghost keys are derived from the hint and receivers, and recorded by
+// the network to know the receivers of the transaction outputs
+func (c *client) BatchReadGhostKeys(ctx context.Context, inputs []*mixin.GhostInput) ([]*mixin.GhostKeys, error) {
+	c.network.mutex.Lock()
+	defer c.network.mutex.Unlock()
+
+	var keys []*mixin.GhostKeys
+	for _, in := range inputs {
+		if len(in.Receivers) == 0 {
+			return nil, fmt.Errorf("empty receivers %s", in.Hint)
+		}
+		seed := fmt.Sprintf("GHOST:%s:%d", in.Hint, in.Index)
+		gk := &mixin.GhostKeys{Mask: mixin.Key(crypto.NewHash([]byte(seed + ":MASK")))}
+		for _, r := range in.Receivers {
+			k := crypto.Key(crypto.NewHash([]byte(seed + ":" + r)))
+			c.network.keys[k] = r
+			gk.Keys = append(gk.Keys, mixin.Key(k))
+		}
+		keys = append(keys, gk)
+	}
+	return keys, nil
+}
+
+func (c *client) CreateMultisig(ctx context.Context, action, raw string) (*mixin.MultisigRequest, error) {
+	ver, err := decodeTransaction(raw)
+	if err != nil {
+		return nil, err
+	}
+	hash := ver.PayloadHash()
+
+	c.network.mutex.Lock()
+	defer c.network.mutex.Unlock()
+
+	inputs, err := c.network.readInputs(ver, c.user)
+	if err != nil {
+		return nil, err
+	}
+	switch action {
+	case mixin.MultisigActionSign:
+		for _, out := range inputs {
+			if out.State == mixin.UTXOStateSpent {
+				return nil, fmt.Errorf("input %s spent by %s", out.UnifiedUTXOID, out.SignedBy)
+			}
+			if out.SignedBy != "" && out.SignedBy != hash.String() {
+				return nil, fmt.Errorf("input %s signed by %s", out.UnifiedUTXOID, out.SignedBy)
+			}
+		}
+		now := c.network.now()
+		for _, out := range inputs {
+			if out.SignedBy == hash.String() {
+				continue
+			}
+			out.State = mixin.UTXOStateSigned
+			out.SignedBy = hash.String()
+			out.SignedTx = raw
+			out.UpdatedAt = now
+		}
+	case mixin.MultisigActionUnlock:
+		for _, out := range inputs {
+			if out.SignedBy != hash.String() {
+				return nil, fmt.Errorf("input %s not signed by %s", out.UnifiedUTXOID, hash)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid multisig action %s", action)
+	}
+
+	req := &request{
+		id:     mixin.UniqueConversationID(c.user, action+":"+hash.String()),
+		user:   c.user,
+		action: action,
+		hash:   hash,
+	}
+	c.network.requests[req.id] = req
+	return c.network.buildMultisigRequest(req, inputs), nil
+}
+
+// the signatures are only filled after the threshold reached, so the
+// group will see a partially signed transaction without signatures
+func (c *client) SignMultisig(ctx context.Context, reqID, pin string) (*mixin.MultisigRequest, error) {
+	c.network.mutex.Lock()
+	defer c.network.mutex.Unlock()
+
+	err := c.network.verifyPin(c.user, pin)
+	if err != nil {
+		return nil, err
+	}
+	req := c.network.requests[reqID]
+	if req == nil || req.user != c.user || req.action != mixin.MultisigActionSign {
+		return nil, fmt.Errorf("invalid multisig request %s", reqID)
+	}
+	inputs, err := c.network.readMultisigInputs(req)
+	if err != nil {
+		return nil, err
+	}
+
+	signers := c.network.signers[req.hash]
+	if signers == nil {
+		signers = make(map[string]bool)
+		c.network.signers[req.hash] = signers
+	}
+	signers[c.user] = true
+
+	ver, _ := decodeTransaction(inputs[0].SignedTx)
+	threshold := int(inputs[0].UnifiedThreshold)
+	if len(signers) >= threshold && len(ver.SignaturesMap) == 0 {
+		for _, out := range inputs {
+			ver.SignaturesMap = append(ver.SignaturesMap, buildSignatures(out, signers, req.hash))
+		}
+		raw := hex.EncodeToString(ver.Marshal())
+		now := c.network.now()
+		for _, out := range inputs {
+			out.SignedTx = raw
+			out.UpdatedAt = now
+		}
+	}
+	return c.network.buildMultisigRequest(req, inputs), nil
+}
+
+func (c *client) UnlockMultisig(ctx context.Context, reqID, pin string) error {
+	c.network.mutex.Lock()
+	defer c.network.mutex.Unlock()
+
+	err := c.network.verifyPin(c.user, pin)
+	if err != nil {
+		return err
+	}
+	req := c.network.requests[reqID]
+	if req == nil || req.user != c.user || req.action != mixin.MultisigActionUnlock {
+		return fmt.Errorf("invalid multisig request %s", reqID)
+	}
+	inputs, err := c.network.readMultisigInputs(req)
+	if err != nil {
+		return err
+	}
+	now := c.network.now()
+	for _, out := range inputs {
+		out.State = mixin.UTXOStateUnspent
+		out.SignedBy = ""
+		out.SignedTx = ""
+		out.UpdatedAt = now
+	}
+	delete(c.network.signers, req.hash)
+	return nil
+}
+
+func (c *client) CreateCollectibleRequest(ctx context.Context, action, raw string) (*mixin.CollectibleRequest, error) {
+	return nil, fmt.Errorf("collectible not supported by the test network")
+}
+
+func (c *client) SignCollectibleRequest(ctx context.Context, reqID, pin string) (*mixin.CollectibleRequest, error) {
+	return nil, fmt.Errorf("collectible not supported by the test network")
+}
+
+// the transaction outputs are written back to the network, and the
+// outputs to the recorded ghost keys are readable by their receivers
+func (c *client) SendRawTransaction(ctx context.Context, raw string) (*mixin.Hash, error) {
+	ver, err := decodeTransaction(raw)
+	if err != nil {
+		return nil, err
+	}
+	hash := ver.PayloadHash()
+
+	c.network.mutex.Lock()
+	defer c.network.mutex.Unlock()
+
+	if c.network.txs[hash] != nil {
+		h := mixin.Hash(hash)
+		return &h, nil
+	}
+	if len(ver.SignaturesMap) != len(ver.Inputs) {
+		return nil, fmt.Errorf("unsigned transaction %s", hash)
+	}
+	inputs, err := c.network.readInputs(ver, "")
+	if err != nil {
+		return nil, err
+	}
+	for i, out := range inputs {
+		if out.State == mixin.UTXOStateSpent || out.SignedBy != hash.String() {
+			return nil, fmt.Errorf("input %s not signed by %s", out.UnifiedUTXOID, hash)
+		}
+		if len(ver.SignaturesMap[i]) < int(out.UnifiedThreshold) {
+			return nil, fmt.Errorf("insufficient signatures %s %d", hash, len(ver.SignaturesMap[i]))
+		}
+	}
+	assetId, found := c.network.assets[ver.Asset]
+	if !found {
+		return nil, fmt.Errorf("asset not found %s", ver.Asset)
+	}
+
+	var receivers [][]string
+	var total common.Integer
+	for _, out := range ver.Outputs {
+		var members []string
+		for _, k := range out.Keys {
+			r, found := c.network.keys[*k]
+			if !found {
+				return nil, fmt.Errorf("ghost key not found %s", k)
+			}
+			members = append(members, r)
+		}
+		receivers = append(receivers, members)
+		total = total.Add(out.Amount)
+	}
+	var sum common.Integer
+	for _, out := range inputs {
+		sum = sum.Add(common.NewIntegerFromString(out.Amount.String()))
+	}
+	if sum.Cmp(total) != 0 {
+		return nil, fmt.Errorf("invalid transaction amount %s %s", sum, total)
+	}
+
+	now := c.network.now()
+	for _, out := range inputs {
+		out.State = mixin.UTXOStateSpent
+		out.SignedTx = raw
+		out.UpdatedAt = now
+	}
+	for i, out := range ver.Outputs {
+		amount := decimal.RequireFromString(out.Amount.String())
+		c.network.writeOutput(hash, i, assetId, amount, string(ver.Extra), "", receivers[i], int(out.Script[2]))
+	}
+	snapshot := crypto.NewHash([]byte("SNAPSHOT:" + hash.String()))
+	c.network.txs[hash] = &snapshot
+	h := mixin.Hash(hash)
+	return &h, nil
+}
+
+func (c *client) GetRawTransaction(ctx context.Context, hash mixin.Hash) (*mixin.Transaction, error) {
+	c.network.mutex.Lock()
+	defer c.network.mutex.Unlock()
+
+	tx := &mixin.Transaction{Hash: &hash}
+	if s := c.network.txs[crypto.Hash(hash)]; s != nil {
+		snapshot := mixin.Hash(*s)
+		tx.Snapshot = &snapshot
+	}
+	return tx, nil
+}
+
+func (n *Network) readMultisigInputs(req *request) ([]*utxo, error) {
+	var inputs []*utxo
+	for _, out := range n.outputs {
+		if out.SignedBy == req.hash.String() {
+			inputs = append(inputs, out)
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, fmt.Errorf("multisig request %s expired", req.id)
+	}
+	for _, out := range inputs {
+		if out.State == mixin.UTXOStateSpent {
+			return nil, fmt.Errorf("multisig request %s spent", req.id)
+		}
+	}
+	ver, err := decodeTransaction(inputs[0].SignedTx)
+	if err != nil {
+		return nil, err
+	}
+	return n.readInputs(ver, req.user)
+}
+
+func (n *Network) buildMultisigRequest(req *request, inputs []*utxo) *mixin.MultisigRequest {
+	var signers []string
+	for s := range n.signers[req.hash] {
+		signers = append(signers, s)
+	}
+	sort.Strings(signers)
+	state := mixin.MultisigStateInitial
+	ver, _ := decodeTransaction(inputs[0].SignedTx)
+	if ver != nil && len(ver.SignaturesMap) > 0 {
+		state = mixin.MultisigStateSigned
+	}
+	return &mixin.MultisigRequest{
+		Type:            "multisig_request",
+		RequestID:       req.id,
+		UserID:          req.user,
+		AssetID:         inputs[0].UnifiedAssetId,
+		Threshold:       uint8(inputs[0].UnifiedThreshold),
+		Senders:         inputs[0].UnifiedMembers,
+		Signers:         signers,
+		Action:          req.action,
+		State:           state,
+		TransactionHash: mixin.Hash(req.hash),
+		RawTransaction:  inputs[0].SignedTx,
+		CreatedAt:       inputs[0].UpdatedAt,
+		UpdatedAt:       inputs[0].UpdatedAt,
+	}
+}
+
+// fake signatures indexed by the signer position in the sorted members
+func buildSignatures(out *utxo, signers map[string]bool, hash crypto.Hash) map[uint16]*crypto.Signature {
+	members := append([]string{}, out.UnifiedMembers...)
+	sort.Strings(members)
+	sigs := make(map[uint16]*crypto.Signature)
+	for i, m := range members {
+		if !signers[m] {
+			continue
+		}
+		var sig crypto.Signature
+		h := crypto.NewHash([]byte(m + ":" + hash.String()))
+		copy(sig[:], h[:])
+		copy(sig[32:], h[:])
+		sigs[uint16(i)] = &sig
+	}
+	return sigs
+}
+
+func decodeTransaction(raw string) (*common.VersionedTransaction, error) {
+	b, err := hex.DecodeString(raw)
+	if err != nil {
+		return nil, err
+	}
+	return common.UnmarshalVersionedTransaction(b)
+}
+
+func containsMember(members []string, id string) bool {
+	for _, m := range members {
+		if m == id {
+			return true
+		}
+	}
+	return false
+}
+
+func hashMembers(members []string) string {
+	return mixin.HashMembers(append([]string{}, members...))
+}
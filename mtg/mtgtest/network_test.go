@@ -0,0 +1,110 @@
+package mtgtest
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/mixin/common"
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkMultisig(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	members := []string{
+		"0f8f5d4c-2a4e-4a2b-9f1f-55a3b7b3e001",
+		"0f8f5d4c-2a4e-4a2b-9f1f-55a3b7b3e002",
+		"0f8f5d4c-2a4e-4a2b-9f1f-55a3b7b3e003",
+	}
+	receiver := "0f8f5d4c-2a4e-4a2b-9f1f-55a3b7b3e004"
+
+	n := NewNetwork(time.Unix(1700000000, 0))
+	var clients []*client
+	for _, m := range members {
+		c := n.Client(m, "123456").(*client)
+		require.Nil(c.VerifyPin(ctx, "123456"))
+		require.NotNil(c.VerifyPin(ctx, "654321"))
+		clients = append(clients, c)
+	}
+	n.Transfer(receiver, DefaultAssetId, "1.5", "hello", members, 2)
+	require.Equal("1.5", n.Balance(members, 2, DefaultAssetId).String())
+
+	outputs, err := clients[0].ReadUnifiedOutputs(ctx, members, 2, time.Time{}, 10, "created")
+	require.Nil(err)
+	require.Len(outputs, 1)
+	require.Equal(members[0], outputs[0].UserId)
+	require.Equal(mixin.UTXOStateUnspent, outputs[0].State)
+
+	keys, err := clients[0].BatchReadGhostKeys(ctx, []*mixin.GhostInput{{
+		Receivers: []string{receiver},
+		Index:     0,
+		Hint:      "hint",
+	}, {
+		Receivers: members,
+		Index:     1,
+		Hint:      "hint",
+	}})
+	require.Nil(err)
+	require.Len(keys, 2)
+
+	ver := common.NewTransactionV4(crypto.NewHash([]byte(DefaultAssetId)))
+	ver.AddInput(outputs[0].TransactionHash, outputs[0].OutputIndex)
+	out := keys[0].DumpOutput(1, decimal.RequireFromString("1"))
+	ver.Outputs = append(ver.Outputs, newCommonOutput(out))
+	out = keys[1].DumpOutput(2, decimal.RequireFromString("0.5"))
+	ver.Outputs = append(ver.Outputs, newCommonOutput(out))
+	raw := hex.EncodeToString(ver.AsVersioned().Marshal())
+
+	_, err = clients[0].SendRawTransaction(ctx, raw)
+	require.NotNil(err)
+
+	req, err := clients[0].CreateMultisig(ctx, mixin.MultisigActionSign, raw)
+	require.Nil(err)
+	req, err = clients[0].SignMultisig(ctx, req.RequestID, "123456")
+	require.Nil(err)
+	require.Equal(mixin.MultisigStateInitial, req.State)
+	req, err = clients[1].CreateMultisig(ctx, mixin.MultisigActionSign, raw)
+	require.Nil(err)
+	req, err = clients[1].SignMultisig(ctx, req.RequestID, "123456")
+	require.Nil(err)
+	require.Equal(mixin.MultisigStateSigned, req.State)
+
+	signed, err := decodeTransaction(req.RawTransaction)
+	require.Nil(err)
+	require.Len(signed.SignaturesMap, 1)
+	require.Len(signed.SignaturesMap[0], 2)
+
+	h, err := clients[2].SendRawTransaction(ctx, req.RawTransaction)
+	require.Nil(err)
+	tx, err := clients[2].GetRawTransaction(ctx, *h)
+	require.Nil(err)
+	require.True(tx.Snapshot.HasValue())
+
+	require.Equal("0.5", n.Balance(members, 2, DefaultAssetId).String())
+	require.Equal("1", n.Balance([]string{receiver}, 1, DefaultAssetId).String())
+	outputs, err = clients[2].ReadUnifiedOutputs(ctx, members, 2, time.Time{}, 10, "updated")
+	require.Nil(err)
+	require.Len(outputs, 2)
+	require.Equal(mixin.UTXOStateSpent, outputs[0].State)
+	require.Equal(mixin.UTXOStateUnspent, outputs[1].State)
+}
+
+func newCommonOutput(out *mixin.Output) *common.Output {
+	cout := &common.Output{
+		Type:   common.OutputTypeScript,
+		Amount: common.NewIntegerFromString(out.Amount.String()),
+		Script: common.Script(out.Script),
+		Mask:   crypto.Key(out.Mask),
+	}
+	for _, k := range out.Keys {
+		ck := crypto.Key(k)
+		cout.Keys = append(cout.Keys, &ck)
+	}
+	return cout
+}
@@ -0,0 +1,51 @@
+package mtgtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+type refusePolicy struct{}
+
+func (p *refusePolicy) CheckRequest(ctx context.Context, req *mtg.SigningRequest) error {
+	return fmt.Errorf("refused %s", req.Raw.PayloadHash())
+}
+
+func TestHarnessSigningPolicy(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+	var alerts []*mtg.Error
+	for _, n := range h.Nodes[1:] {
+		n.Group.SetSigningPolicy(&refusePolicy{})
+		n.Group.SetErrorHandler(func(ctx context.Context, err *mtg.Error) bool {
+			if err.Kind == mtg.ErrorKindPolicy {
+				alerts = append(alerts, err)
+			}
+			return mtg.DefaultErrorHandler(ctx, err)
+		})
+	}
+
+	out := h.Transfer(DefaultSender, DefaultAssetId, "7.5", "hello")
+	traceId := RefundWorkerTraceId(out)
+	h.Steps(4)
+
+	// only one member signs, so the refund is never sent
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "7.5")
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "0")
+	tx, err := h.Nodes[0].Store.ReadTransactionByTraceId(traceId)
+	require.Nil(err)
+	require.Equal(mtg.TransactionStateSigning, tx.State)
+	for _, n := range h.Nodes[1:] {
+		tx, err := n.Store.ReadTransactionByTraceId(traceId)
+		require.Nil(err)
+		require.Equal(mtg.TransactionStateInitial, tx.State)
+	}
+	require.Len(alerts, 8)
+	require.Contains(alerts[0].Error(), "refused")
+}
@@ -0,0 +1,64 @@
+package mtgtest
+
+import (
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessQuery(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddWorker(func(n *Node) mtg.Worker { return &helloWorker{refundWorker{grp: n.Group}} })
+
+	h.Transfer(DefaultSender, DefaultAssetId, "1", "keep")
+	h.Transfer(DefaultSender, DefaultAssetId, "2", "keep")
+	out := h.Transfer(DefaultSender, DefaultAssetId, "0.5", "hello")
+	traceId := RefundWorkerTraceId(out)
+	grp := h.Nodes[0].Group
+
+	h.StepNode(0)
+	b, err := grp.ReadBalance("", DefaultAssetId)
+	require.Nil(err)
+	require.Equal("0.5", b.Pending.String())
+	require.Equal("3.5", b.Balance.Add(b.Locked).String())
+
+	done := h.RunUntilState(12, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	b, err = grp.ReadBalance("", DefaultAssetId)
+	require.Nil(err)
+	require.Equal("3", b.Balance.String())
+	require.Equal("0", b.Locked.String())
+	require.Equal("0", b.Pending.String())
+
+	// the refund spends all outputs, and the pages are in the same order
+	all, err := grp.ListOutputsForAsset("", DefaultAssetId, mixin.UTXOStateSpent, 0)
+	require.Nil(err)
+	require.Len(all, 3)
+	var cursor string
+	for i := 0; ; i++ {
+		outputs, next, err := grp.ListOutputs("", DefaultAssetId, mixin.UTXOStateSpent, cursor, 1)
+		require.Nil(err)
+		if next == "" {
+			require.Len(outputs, 0)
+			require.Len(all, i)
+			break
+		}
+		require.Len(outputs, 1)
+		require.Equal(all[i].UTXOID, outputs[0].UTXOID)
+		cursor = next
+	}
+
+	txs, cursor, err := grp.ListTransactions("", mtg.TransactionStateSnapshot, "", 10)
+	require.Nil(err)
+	require.Len(txs, 1)
+	require.Equal(traceId, txs[0].TraceId)
+	require.Equal("", cursor)
+	_, _, err = grp.ListTransactions("", mtg.TransactionStateSnapshot, "invalid", 10)
+	require.Equal(mtg.ErrorKindInput, mtg.ErrorKindOf(err))
+	_, _, err = grp.ListOutputs("", DefaultAssetId, mixin.UTXOStateUnspent, "", 0)
+	require.Equal(mtg.ErrorKindInput, mtg.ErrorKindOf(err))
+}
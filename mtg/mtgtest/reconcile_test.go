@@ -0,0 +1,79 @@
+package mtgtest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessReconcile(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddWorker(func(n *Node) mtg.Worker { return &helloWorker{refundWorker{grp: n.Group}} })
+
+	h.Transfer(DefaultSender, DefaultAssetId, "1", "keep")
+	h.Transfer(DefaultSender, DefaultAssetId, "2", "keep")
+	out := h.Transfer(DefaultSender, DefaultAssetId, "0.5", "hello")
+	traceId := RefundWorkerTraceId(out)
+	grp := h.Nodes[0].Group
+
+	h.StepNode(0)
+	r, err := grp.Reconcile()
+	require.Nil(err)
+	require.Len(r.Statements, 1)
+	s := r.Statements[0]
+	require.Equal("3.5", s.Inflow.String())
+	require.Equal("0", s.Outflow.String())
+	require.Equal("0.5", s.Pending.String())
+	require.False(s.Overspent)
+
+	done := h.RunUntilState(12, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+
+	var createdAt time.Time
+	for i, n := range h.Nodes {
+		r, err = n.Group.Reconcile()
+		require.Nil(err)
+		now, err := n.Group.ConsensusNow()
+		require.Nil(err)
+		require.Equal(now, r.CreatedAt)
+		if i > 0 {
+			require.Equal(createdAt, r.CreatedAt)
+		}
+		createdAt = r.CreatedAt
+		require.Len(r.Statements, 1)
+		s = r.Statements[0]
+		require.Equal("", s.GroupId)
+		require.Equal(DefaultAssetId, s.AssetId)
+		require.Equal("3.5", s.Inflow.String())
+		require.Equal("0.5", s.Outflow.String())
+		require.Equal("3", s.Change.String())
+		require.Equal("0", s.Fees.String())
+		require.Equal("0", s.Pending.String())
+		require.Equal("3", s.Balance.String())
+		require.True(s.Reconciled)
+		require.Len(r.Overspent(), 0)
+	}
+
+	var buf bytes.Buffer
+	require.Nil(r.WriteCSV(&buf))
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.Nil(err)
+	require.Len(rows, 2)
+	require.Equal("group_id", rows[0][0])
+	require.Equal([]string{"", DefaultAssetId, "3.5", "0.5", "3", "0", "0", "0", "3", "false", "true"}, rows[1])
+
+	buf.Reset()
+	require.Nil(r.WriteJSON(&buf))
+	var decoded mtg.Reconciliation
+	require.Nil(json.Unmarshal(buf.Bytes(), &decoded))
+	require.Len(decoded.Statements, 1)
+	require.True(decoded.Statements[0].Outflow.Equal(s.Outflow))
+}
@@ -0,0 +1,59 @@
+package mtgtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// the worker only handles the outputs with the memo hello
+type helloWorker struct {
+	refundWorker
+}
+
+func (hw *helloWorker) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
+	if out.Memo != "hello" {
+		return false
+	}
+	return hw.refundWorker.ProcessOutput(ctx, out)
+}
+
+func TestHarnessRefundPolicy(t *testing.T) {
+	require := require.New(t)
+
+	otherId := "965e5c6e-434c-3fa9-b780-c50f43cd955c"
+	h := NewDefaultHarness(t)
+	h.AddWorker(func(n *Node) mtg.Worker {
+		n.Group.SetRefundPolicy(&mtg.RefundPolicy{
+			Minimums: map[string]decimal.Decimal{DefaultAssetId: decimal.RequireFromString("1")},
+		})
+		return &helloWorker{refundWorker{grp: n.Group}}
+	})
+
+	handled := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	unhandled := h.Transfer(DefaultSender, DefaultAssetId, "2", "mistake")
+	small := h.Transfer(DefaultSender, DefaultAssetId, "0.5", "mistake")
+	other := h.Transfer(DefaultSender, otherId, "4", "mistake")
+	refundId := mtg.RefundTraceId(unhandled.UnifiedUTXOID)
+	done := h.RunUntilState(12, refundId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+	h.RequireTransactionState(refundId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+
+	for _, out := range []*mtg.UnifiedOutput{handled, small, other} {
+		tx, err := h.Nodes[0].Store.ReadTransactionByTraceId(mtg.RefundTraceId(out.UnifiedUTXOID))
+		require.Nil(err)
+		require.Nil(tx)
+	}
+	tx, err := h.Nodes[1].Store.ReadTransactionByTraceId(refundId)
+	require.Nil(err)
+	require.Equal(mtg.RefundTransactionMemo, tx.Memo)
+	require.Equal([]string{DefaultSender}, tx.Receivers)
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "5")
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "0.5")
+	h.RequireBalance(h.Members, h.Threshold, otherId, "4")
+}
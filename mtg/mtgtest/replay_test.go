@@ -0,0 +1,119 @@
+package mtgtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/MixinNetwork/trusted-group/mtg/store"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// the new version refunds a fee less
+type feeWorker struct {
+	refundWorker
+}
+
+func (fw *feeWorker) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
+	receivers := []string{out.Sender}
+	traceId := mixin.UniqueConversationID(out.UTXOID, "refund")
+	amount := out.Amount.Sub(out.Amount.Div(decimal.NewFromInt(100)))
+	err := fw.grp.BuildTransaction(ctx, out.AssetID, receivers, 1, amount.String(), "refund", traceId, "")
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+func TestHarnessReplay(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+
+	var traces []string
+	for _, memo := range []string{"hello", "bug", "hello"} {
+		out := h.Transfer(DefaultSender, DefaultAssetId, "3", memo)
+		traces = append(traces, RefundWorkerTraceId(out))
+	}
+	done := h.RunUntilState(12, traces[2], mtg.TransactionStateSnapshot)
+	require.True(done)
+
+	replay := func(build func(grp *mtg.Group) mtg.Worker) *mtg.ReplayReport {
+		scratch, err := store.OpenMemoryBadger(context.Background())
+		require.Nil(err)
+		defer scratch.Close()
+		n := h.Nodes[0]
+		report, err := mtg.Replay(context.Background(), n.Store, scratch, n.Conf, build)
+		require.Nil(err)
+		require.Equal(3, report.Actions)
+		return report
+	}
+
+	report := replay(func(grp *mtg.Group) mtg.Worker { return &refundWorker{grp: grp} })
+	require.Equal(3, report.Transactions)
+	require.Len(report.Diffs, 0)
+	require.Equal(0, report.Skipped)
+	require.Equal(0, report.Collectibles)
+
+	// the transactions built by the group and the collectibles are not
+	// replayed, they are counted instead of reported as extra or missing
+	n := h.Nodes[0]
+	now := h.Network.now()
+	for _, memo := range []string{mtg.CompactionTransactionMemo, mtg.EvolutionTransactionMemo} {
+		err := n.Store.WriteTransaction(&mtg.Transaction{
+			TraceId:   mixin.UniqueConversationID(memo, "replay"),
+			State:     mtg.TransactionStateInitial,
+			AssetId:   DefaultAssetId,
+			Receivers: n.Conf.Genesis.Members,
+			Threshold: n.Conf.Genesis.Threshold,
+			Amount:    "1",
+			Memo:      memo,
+			UpdatedAt: now,
+			CreatedAt: now,
+		})
+		require.Nil(err)
+	}
+	collectible := mixin.UniqueConversationID("collectible", "replay")
+	err := n.Store.WriteCollectibleTransaction(collectible, &mtg.CollectibleTransaction{
+		TraceId:   collectible,
+		State:     mtg.TransactionStateInitial,
+		Receivers: []string{DefaultSender},
+		Threshold: 1,
+		Amount:    "1",
+		UpdatedAt: now,
+	})
+	require.Nil(err)
+	report = replay(func(grp *mtg.Group) mtg.Worker { return &refundWorker{grp: grp} })
+	require.Equal(3, report.Transactions)
+	require.Len(report.Diffs, 0)
+	require.Equal(2, report.Skipped)
+	require.Equal(1, report.Collectibles)
+
+	report = replay(func(grp *mtg.Group) mtg.Worker { return &buggyWorker{refundWorker{grp: grp}} })
+	require.Equal(2, report.Transactions)
+	require.Len(report.Diffs, 1)
+	require.Equal(traces[1], report.Diffs[0].TraceId)
+	require.Equal(mtg.ReplayDiffMissing, report.Diffs[0].Kind)
+	require.Equal("3", report.Diffs[0].Expected.Amount)
+
+	// the canceled replay returns instead of handling the actions forever
+	scratch, err := store.OpenMemoryBadger(context.Background())
+	require.Nil(err)
+	defer scratch.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = mtg.Replay(ctx, n.Store, scratch, n.Conf, func(grp *mtg.Group) mtg.Worker { return &refundWorker{grp: grp} })
+	require.NotNil(err)
+	require.Contains(err.Error(), "interrupted")
+
+	report = replay(func(grp *mtg.Group) mtg.Worker { return &feeWorker{refundWorker{grp: grp}} })
+	require.Equal(3, report.Transactions)
+	require.Len(report.Diffs, 3)
+	for _, d := range report.Diffs {
+		require.Equal(mtg.ReplayDiffDifferent, d.Kind)
+		require.Equal("amount 3 2.97", d.Reason)
+	}
+}
@@ -0,0 +1,63 @@
+package mtgtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+// pay the fixed amount to the DefaultSender, and keep all other outputs
+type payWorker struct {
+	grp *mtg.Group
+}
+
+func (pw *payWorker) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
+	if out.Memo != "pay" {
+		return true
+	}
+	traceId := mixin.UniqueConversationID(out.UTXOID, "pay")
+	err := pw.grp.BuildTransaction(ctx, out.AssetID, []string{out.Sender}, 1, "3", "pay", traceId, "")
+	if err != nil {
+		panic(err)
+	}
+	return true
+}
+
+func (pw *payWorker) ProcessCollectibleOutput(ctx context.Context, out *mtg.CollectibleOutput) bool {
+	return false
+}
+
+func TestHarnessCoinSelector(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddWorker(func(n *Node) mtg.Worker {
+		n.Group.SetCoinSelector(&mtg.MinimizeChangeSelector{})
+		return &payWorker{grp: n.Group}
+	})
+
+	h.Transfer(DefaultSender, DefaultAssetId, "5", "deposit")
+	h.Transfer(DefaultSender, DefaultAssetId, "2", "deposit")
+	h.Transfer(DefaultSender, DefaultAssetId, "1", "deposit")
+	out := h.Transfer(DefaultSender, DefaultAssetId, "0.1", "pay")
+
+	traceId := mixin.UniqueConversationID(out.UnifiedUTXOID, "pay")
+	done := h.RunUntilState(8, traceId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.RequireTransactionState(traceId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance(h.Members, h.Threshold, DefaultAssetId, "5.1")
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "3")
+
+	// the 2 and 1 outputs are spent exactly without change
+	var unspent []string
+	for _, o := range h.Network.ListOutputs(h.Members, h.Threshold) {
+		if o.State == mixin.UTXOStateUnspent {
+			unspent = append(unspent, o.Amount.String())
+		}
+	}
+	require.Equal([]string{"5", "0.1"}, unspent)
+}
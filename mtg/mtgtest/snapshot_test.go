@@ -0,0 +1,194 @@
+package mtgtest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/MixinNetwork/trusted-group/mtg/store"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHarnessSnapshot(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+
+	first := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	firstId := RefundWorkerTraceId(first)
+	done := h.RunUntilState(12, firstId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Step()
+
+	keys := make(map[string]string)
+	privs := make(map[string]ed25519.PrivateKey)
+	for _, n := range h.Nodes {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		require.Nil(err)
+		keys[n.Id], privs[n.Id] = hex.EncodeToString(pub), priv
+	}
+
+	snap, err := h.Nodes[0].Group.ExportSnapshot()
+	require.Nil(err)
+	require.Nil(h.Nodes[0].Group.SignSnapshot(snap, privs[h.Nodes[0].Id]))
+	conf := *h.Nodes[2].Conf
+	conf.Snapshot.Keys = keys
+	require.NotNil(mtg.VerifySnapshot(snap, &conf))
+
+	// the tampered snapshot is not signed by other members
+	tampered, err := mtg.UnmarshalSnapshot(snap.Marshal())
+	require.Nil(err)
+	tampered.Outputs[0].Output.Amount = tampered.Outputs[0].Output.Amount.Add(tampered.Outputs[0].Output.Amount)
+	require.NotNil(h.Nodes[1].Group.SignSnapshot(tampered, privs[h.Nodes[1].Id]))
+
+	require.Nil(h.Nodes[1].Group.SignSnapshot(snap, privs[h.Nodes[1].Id]))
+	require.Nil(mtg.VerifySnapshot(snap, &conf))
+
+	// the node 2 is replaced by a new node booted from the snapshot
+	path := filepath.Join(t.TempDir(), "snapshot.dat")
+	require.Nil(os.WriteFile(path, snap.Marshal(), 0600))
+	conf.Snapshot.Path = path
+	db, err := store.OpenMemoryBadger(ctx)
+	require.Nil(err)
+	t.Cleanup(func() { db.Close() })
+	grp, err := mtg.BuildGroupWithNetwork(ctx, db, &conf, h.Network.Client(conf.App.ClientId, nodePIN))
+	require.Nil(err)
+	n := &Node{Id: conf.App.ClientId, Conf: &conf, Group: grp, Store: db}
+	grp.AddWorker(&refundWorker{grp: grp})
+	h.Nodes[2] = n
+
+	tx, err := db.ReadTransactionByTraceId(firstId)
+	require.Nil(err)
+	require.Equal(mtg.TransactionStateSnapshot, tx.State)
+	digest, err := grp.VerifyAuditLog()
+	require.Nil(err)
+	expected, err := h.Nodes[0].Group.AuditDigest()
+	require.Nil(err)
+	require.Equal(expected, digest)
+
+	second := h.Transfer(DefaultSender, DefaultAssetId, "2", "hello")
+	secondId := RefundWorkerTraceId(second)
+	done = h.RunUntil(12, func() bool {
+		tx, err := db.ReadTransactionByTraceId(secondId)
+		require.Nil(err)
+		return tx != nil && tx.State == mtg.TransactionStateSnapshot
+	})
+	require.True(done)
+	h.Steps(3)
+	h.RequireTransactionState(secondId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "5")
+}
+
+// the worker records the outputs passed to it
+type countingWorker struct {
+	refundWorker
+	seen map[string]int
+}
+
+func (cw *countingWorker) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
+	cw.seen[out.UTXOID]++
+	return cw.refundWorker.ProcessOutput(ctx, out)
+}
+
+func TestHarnessSnapshotRestore(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+
+	first := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	done := h.RunUntilState(12, RefundWorkerTraceId(first), mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Step()
+
+	// the checkpoints exported before the outputs are handled, so all
+	// outputs are drained again after imported
+	snap, err := h.Nodes[0].Group.ExportSnapshot()
+	require.Nil(err)
+	var props []*mtg.SnapshotProperty
+	for _, p := range snap.Properties {
+		if !strings.HasPrefix(p.Key, "outputs-draining-checkpoint") {
+			props = append(props, p)
+		}
+	}
+	require.Less(len(props), len(snap.Properties))
+	snap.Properties = props
+	var handled int
+	for _, act := range snap.Actions {
+		if act.State == mtg.ActionStateDone {
+			handled++
+		}
+	}
+	require.Equal(1, handled)
+
+	keys := make(map[string]string)
+	for _, n := range h.Nodes[:2] {
+		pub, priv, err := ed25519.GenerateKey(nil)
+		require.Nil(err)
+		keys[n.Id] = hex.EncodeToString(pub)
+		require.Nil(n.Group.SignSnapshot(snap, priv))
+	}
+	conf := *h.Nodes[2].Conf
+	conf.Snapshot.Keys = keys
+	path := filepath.Join(t.TempDir(), "snapshot.dat")
+	require.Nil(os.WriteFile(path, snap.Marshal(), 0600))
+	conf.Snapshot.Path = path
+	db, err := store.OpenMemoryBadger(ctx)
+	require.Nil(err)
+	t.Cleanup(func() { db.Close() })
+	grp, err := mtg.BuildGroupWithNetwork(ctx, db, &conf, h.Network.Client(conf.App.ClientId, nodePIN))
+	require.Nil(err)
+	cw := &countingWorker{refundWorker: refundWorker{grp: grp}, seen: make(map[string]int)}
+	grp.AddWorker(cw)
+	h.Nodes[2] = &Node{Id: conf.App.ClientId, Conf: &conf, Group: grp, Store: db}
+
+	// the restored node never passes the outputs handled to the workers
+	second := h.Transfer(DefaultSender, DefaultAssetId, "2", "hello")
+	done = h.RunUntilState(12, RefundWorkerTraceId(second), mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+	h.RequireConsensus()
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "5")
+	require.Equal(map[string]int{second.UnifiedUTXOID: 1}, cw.seen)
+}
+
+func TestHarnessSnapshotCollectibles(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+	first := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	done := h.RunUntilState(12, RefundWorkerTraceId(first), mtg.TransactionStateSnapshot)
+	require.True(done)
+
+	n := h.Nodes[0]
+	_, err := n.Group.ExportSnapshot()
+	require.Nil(err)
+
+	// only the multisig outputs are exported, so the group with any
+	// collectible transaction is refused
+	traceId := mixin.UniqueConversationID("collectible", "snapshot")
+	err = n.Store.WriteCollectibleTransaction(traceId, &mtg.CollectibleTransaction{
+		TraceId:   traceId,
+		State:     mtg.TransactionStateInitial,
+		Receivers: []string{DefaultSender},
+		Threshold: 1,
+		Amount:    "1",
+		UpdatedAt: h.Network.now(),
+	})
+	require.Nil(err)
+	_, err = n.Group.ExportSnapshot()
+	require.NotNil(err)
+	require.Equal(mtg.ErrorKindInput, mtg.ErrorKindOf(err))
+	require.Contains(err.Error(), "collectibles not exported")
+}
@@ -0,0 +1,77 @@
+package mtgtest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/stretchr/testify/require"
+)
+
+type offlineNetwork struct {
+	mtg.Network
+	offline bool
+}
+
+func (n *offlineNetwork) ReadUnifiedOutputs(ctx context.Context, members []string, threshold uint8, offset time.Time, limit int, order string) ([]*mtg.UnifiedOutput, error) {
+	if n.offline {
+		return nil, fmt.Errorf("network offline")
+	}
+	return n.Network.ReadUnifiedOutputs(ctx, members, threshold, offset, limit, order)
+}
+
+func TestHarnessStatus(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	h := NewDefaultHarness(t)
+	h.AddRefundWorker()
+
+	status, err := h.Nodes[0].Group.Status(ctx)
+	require.Nil(err)
+	require.False(status.Synced)
+	require.Equal(0, status.PendingActions)
+	require.Len(status.Stages, 0)
+
+	out := h.Transfer(DefaultSender, DefaultAssetId, "3", "hello")
+	traceId := RefundWorkerTraceId(out)
+	h.Step()
+	status, err = h.Nodes[0].Group.Status(ctx)
+	require.Nil(err)
+	require.True(status.Synced)
+	require.Equal(1, status.Transactions[mtg.TransactionStateSigning]+status.Transactions[mtg.TransactionStateInitial])
+	require.Equal(0, status.Transactions[mtg.TransactionStateSnapshot])
+
+	h.RunUntilState(12, traceId, mtg.TransactionStateSnapshot)
+	status, err = h.Nodes[0].Group.Status(ctx)
+	require.Nil(err)
+	require.Equal(1, status.Transactions[mtg.TransactionStateSnapshot])
+	require.Equal(0, status.PendingActions)
+	require.Equal(status.Draining.NetworkHead, status.Draining.Updated)
+	require.False(status.Stages["handleActionsQueue"].SucceededAt.IsZero())
+	require.Equal("", status.Stages["drainOutputsFromNetwork"].Error)
+
+	// the network error is recorded and the group continues
+	n := h.Nodes[0]
+	network := &offlineNetwork{Network: h.Network.Client(n.Id, nodePIN), offline: true}
+	grp, err := mtg.BuildGroupWithNetwork(ctx, n.Store, n.Conf, network)
+	require.Nil(err)
+	grp.SetRetryPolicy(&mtg.RetryPolicy{MaxAttempts: 1})
+	grp.RunOnce(ctx)
+	status, err = grp.Status(ctx)
+	require.Nil(err)
+	drain := status.Stages["drainOutputsFromNetwork"]
+	require.True(drain.SucceededAt.IsZero())
+	require.False(drain.FailedAt.IsZero())
+	require.Contains(drain.Error, "network offline")
+
+	network.offline = false
+	grp.RunOnce(ctx)
+	status, err = grp.Status(ctx)
+	require.Nil(err)
+	drain = status.Stages["drainOutputsFromNetwork"]
+	require.False(drain.SucceededAt.Before(drain.FailedAt))
+	require.True(status.Synced)
+}
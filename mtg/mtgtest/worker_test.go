@@ -0,0 +1,130 @@
+package mtgtest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+// the worker asks to retry the output with the retry suffix once
+type routeWorker struct {
+	grp     *mtg.Group
+	name    string
+	seen    []string
+	retried map[string]bool
+}
+
+func (rw *routeWorker) HandleOutput(ctx context.Context, out *mtg.Output) *mtg.WorkerResult {
+	rw.seen = append(rw.seen, out.Memo)
+	if strings.HasSuffix(out.Memo, ":fatal") {
+		return mtg.Fatal(fmt.Errorf("invalid memo %s", out.Memo))
+	}
+	if strings.HasSuffix(out.Memo, ":retry") && !rw.retried[out.UTXOID] {
+		rw.retried[out.UTXOID] = true
+		return mtg.RetryAfter(time.Minute)
+	}
+	traceId := mixin.UniqueConversationID(out.UTXOID, rw.name)
+	err := rw.grp.BuildTransaction(ctx, out.AssetID, []string{out.Sender}, 1, out.Amount.String(), rw.name, traceId, "")
+	if err != nil {
+		return mtg.Fatal(err)
+	}
+	return mtg.Handled()
+}
+
+func (rw *routeWorker) HandleCollectibleOutput(ctx context.Context, out *mtg.CollectibleOutput) *mtg.WorkerResult {
+	return mtg.Skipped()
+}
+
+func TestHarnessWorkerResults(t *testing.T) {
+	require := require.New(t)
+
+	h := NewDefaultHarness(t)
+	var workers []*routeWorker
+	for _, n := range h.Nodes {
+		a := &routeWorker{grp: n.Group, name: "a", retried: make(map[string]bool)}
+		b := &routeWorker{grp: n.Group, name: "b", retried: make(map[string]bool)}
+		n.Group.AddTypedWorker(a, &mtg.WorkerRoute{MemoPrefix: "a:"})
+		n.Group.AddTypedWorker(b, nil)
+		workers = append(workers, a, b)
+	}
+
+	first := h.Transfer(DefaultSender, DefaultAssetId, "3", "a:retry")
+	second := h.Transfer(DefaultSender, DefaultAssetId, "2", "b")
+	firstId := mixin.UniqueConversationID(first.UnifiedUTXOID, "a")
+	secondId := mixin.UniqueConversationID(second.UnifiedUTXOID, "b")
+
+	// the action after the retried one is not blocked, and the retried
+	// action is kept initial with the time not before
+	h.Step()
+	for _, n := range h.Nodes {
+		tx, err := n.Store.ReadTransactionByTraceId(firstId)
+		require.Nil(err)
+		require.Nil(tx)
+		tx, err = n.Store.ReadTransactionByTraceId(secondId)
+		require.Nil(err)
+		require.NotNil(tx)
+		status, err := n.Group.Status(context.Background())
+		require.Nil(err)
+		require.Equal(1, status.PendingActions)
+		timers, err := n.Group.ListTimers()
+		require.Nil(err)
+		require.Len(timers, 0)
+	}
+
+	// the retry survives the restart, and waits for the outputs drained
+	// after the time not before, instead of the local time
+	n := h.Restart(0)
+	workers[0] = &routeWorker{grp: n.Group, name: "a", retried: map[string]bool{first.UnifiedUTXOID: true}}
+	workers[1] = &routeWorker{grp: n.Group, name: "b", retried: make(map[string]bool)}
+	n.Group.AddTypedWorker(workers[0], &mtg.WorkerRoute{MemoPrefix: "a:"})
+	n.Group.AddTypedWorker(workers[1], nil)
+	h.Network.Advance(10 * time.Minute)
+	h.Steps(3)
+	for _, n := range h.Nodes {
+		tx, err := n.Store.ReadTransactionByTraceId(firstId)
+		require.Nil(err)
+		require.Nil(tx)
+	}
+	third := h.Transfer(DefaultSender, DefaultAssetId, "1", "b:third")
+	thirdId := mixin.UniqueConversationID(third.UnifiedUTXOID, "b")
+	done := h.RunUntilState(12, thirdId, mtg.TransactionStateSnapshot)
+	require.True(done)
+	h.Steps(3)
+	h.RequireTransactionState(firstId, mtg.TransactionStateSnapshot)
+	h.RequireTransactionState(secondId, mtg.TransactionStateSnapshot)
+	h.RequireConsensus()
+	h.RequireBalance([]string{DefaultSender}, 1, DefaultAssetId, "6")
+	require.Equal([]string{"a:retry"}, workers[0].seen)
+	require.Equal([]string{"b:third"}, workers[1].seen)
+	for i := 2; i < len(workers); i += 2 {
+		require.Equal([]string{"a:retry", "a:retry"}, workers[i].seen)
+		require.Equal([]string{"b", "b:third"}, workers[i+1].seen)
+	}
+	for _, n := range h.Nodes {
+		tx, err := n.Store.ReadTransactionByTraceId(firstId)
+		require.Nil(err)
+		third, err := n.Store.ReadTransactionByTraceId(thirdId)
+		require.Nil(err)
+		require.True(first.CreatedAt.Add(time.Minute).Equal(tx.CreatedAt))
+		require.True(tx.CreatedAt.Before(third.CreatedAt))
+		status, err := n.Group.Status(context.Background())
+		require.Nil(err)
+		require.Equal(0, status.PendingActions)
+	}
+
+	// the fatal result stops the group and keeps the action
+	h.Transfer(DefaultSender, DefaultAssetId, "1", "a:fatal")
+	h.StepNode(0)
+	status, err := h.Nodes[0].Group.Status(context.Background())
+	require.Nil(err)
+	require.Equal(1, status.PendingActions)
+	require.Contains(status.Stages["handleActionsQueue"].Error, "invalid memo a:fatal")
+	h.StepNode(0)
+	require.Equal([]string{"a:retry", "a:fatal"}, workers[0].seen)
+}
@@ -0,0 +1,61 @@
+package mtg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go"
+)
+
+// all the mixin api used by the group, the mixin client is the default
+// network, and a local fake network could be used to run groups in tests
+type Network interface {
+	VerifyPin(ctx context.Context, pin string) error
+
+	ReadUnifiedOutputs(ctx context.Context, members []string, threshold uint8, offset time.Time, limit int, order string) ([]*UnifiedOutput, error)
+	BatchReadGhostKeys(ctx context.Context, inputs []*mixin.GhostInput) ([]*mixin.GhostKeys, error)
+
+	CreateMultisig(ctx context.Context, action, raw string) (*mixin.MultisigRequest, error)
+	SignMultisig(ctx context.Context, reqID, pin string) (*mixin.MultisigRequest, error)
+	UnlockMultisig(ctx context.Context, reqID, pin string) error
+
+	CreateCollectibleRequest(ctx context.Context, action, raw string) (*mixin.CollectibleRequest, error)
+	SignCollectibleRequest(ctx context.Context, reqID, pin string) (*mixin.CollectibleRequest, error)
+
+	SendRawTransaction(ctx context.Context, raw string) (*mixin.Hash, error)
+	GetRawTransaction(ctx context.Context, hash mixin.Hash) (*mixin.Transaction, error)
+}
+
+type mixinNetwork struct {
+	*mixin.Client
+}
+
+func NewMixinNetwork(client *mixin.Client) Network {
+	return &mixinNetwork{Client: client}
+}
+
+func (mn *mixinNetwork) ReadUnifiedOutputs(ctx context.Context, members []string, threshold uint8, offset time.Time, limit int, order string) ([]*UnifiedOutput, error) {
+	params := make(map[string]string)
+	if !offset.IsZero() {
+		params["offset"] = offset.UTC().Format(time.RFC3339Nano)
+	}
+	if limit > 0 {
+		params["limit"] = fmt.Sprint(limit)
+	}
+	if order == outputsOrderCreated || order == outputsOrderUpdated {
+		params["order"] = order
+	}
+	if threshold < 1 || int(threshold) > len(members) {
+		return nil, fmt.Errorf("invalid members %v %d", members, threshold)
+	}
+	params["members"] = hashMembers(members)
+	params["threshold"] = fmt.Sprint(threshold)
+
+	var outputs []*UnifiedOutput
+	err := mn.Get(ctx, "/outputs", params, &outputs)
+	if err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
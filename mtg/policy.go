@@ -0,0 +1,155 @@
+package mtg
+
+import (
+	"context"
+	"encoding/hex"
+
+	"github.com/MixinNetwork/mixin/common"
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/fox-one/mixin-sdk-go"
+)
+
+// the request to sign or unlock a raw kernel transaction, the transaction
+// is the local record of the raw, which may be nil for unlock requests
+type SigningRequest struct {
+	Action      string
+	Raw         *common.VersionedTransaction
+	Transaction *Transaction
+	Outputs     []*Output
+	Change      *Epoch
+}
+
+// the policy is consulted before every sign or unlock, and the node refuses
+// the request if it returns an error, the refusal is reported to the error
+// handler as a policy error
+type SigningPolicy interface {
+	CheckRequest(ctx context.Context, req *SigningRequest) error
+}
+
+// the default policy only signs the raw derived by the node itself from the
+// local transaction record, and never unlocks the raw the node is signing
+type LocalSigningPolicy struct{}
+
+func (p *LocalSigningPolicy) CheckRequest(ctx context.Context, req *SigningRequest) error {
+	switch req.Action {
+	case mixin.MultisigActionSign:
+		return p.checkSign(req)
+	case mixin.MultisigActionUnlock:
+		return p.checkUnlock(req)
+	}
+	return newPolicyError("LocalSigningPolicy", "invalid action %s", req.Action)
+}
+
+func (p *LocalSigningPolicy) checkSign(req *SigningRequest) error {
+	ver, tx := req.Raw, req.Transaction
+	if tx == nil {
+		return newPolicyError("LocalSigningPolicy", "no local transaction %s", ver.PayloadHash())
+	}
+	if ver.Asset != crypto.NewHash([]byte(tx.AssetId)) {
+		return newPolicyError("LocalSigningPolicy", "invalid asset %s %s", tx.TraceId, ver.Asset)
+	}
+	if string(ver.Extra) != encodeMixinExtra(tx.GroupId, tx.TraceId, tx.Memo) {
+		return newPolicyError("LocalSigningPolicy", "invalid extra %s %s", tx.TraceId, hex.EncodeToString(ver.Extra))
+	}
+	if ver.Version >= common.TxVersionReferences && !equalReferences(ver.References, tx.References) {
+		return newPolicyError("LocalSigningPolicy", "invalid references %s %v", tx.TraceId, ver.References)
+	}
+
+	if len(ver.Inputs) != len(req.Outputs) {
+		return newPolicyError("LocalSigningPolicy", "invalid inputs count %s %d %d", tx.TraceId, len(ver.Inputs), len(req.Outputs))
+	}
+	var total common.Integer
+	for i, in := range ver.Inputs {
+		out := req.Outputs[i]
+		if in.Hash != out.TransactionHash || in.Index != out.OutputIndex {
+			return newPolicyError("LocalSigningPolicy", "invalid input %s %s:%d", tx.TraceId, in.Hash, in.Index)
+		}
+		if out.AssetID != tx.AssetId || out.GroupId != tx.GroupId {
+			return newPolicyError("LocalSigningPolicy", "invalid input output %s %s", tx.TraceId, out.UTXOID)
+		}
+		total = total.Add(common.NewIntegerFromString(out.Amount.String()))
+	}
+
+	entries := tx.outputEntries()
+	if len(ver.Outputs) != len(entries) && len(ver.Outputs) != len(entries)+1 {
+		return newPolicyError("LocalSigningPolicy", "invalid outputs count %s %d", tx.TraceId, len(ver.Outputs))
+	}
+	for i, en := range entries {
+		out := ver.Outputs[i]
+		if !checkRawOutput(out, len(en.Receivers), en.Threshold, common.NewIntegerFromString(en.Amount)) {
+			return newPolicyError("LocalSigningPolicy", "invalid output %s %d", tx.TraceId, i)
+		}
+	}
+	change := total.Sub(common.NewIntegerFromString(tx.Amount))
+	if len(ver.Outputs) == len(entries) {
+		if change.Sign() != 0 {
+			return newPolicyError("LocalSigningPolicy", "invalid change %s %s", tx.TraceId, change)
+		}
+		return nil
+	}
+	out := ver.Outputs[len(entries)]
+	if req.Change == nil || !checkRawOutput(out, len(req.Change.Members), req.Change.Threshold, change) {
+		return newPolicyError("LocalSigningPolicy", "invalid change output %s", tx.TraceId)
+	}
+	return nil
+}
+
+func (p *LocalSigningPolicy) checkUnlock(req *SigningRequest) error {
+	ver, tx := req.Raw, req.Transaction
+	if tx != nil && tx.State >= TransactionStateSigning && tx.Hash == ver.PayloadHash() {
+		return newPolicyError("LocalSigningPolicy", "unlock local transaction %s %s", tx.TraceId, tx.Hash)
+	}
+	for _, out := range req.Outputs {
+		var found bool
+		for _, in := range ver.Inputs {
+			found = found || (in.Hash == out.TransactionHash && in.Index == out.OutputIndex)
+		}
+		if !found {
+			return newPolicyError("LocalSigningPolicy", "unlock unrelated output %s %s", ver.PayloadHash(), out.UTXOID)
+		}
+	}
+	return nil
+}
+
+func checkRawOutput(out *common.Output, keys, threshold int, amount common.Integer) bool {
+	return out.Type == common.OutputTypeScript && len(out.Keys) == keys &&
+		out.Script.String() == common.NewThresholdScript(uint8(threshold)).String() &&
+		out.Amount.Cmp(amount) == 0
+}
+
+func equalReferences(a, b []crypto.Hash) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (grp *Group) SetSigningPolicy(p SigningPolicy) {
+	grp.signingPolicy = p
+}
+
+func (grp *Group) checkSigningRequest(ctx context.Context, req *SigningRequest) error {
+	if grp.signingPolicy == nil {
+		return nil
+	}
+	err := grp.signingPolicy.CheckRequest(ctx, req)
+	if err != nil && ErrorKindOf(err) == 0 {
+		err = &Error{Kind: ErrorKindPolicy, Op: "SigningPolicy.CheckRequest", Err: err}
+	}
+	return err
+}
+
+// the raw in the multisig request must be the same as the checked one,
+// because the network could return another raw to sign
+func checkRequestedRaw(ver *common.VersionedTransaction, requested string) error {
+	rv, _ := decodeTransactionWithExtra(requested)
+	if rv == nil || rv.PayloadHash() != ver.PayloadHash() {
+		return newPolicyError("Group.checkRequestedRaw", "invalid requested raw %s %s", ver.PayloadHash(), requested)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package mtg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/mixin/common"
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalSigningPolicy(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	policy := &LocalSigningPolicy{}
+
+	members := []string{
+		"0f8f5d4c-2a4e-4a2b-9f1f-55a3b7b3e001",
+		"0f8f5d4c-2a4e-4a2b-9f1f-55a3b7b3e002",
+		"0f8f5d4c-2a4e-4a2b-9f1f-55a3b7b3e003",
+	}
+	change := &Epoch{Members: members, Threshold: 2, CreatedAt: time.Unix(1600000000, 0)}
+	tx := &Transaction{
+		GroupId:   "group",
+		TraceId:   "35ff8f8c-c5b4-4e3c-9a3a-7f2b8d1e5a10",
+		State:     TransactionStateInitial,
+		AssetId:   "c6d0c728-2624-429b-8e0d-d9d19b6592fa",
+		Receivers: []string{"e8e8a0d2-51d5-4a4d-a5b5-8f9a0f3c6a11"},
+		Threshold: 1,
+		Amount:    "3",
+		Memo:      "pay",
+	}
+	outputs := []*Output{{
+		UTXOID:          "utxo-0",
+		AssetID:         tx.AssetId,
+		GroupId:         tx.GroupId,
+		TransactionHash: crypto.NewHash([]byte("utxo-0")),
+		OutputIndex:     1,
+		Amount:          decimal.RequireFromString("5"),
+	}}
+
+	build := func() *common.VersionedTransaction {
+		ver := common.NewTransactionV4(crypto.NewHash([]byte(tx.AssetId)))
+		ver.Extra = []byte(encodeMixinExtra(tx.GroupId, tx.TraceId, tx.Memo))
+		ver.AddInput(outputs[0].TransactionHash, outputs[0].OutputIndex)
+		ver.Outputs = append(ver.Outputs, testRawOutput(1, 1, "3"))
+		ver.Outputs = append(ver.Outputs, testRawOutput(3, 2, "2"))
+		return ver.AsVersioned()
+	}
+	check := func(ver *common.VersionedTransaction) error {
+		return policy.CheckRequest(ctx, &SigningRequest{
+			Action:      mixin.MultisigActionSign,
+			Raw:         ver,
+			Transaction: tx,
+			Outputs:     outputs,
+			Change:      change,
+		})
+	}
+
+	require.Nil(check(build()))
+
+	ver := build()
+	ver.Outputs[0].Amount = common.NewIntegerFromString("4")
+	require.Equal(ErrorKindPolicy, ErrorKindOf(check(ver)))
+	ver = build()
+	ver.Outputs[1].Amount = common.NewIntegerFromString("1")
+	require.Equal(ErrorKindPolicy, ErrorKindOf(check(ver)))
+	ver = build()
+	ver.Outputs[1].Script = common.NewThresholdScript(1)
+	require.Equal(ErrorKindPolicy, ErrorKindOf(check(ver)))
+	ver = build()
+	ver.Outputs = append(ver.Outputs, testRawOutput(1, 1, "0.1"))
+	require.Equal(ErrorKindPolicy, ErrorKindOf(check(ver)))
+	ver = build()
+	ver.Extra = []byte(encodeMixinExtra(tx.GroupId, tx.TraceId, "other"))
+	require.Equal(ErrorKindPolicy, ErrorKindOf(check(ver)))
+	ver = build()
+	ver.Asset = crypto.NewHash([]byte("other"))
+	require.Equal(ErrorKindPolicy, ErrorKindOf(check(ver)))
+	ver = build()
+	ver.Inputs[0].Index = 0
+	require.Equal(ErrorKindPolicy, ErrorKindOf(check(ver)))
+
+	err := policy.CheckRequest(ctx, &SigningRequest{Action: mixin.MultisigActionSign, Raw: build()})
+	require.Equal(ErrorKindPolicy, ErrorKindOf(err))
+
+	ver = build()
+	unlock := &SigningRequest{Action: mixin.MultisigActionUnlock, Raw: ver, Outputs: outputs}
+	require.Nil(policy.CheckRequest(ctx, unlock))
+	unlock.Transaction = &Transaction{TraceId: tx.TraceId, State: TransactionStateSigning, Hash: ver.PayloadHash()}
+	require.Equal(ErrorKindPolicy, ErrorKindOf(policy.CheckRequest(ctx, unlock)))
+	unlock.Transaction = nil
+	unlock.Outputs = []*Output{{UTXOID: "utxo-1", TransactionHash: crypto.NewHash([]byte("utxo-1"))}}
+	require.Equal(ErrorKindPolicy, ErrorKindOf(policy.CheckRequest(ctx, unlock)))
+}
+
+func testRawOutput(keys, threshold int, amount string) *common.Output {
+	out := &common.Output{
+		Type:   common.OutputTypeScript,
+		Amount: common.NewIntegerFromString(amount),
+		Script: common.NewThresholdScript(uint8(threshold)),
+	}
+	for i := 0; i < keys; i++ {
+		k := crypto.Key(crypto.NewHash([]byte{byte(i)}))
+		out.Keys = append(out.Keys, &k)
+	}
+	return out
+}
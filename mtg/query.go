@@ -0,0 +1,109 @@
+package mtg
+
+import (
+	"errors"
+
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	QueryPageLimit = 500
+)
+
+// the totals of a group id and asset, the unspent outputs are the balance,
+// the signed outputs are locked by the transactions signing, and the pending
+// is the amount of the transactions not yet snapshot
+type Balance struct {
+	GroupId string
+	AssetId string
+	Balance decimal.Decimal
+	Locked  decimal.Decimal
+	Pending decimal.Decimal
+}
+
+func (grp *Group) ReadTransaction(traceId string) (*Transaction, error) {
+	tx, err := grp.store.ReadTransactionByTraceId(traceId)
+	return tx, newStoreError("Group.ReadTransactionByTraceId", err)
+}
+
+// list the transactions of the state by the updated time, an empty group id
+// lists all group ids, and the next cursor is empty at the last page
+func (grp *Group) ListTransactions(groupId string, state int, cursor string, limit int) ([]*Transaction, string, error) {
+	if limit <= 0 || limit > QueryPageLimit {
+		return nil, "", newInputError("Group.ListTransactions", "invalid limit %d", limit)
+	}
+	qs, ok := grp.store.(QueryStore)
+	if !ok {
+		return nil, "", newStoreError("Group.ListTransactionsAfter", errStoreCapability(grp.store, "QueryStore"))
+	}
+	txs, next, err := qs.ListTransactionsAfter(groupId, state, cursor, limit)
+	if errors.Is(err, ErrInvalidCursor) {
+		return nil, "", newInputError("Group.ListTransactions", "invalid cursor %s", cursor)
+	}
+	return txs, next, newStoreError("Group.ListTransactionsAfter", err)
+}
+
+// list the outputs of the group id and asset by the created time, and the
+// next cursor is empty at the last page
+func (grp *Group) ListOutputs(groupId, assetId, state string, cursor string, limit int) ([]*Output, string, error) {
+	if limit <= 0 || limit > QueryPageLimit {
+		return nil, "", newInputError("Group.ListOutputs", "invalid limit %d", limit)
+	}
+	qs, ok := grp.store.(QueryStore)
+	if !ok {
+		return nil, "", newStoreError("Group.ListOutputsForAssetAfter", errStoreCapability(grp.store, "QueryStore"))
+	}
+	outputs, next, err := qs.ListOutputsForAssetAfter(groupId, state, assetId, cursor, limit)
+	if errors.Is(err, ErrInvalidCursor) {
+		return nil, "", newInputError("Group.ListOutputs", "invalid cursor %s", cursor)
+	}
+	return outputs, next, newStoreError("Group.ListOutputsForAssetAfter", err)
+}
+
+// the pending transactions are listed by the asset index, so the balance
+// reads only the outputs and transactions of the group id and asset
+func (grp *Group) ReadBalance(groupId, assetId string) (*Balance, error) {
+	qs, ok := grp.store.(QueryStore)
+	if !ok {
+		return nil, newStoreError("Group.ReadBalance", errStoreCapability(grp.store, "QueryStore"))
+	}
+	b := &Balance{GroupId: groupId, AssetId: assetId}
+	for _, state := range []string{mixin.UTXOStateUnspent, mixin.UTXOStateSigned} {
+		var cursor string
+		for {
+			outputs, next, err := qs.ListOutputsForAssetAfter(groupId, state, assetId, cursor, QueryPageLimit)
+			if err != nil {
+				return nil, newStoreError("Group.ListOutputsForAssetAfter", err)
+			}
+			for _, out := range outputs {
+				if state == mixin.UTXOStateUnspent {
+					b.Balance = b.Balance.Add(out.Amount)
+				} else {
+					b.Locked = b.Locked.Add(out.Amount)
+				}
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+	for _, state := range []int{TransactionStateHeld, TransactionStateInitial, TransactionStateSigning, TransactionStateSigned} {
+		var cursor string
+		for {
+			txs, next, err := qs.ListTransactionsForAssetAfter(groupId, assetId, state, cursor, QueryPageLimit)
+			if err != nil {
+				return nil, newStoreError("Group.ListTransactionsForAssetAfter", err)
+			}
+			for _, tx := range txs {
+				b.Pending = b.Pending.Add(decimal.RequireFromString(tx.Amount))
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+	return b, nil
+}
@@ -0,0 +1,62 @@
+package mtg
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+type testQueryStore struct {
+	*testPropertyStore
+	err error
+}
+
+func (s *testQueryStore) ListOutputsForAssetAfter(groupId, state, assetId string, cursor string, limit int) ([]*Output, string, error) {
+	return nil, "", s.err
+}
+
+func (s *testQueryStore) ListOutputsForStateAfter(state string, cursor string, limit int) ([]*Output, string, error) {
+	return nil, "", s.err
+}
+
+func (s *testQueryStore) ListTransactionsAfter(groupId string, state int, cursor string, limit int) ([]*Transaction, string, error) {
+	return nil, "", s.err
+}
+
+func (s *testQueryStore) ListTransactionsForAssetAfter(groupId, assetId string, state int, cursor string, limit int) ([]*Transaction, string, error) {
+	return nil, "", s.err
+}
+
+func TestQueryErrors(t *testing.T) {
+	require := require.New(t)
+
+	grp := &Group{store: newTestPropertyStore()}
+	_, _, err := grp.ListTransactions("", TransactionStateInitial, "", 10)
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+	_, err = grp.ReadBalance("", StorageAssetId)
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+
+	qs := &testQueryStore{testPropertyStore: newTestPropertyStore()}
+	grp = &Group{store: qs}
+	qs.err = fmt.Errorf("%w %s", ErrInvalidCursor, "cursor")
+	_, _, err = grp.ListTransactions("", TransactionStateInitial, "cursor", 10)
+	require.Equal(ErrorKindInput, ErrorKindOf(err))
+	_, _, err = grp.ListOutputs("", StorageAssetId, mixin.UTXOStateUnspent, "cursor", 10)
+	require.Equal(ErrorKindInput, ErrorKindOf(err))
+
+	qs.err = errors.New("store")
+	_, _, err = grp.ListTransactions("", TransactionStateInitial, "", 10)
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+	_, _, err = grp.ListOutputs("", StorageAssetId, mixin.UTXOStateUnspent, "", 10)
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+	_, err = grp.ReadBalance("", StorageAssetId)
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+
+	qs.err = nil
+	b, err := grp.ReadBalance("", StorageAssetId)
+	require.Nil(err)
+	require.True(b.Pending.IsZero())
+}
@@ -0,0 +1,225 @@
+package mtg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/shopspring/decimal"
+)
+
+// the statement of a group id and asset. the inflow is the outputs paid to
+// the group, the outflow is the amount of the transactions spent, and the
+// change is the outputs returned to the group by them. the compaction and
+// evolution transactions only move the outputs inside the group, so they
+// are only recorded in the compaction. the fees are the inputs spent minus
+// the amount and change, and the pending is the amount of the transactions
+// not spent yet. the balance is the outputs not spent, which should be the
+// inflow minus the outflow and fees after all outputs drained.
+type Statement struct {
+	GroupId    string          `json:"group_id"`
+	AssetId    string          `json:"asset_id"`
+	Inflow     decimal.Decimal `json:"inflow"`
+	Outflow    decimal.Decimal `json:"outflow"`
+	Change     decimal.Decimal `json:"change"`
+	Compaction decimal.Decimal `json:"compaction"`
+	Fees       decimal.Decimal `json:"fees"`
+	Pending    decimal.Decimal `json:"pending"`
+	Balance    decimal.Decimal `json:"balance"`
+	Overspent  bool            `json:"overspent"`
+	Reconciled bool            `json:"reconciled"`
+}
+
+type Reconciliation struct {
+	CreatedAt  time.Time    `json:"created_at"`
+	Statements []*Statement `json:"statements"`
+}
+
+type reconcileKey struct {
+	groupId string
+	assetId string
+}
+
+// the transaction listed for the statements, and the inputs signed by it
+// are summed from the outputs listed, so the entries and raw are not kept
+type reconcileTransaction struct {
+	groupId    string
+	assetId    string
+	amount     decimal.Decimal
+	internal   bool
+	change     decimal.Decimal
+	inputs     int
+	unspent    int
+	total      decimal.Decimal
+	inputAsset string
+}
+
+// compute the statements of all group ids and assets from the outputs and
+// transactions in the store, the overspent group ids spend more than the
+// inflow, including the pending transactions. the transactions and outputs
+// are listed by pages, and the time is the consensus time of the last
+// action handled, so all members reconcile the same statements
+func (grp *Group) Reconcile() (*Reconciliation, error) {
+	qs, ok := grp.store.(QueryStore)
+	if !ok {
+		return nil, newStoreError("Group.Reconcile", errStoreCapability(grp.store, "QueryStore"))
+	}
+	createdAt, err := grp.ConsensusNow()
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*reconcileTransaction
+	hashes := make(map[string]*reconcileTransaction)
+	for _, state := range []int{TransactionStateHeld, TransactionStateInitial, TransactionStateSigning, TransactionStateSigned, TransactionStateSnapshot} {
+		var cursor string
+		for {
+			list, next, err := qs.ListTransactionsAfter("", state, cursor, QueryPageLimit)
+			if err != nil {
+				return nil, newStoreError("Group.ListTransactionsAfter", err)
+			}
+			for _, tx := range list {
+				rt := &reconcileTransaction{groupId: tx.GroupId, assetId: tx.AssetId, internal: isInternalTransaction(tx)}
+				// the transaction drained before built by this node has no details
+				if tx.AssetId != "" {
+					rt.amount = decimal.RequireFromString(tx.Amount)
+				}
+				txs = append(txs, rt)
+				if tx.Hash.HasValue() {
+					hashes[tx.Hash.String()] = rt
+				}
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+
+	statements := make(map[reconcileKey]*Statement)
+	statement := func(groupId, assetId string) *Statement {
+		k := reconcileKey{groupId, assetId}
+		if statements[k] == nil {
+			statements[k] = &Statement{GroupId: groupId, AssetId: assetId}
+		}
+		return statements[k]
+	}
+
+	for _, state := range []string{mixin.UTXOStateUnspent, mixin.UTXOStateSigned, mixin.UTXOStateSpent} {
+		var cursor string
+		for {
+			outputs, next, err := qs.ListOutputsForStateAfter(state, cursor, QueryPageLimit)
+			if err != nil {
+				return nil, newStoreError("Group.ListOutputsForStateAfter", err)
+			}
+			for _, out := range outputs {
+				s := statement(out.GroupId, out.AssetID)
+				if out.State != OutputStateSpent {
+					s.Balance = s.Balance.Add(out.Amount)
+				}
+				if in := hashes[out.SignedBy]; in != nil && out.State != OutputStateUnspent {
+					in.inputs, in.total, in.inputAsset = in.inputs+1, in.total.Add(out.Amount), out.AssetID
+					if out.State != OutputStateSpent {
+						in.unspent++
+					}
+				}
+				tx := hashes[out.TransactionHash.String()]
+				switch {
+				case tx == nil:
+					s.Inflow = s.Inflow.Add(out.Amount)
+				case tx.internal:
+				default:
+					s.Change = s.Change.Add(out.Amount)
+					tx.change = tx.change.Add(out.Amount)
+				}
+			}
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+	}
+
+	for _, tx := range txs {
+		spent := tx.inputs > 0 && tx.unspent == 0
+		assetId, amount := tx.assetId, tx.amount
+		if assetId == "" && tx.inputs > 0 {
+			assetId, amount = tx.inputAsset, tx.total.Sub(tx.change)
+		} else if assetId == "" {
+			continue
+		}
+		s := statement(tx.groupId, assetId)
+		switch {
+		case !spent:
+			if !tx.internal {
+				s.Pending = s.Pending.Add(amount)
+			}
+		case tx.internal:
+			s.Compaction = s.Compaction.Add(amount)
+			s.Fees = s.Fees.Add(tx.total.Sub(amount))
+		default:
+			s.Outflow = s.Outflow.Add(amount)
+			s.Fees = s.Fees.Add(tx.total.Sub(amount).Sub(tx.change))
+		}
+	}
+
+	r := &Reconciliation{CreatedAt: createdAt}
+	for _, s := range statements {
+		s.Overspent = s.Outflow.Add(s.Fees).Add(s.Pending).GreaterThan(s.Inflow)
+		s.Reconciled = s.Inflow.Sub(s.Outflow).Sub(s.Fees).Equal(s.Balance)
+		r.Statements = append(r.Statements, s)
+	}
+	sort.Slice(r.Statements, func(i, j int) bool {
+		a, b := r.Statements[i], r.Statements[j]
+		if a.GroupId != b.GroupId {
+			return a.GroupId < b.GroupId
+		}
+		return a.AssetId < b.AssetId
+	})
+	return r, nil
+}
+
+func (r *Reconciliation) Overspent() []*Statement {
+	var overspent []*Statement
+	for _, s := range r.Statements {
+		if s.Overspent {
+			overspent = append(overspent, s)
+		}
+	}
+	return overspent
+}
+
+func (r *Reconciliation) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *Reconciliation) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"group_id", "asset_id", "inflow", "outflow", "change", "compaction", "fees", "pending", "balance", "overspent", "reconciled"})
+	if err != nil {
+		return err
+	}
+	for _, s := range r.Statements {
+		err = cw.Write([]string{
+			s.GroupId, s.AssetId,
+			s.Inflow.String(), s.Outflow.String(), s.Change.String(), s.Compaction.String(),
+			s.Fees.String(), s.Pending.String(), s.Balance.String(),
+			strconv.FormatBool(s.Overspent), strconv.FormatBool(s.Reconciled),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func isInternalTransaction(tx *Transaction) bool {
+	return tx.Memo == CompactionTransactionMemo || tx.Memo == EvolutionTransactionMemo
+}
@@ -0,0 +1,16 @@
+package mtg
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInternalTransaction(t *testing.T) {
+	require := require.New(t)
+
+	require.True(isInternalTransaction(&Transaction{Memo: CompactionTransactionMemo}))
+	require.True(isInternalTransaction(&Transaction{Memo: EvolutionTransactionMemo}))
+	require.False(isInternalTransaction(&Transaction{Memo: EvolutionTransactionMemo + ":refund"}))
+	require.False(isInternalTransaction(&Transaction{Memo: "memo"}))
+}
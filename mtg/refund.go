@@ -0,0 +1,89 @@
+package mtg
+
+import (
+	"context"
+	"time"
+
+	"github.com/MixinNetwork/mixin/logger"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	RefundTransactionMemo = "REFUND:UNHANDLED"
+
+	refundTraceSeed = "MTG:REFUND"
+)
+
+// the outputs no worker handled are refunded to the senders, the assets
+// listed are refunded when the amount is at least the minimum, and the
+// assets not listed are only refunded with all assets enabled. all members
+// must use the same policy, because the refunds are consensus transactions.
+// the outputs created before the after time are never refunded, so that a
+// running group could enable it without refunding the outputs handled by
+// the members before.
+type RefundPolicy struct {
+	Minimums     map[string]decimal.Decimal
+	AllAssets    bool
+	Collectibles bool
+	After        time.Time
+}
+
+// the refund is disabled with a nil policy, and the workers must handle
+// all outputs they accept, otherwise the outputs are refunded
+func (grp *Group) SetRefundPolicy(p *RefundPolicy) {
+	grp.refund = p
+}
+
+func RefundTraceId(outputId string) string {
+	return mixin.UniqueConversationID(outputId, refundTraceSeed)
+}
+
+// the outputs without a valid sender are kept, so are the invalid refunds,
+// but the store errors are returned
+func (grp *Group) refundUnhandledOutput(ctx context.Context, out *UnifiedOutput) error {
+	p := grp.refund
+	if p == nil || out.CreatedAt.Before(p.After) {
+		return nil
+	}
+	switch out.Type {
+	case OutputTypeMultisig:
+		o := out.AsMultisig()
+		min, listed := p.Minimums[o.AssetID]
+		if (!listed && !p.AllAssets) || o.Amount.LessThan(min) || !validRefundReceiver(o.Sender) {
+			return nil
+		}
+		traceId := RefundTraceId(o.UTXOID)
+		err := grp.BuildTransaction(ctx, o.AssetID, []string{o.Sender}, 1, o.Amount.String(), RefundTransactionMemo, traceId, grp.outputGroupId(o))
+		logger.Printf("Group.refundUnhandledOutput(%s, %s, %s) => %v\n", o.UTXOID, o.Sender, o.Amount, err)
+		return filterRefundError(err)
+	case OutputTypeCollectible:
+		o := out.AsCollectible()
+		if !p.Collectibles || o.SendersThreshold < 1 || int(o.SendersThreshold) > len(o.Senders) {
+			return nil
+		}
+		for _, s := range o.Senders {
+			if !validRefundReceiver(s) {
+				return nil
+			}
+		}
+		traceId := RefundTraceId(o.OutputId)
+		err := grp.BuildCollectibleTransferTransaction(ctx, o.Senders, int(o.SendersThreshold), RefundTransactionMemo, o.TokenId, traceId)
+		logger.Printf("Group.refundUnhandledOutput(%s, %v, %s) => %v\n", o.OutputId, o.Senders, o.TokenId, err)
+		return filterRefundError(err)
+	}
+	return nil
+}
+
+func filterRefundError(err error) error {
+	if ErrorKindOf(err) == ErrorKindInput {
+		return nil
+	}
+	return err
+}
+
+func validRefundReceiver(id string) bool {
+	uid, err := uuid.FromString(id)
+	return err == nil && uid != uuid.Nil
+}
@@ -0,0 +1,52 @@
+package mtg
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+type testRefundStore struct {
+	*testPropertyStore
+	err error
+}
+
+func (s *testRefundStore) ReadCollectibleTransaction(traceId string) (*CollectibleTransaction, error) {
+	return nil, s.err
+}
+
+func TestRefundCollectibleErrors(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	store := &testRefundStore{testPropertyStore: newTestPropertyStore(), err: fmt.Errorf("store down")}
+	grp := &Group{store: store, refund: &RefundPolicy{Collectibles: true}}
+	out := &UnifiedOutput{
+		Type:                    OutputTypeCollectible,
+		Amount:                  decimal.NewFromInt(1),
+		CreatedAt:               time.Unix(0, 1000),
+		UnifiedOutputId:         "b7a1b5a3-6c3b-4f6c-9d1e-2c8d3c2a8f01",
+		UnifiedTokenId:          "invalid",
+		UnifiedSendersThreshold: 1,
+		UnifiedSenders:          []string{"e8e8a0d2-51d5-4a4d-a5b5-8f9a0f3c6a11"},
+	}
+
+	// the invalid refunds are kept without errors
+	err := grp.refundUnhandledOutput(ctx, out)
+	require.Nil(err)
+
+	// the store errors are returned to halt the group
+	out.UnifiedTokenId = "0f9d9b2a-3f3c-4f7e-8b1a-5d2c6e7f8a90"
+	err = grp.refundUnhandledOutput(ctx, out)
+	require.NotNil(err)
+	require.Equal(ErrorKindStore, ErrorKindOf(err))
+
+	// the outputs before the policy are never refunded
+	grp.refund.After = time.Unix(0, 2000)
+	err = grp.refundUnhandledOutput(ctx, out)
+	require.Nil(err)
+}
@@ -0,0 +1,267 @@
+package mtg
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/fox-one/mixin-sdk-go"
+)
+
+const (
+	ReplayDiffMissing   = "missing"
+	ReplayDiffExtra     = "extra"
+	ReplayDiffDifferent = "different"
+)
+
+// a transaction built differently by the replayed worker, the expected is
+// the one in the source store, and either of them could be nil
+type ReplayDiff struct {
+	TraceId  string
+	Kind     string
+	Reason   string
+	Expected *Transaction
+	Replayed *Transaction
+}
+
+// the compaction, migration and late deposit refund transactions are built
+// by the group instead of the actions, and the collectible outputs are not
+// replayed, so they are only counted in the skipped, not compared
+type ReplayReport struct {
+	Actions      int
+	Transactions int
+	Diffs        []*ReplayDiff
+	Skipped      int
+	Collectibles int
+}
+
+// replay all the multisig actions handled by the source store in order, with
+// a group built on the empty scratch store and an offline network, so the
+// workers only record the transactions built. the transactions are compared
+// with the ones in the source store, except the ones skipped in the report.
+// the replay returns an error once the context canceled or the group stopped.
+func Replay(ctx context.Context, source, scratch Store, conf *Configuration, build func(grp *Group) Worker) (*ReplayReport, error) {
+	irs, err := source.ListIterations()
+	if err != nil {
+		return nil, newStoreError("Replay.ListIterations", err)
+	}
+	for _, ir := range irs {
+		err = scratch.WriteIteration(ir)
+		if err != nil {
+			return nil, newStoreError("Replay.WriteIteration", err)
+		}
+	}
+	grp, err := BuildGroupWithNetwork(ctx, scratch, conf, &replayNetwork{})
+	if err != nil {
+		return nil, err
+	}
+	grp.AddWorker(build(grp))
+
+	actions, err := listReplayActions(source)
+	if err != nil {
+		return nil, err
+	}
+	for _, out := range actions {
+		err = scratch.WriteOutput(out, "")
+		if err != nil {
+			return nil, newStoreError("Replay.WriteOutput", err)
+		}
+		err = scratch.WriteAction(&Action{UTXOID: out.UTXOID, CreatedAt: out.CreatedAt, State: ActionStateInitial})
+		if err != nil {
+			return nil, newStoreError("Replay.WriteAction", err)
+		}
+	}
+	// the scratch group never drains, so the actions retried are ready
+	// once reached in the queue
+	err = grp.writeDrainingCheckpoint(ctx, grp.currentEpoch(), outputsOrderCreated, time.Unix(0, math.MaxInt64))
+	if err != nil {
+		return nil, newStoreError("Replay.writeDrainingCheckpoint", err)
+	}
+	for {
+		if grp.interrupted(ctx) {
+			return nil, newConsensusError("Replay", "interrupted %v", ctx.Err())
+		}
+		pending, err := scratch.ListActions(1)
+		if err != nil {
+			return nil, newStoreError("Replay.ListActions", err)
+		} else if len(pending) == 0 {
+			break
+		}
+		err = grp.handleActionsQueue(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	expected, skipped, err := listReplayTransactions(source)
+	if err != nil {
+		return nil, err
+	}
+	replayed, _, err := listReplayTransactions(scratch)
+	if err != nil {
+		return nil, err
+	}
+	collectibles, err := countReplayCollectibleTransactions(source)
+	if err != nil {
+		return nil, err
+	}
+	report := &ReplayReport{Actions: len(actions), Transactions: len(replayed), Skipped: skipped, Collectibles: collectibles}
+	for id, tx := range expected {
+		rtx := replayed[id]
+		if rtx == nil {
+			report.Diffs = append(report.Diffs, &ReplayDiff{TraceId: id, Kind: ReplayDiffMissing, Expected: tx})
+		} else if reason := diffReplayTransaction(tx, rtx); reason != "" {
+			report.Diffs = append(report.Diffs, &ReplayDiff{TraceId: id, Kind: ReplayDiffDifferent, Reason: reason, Expected: tx, Replayed: rtx})
+		}
+	}
+	for id, rtx := range replayed {
+		if expected[id] == nil {
+			report.Diffs = append(report.Diffs, &ReplayDiff{TraceId: id, Kind: ReplayDiffExtra, Replayed: rtx})
+		}
+	}
+	sort.Slice(report.Diffs, func(i, j int) bool { return report.Diffs[i].TraceId < report.Diffs[j].TraceId })
+	return report, nil
+}
+
+// the actions handled by the source store are replayed in the same order,
+// and only the multisig ones are replayed as unspent outputs
+func listReplayActions(source Store) ([]*Output, error) {
+	as, ok := source.(ActionStore)
+	if !ok {
+		return nil, newStoreError("Replay.ListActionsForState", errStoreCapability(source, "ActionStore"))
+	}
+	outputs := make(map[string]*Output)
+	for _, state := range []string{mixin.UTXOStateUnspent, mixin.UTXOStateSigned, mixin.UTXOStateSpent} {
+		list, err := listOutputsForState(source, state, 0)
+		if err != nil {
+			return nil, newStoreError("Replay.ListOutputsForState", err)
+		}
+		for _, out := range list {
+			outputs[out.UTXOID] = out
+		}
+	}
+	handled, err := as.ListActionsForState(ActionStateDone, 0)
+	if err != nil {
+		return nil, newStoreError("Replay.ListActionsForState", err)
+	}
+	var actions []*Output
+	for _, act := range handled {
+		out := outputs[act.UTXOID]
+		if out == nil {
+			continue
+		}
+		out.State = OutputStateUnspent
+		out.SignedBy, out.SignedTx = "", ""
+		actions = append(actions, out)
+	}
+	return actions, nil
+}
+
+// the transactions only drained from other members have no asset, and
+// they are neither compared nor skipped
+func listReplayTransactions(store Store) (map[string]*Transaction, int, error) {
+	txs, skipped := make(map[string]*Transaction), 0
+	for _, state := range []int{TransactionStateHeld, TransactionStateInitial, TransactionStateSigning, TransactionStateSigned, TransactionStateSnapshot} {
+		list, err := store.ListTransactions(state, 0)
+		if err != nil {
+			return nil, 0, newStoreError("Replay.ListTransactions", err)
+		}
+		for _, tx := range list {
+			if tx.AssetId == "" {
+				continue
+			}
+			if tx.Memo == CompactionTransactionMemo || isMaintenanceTransaction(tx) {
+				skipped += 1
+				continue
+			}
+			txs[tx.TraceId] = tx
+		}
+	}
+	return txs, skipped, nil
+}
+
+func countReplayCollectibleTransactions(store Store) (int, error) {
+	count := 0
+	for _, state := range []int{TransactionStateInitial, TransactionStateSigning, TransactionStateSigned, TransactionStateSnapshot} {
+		list, err := store.ListCollectibleTransactions(state, 0)
+		if err != nil {
+			return 0, newStoreError("Replay.ListCollectibleTransactions", err)
+		}
+		count += len(list)
+	}
+	return count, nil
+}
+
+func diffReplayTransaction(expected, replayed *Transaction) string {
+	switch {
+	case expected.GroupId != replayed.GroupId:
+		return fmt.Sprintf("group %s %s", expected.GroupId, replayed.GroupId)
+	case expected.AssetId != replayed.AssetId:
+		return fmt.Sprintf("asset %s %s", expected.AssetId, replayed.AssetId)
+	case hashMembers(expected.Receivers) != hashMembers(replayed.Receivers):
+		return fmt.Sprintf("receivers %v %v", expected.Receivers, replayed.Receivers)
+	case expected.Threshold != replayed.Threshold:
+		return fmt.Sprintf("threshold %d %d", expected.Threshold, replayed.Threshold)
+	case expected.Amount != replayed.Amount:
+		return fmt.Sprintf("amount %s %s", expected.Amount, replayed.Amount)
+	case expected.Memo != replayed.Memo:
+		return fmt.Sprintf("memo %s %s", expected.Memo, replayed.Memo)
+	case !equalReferences(expected.References, replayed.References):
+		return fmt.Sprintf("references %v %v", expected.References, replayed.References)
+	case len(expected.Entries) != len(replayed.Entries):
+		return fmt.Sprintf("entries %d %d", len(expected.Entries), len(replayed.Entries))
+	}
+	for i, en := range expected.Entries {
+		rn := replayed.Entries[i]
+		if hashMembers(en.Receivers) != hashMembers(rn.Receivers) || en.Threshold != rn.Threshold || en.Amount != rn.Amount {
+			return fmt.Sprintf("entry %d", i)
+		}
+	}
+	return ""
+}
+
+// the offline network for replay, the group only handles the actions, so
+// only the pin is verified
+type replayNetwork struct{}
+
+func (n *replayNetwork) VerifyPin(ctx context.Context, pin string) error {
+	return nil
+}
+
+func (n *replayNetwork) ReadUnifiedOutputs(ctx context.Context, members []string, threshold uint8, offset time.Time, limit int, order string) ([]*UnifiedOutput, error) {
+	return nil, fmt.Errorf("replay network offline")
+}
+
+func (n *replayNetwork) BatchReadGhostKeys(ctx context.Context, inputs []*mixin.GhostInput) ([]*mixin.GhostKeys, error) {
+	return nil, fmt.Errorf("replay network offline")
+}
+
+func (n *replayNetwork) CreateMultisig(ctx context.Context, action, raw string) (*mixin.MultisigRequest, error) {
+	return nil, fmt.Errorf("replay network offline")
+}
+
+func (n *replayNetwork) SignMultisig(ctx context.Context, reqID, pin string) (*mixin.MultisigRequest, error) {
+	return nil, fmt.Errorf("replay network offline")
+}
+
+func (n *replayNetwork) UnlockMultisig(ctx context.Context, reqID, pin string) error {
+	return fmt.Errorf("replay network offline")
+}
+
+func (n *replayNetwork) CreateCollectibleRequest(ctx context.Context, action, raw string) (*mixin.CollectibleRequest, error) {
+	return nil, fmt.Errorf("replay network offline")
+}
+
+func (n *replayNetwork) SignCollectibleRequest(ctx context.Context, reqID, pin string) (*mixin.CollectibleRequest, error) {
+	return nil, fmt.Errorf("replay network offline")
+}
+
+func (n *replayNetwork) SendRawTransaction(ctx context.Context, raw string) (*mixin.Hash, error) {
+	return nil, fmt.Errorf("replay network offline")
+}
+
+func (n *replayNetwork) GetRawTransaction(ctx context.Context, hash mixin.Hash) (*mixin.Transaction, error) {
+	return nil, fmt.Errorf("replay network offline")
+}
@@ -0,0 +1,231 @@
+package mtg
+
+import (
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	selectorDefaultMaxTries = 100000
+)
+
+// the selector picks the inputs for the transaction from the unspent outputs
+// of the asset, which are sorted by created time. all members must pick the
+// identical inputs, otherwise the multisig never converges, so the selector
+// must be deterministic and all members must use the same selector. it
+// returns nil if the outputs are insufficient for the amount, otherwise the
+// selected outputs in created order.
+type CoinSelector interface {
+	SelectOutputs(outputs []*Output, amount decimal.Decimal) []*Output
+}
+
+// consume the outputs in created order until the amount is covered, and at
+// least minimum outputs are consumed to reduce the outputs fragmentation
+type OldestFirstSelector struct {
+	Minimum int
+}
+
+func (s *OldestFirstSelector) SelectOutputs(outputs []*Output, amount decimal.Decimal) []*Output {
+	var total decimal.Decimal
+	var consumed []*Output
+	for _, out := range outputs {
+		total = total.Add(out.Amount)
+		consumed = append(consumed, out)
+		if total.Cmp(amount) >= 0 && len(consumed) >= s.Minimum {
+			break
+		}
+	}
+	if total.Cmp(amount) < 0 {
+		return nil
+	}
+	return consumed
+}
+
+// consume the largest outputs first, which needs the fewest inputs
+type LargestFirstSelector struct{}
+
+func (s *LargestFirstSelector) SelectOutputs(outputs []*Output, amount decimal.Decimal) []*Output {
+	var total decimal.Decimal
+	var consumed []*Output
+	for _, out := range sortOutputsByAmount(outputs) {
+		total = total.Add(out.Amount)
+		consumed = append(consumed, out)
+		if total.Cmp(amount) >= 0 {
+			sortOutputsByCreated(consumed)
+			return consumed
+		}
+	}
+	return nil
+}
+
+// search for the inputs sum up to the amount exactly, so no change output
+// is created. the search stops after max tries, then the fallback selector
+// is used, which defaults to the largest first selector.
+type BranchAndBoundSelector struct {
+	MaxTries int
+	Fallback CoinSelector
+}
+
+func (s *BranchAndBoundSelector) SelectOutputs(outputs []*Output, amount decimal.Decimal) []*Output {
+	search := newOutputsSearch(outputs, amount, s.MaxTries)
+	search.run(true)
+	if search.best != nil && search.best.Equal(amount) {
+		return search.selected()
+	}
+	if s.Fallback != nil {
+		return s.Fallback.SelectOutputs(outputs, amount)
+	}
+	return (&LargestFirstSelector{}).SelectOutputs(outputs, amount)
+}
+
+// search for the inputs with the smallest change, and the fewest inputs if
+// the change equals. the search stops after max tries with the best found,
+// which is never worse than the largest first selector.
+type MinimizeChangeSelector struct {
+	MaxTries int
+}
+
+func (s *MinimizeChangeSelector) SelectOutputs(outputs []*Output, amount decimal.Decimal) []*Output {
+	search := newOutputsSearch(outputs, amount, s.MaxTries)
+	largest := (&LargestFirstSelector{}).SelectOutputs(outputs, amount)
+	if largest == nil {
+		return nil
+	}
+	search.seed(largest)
+	search.run(false)
+	return search.selected()
+}
+
+// the depth first search over the outputs sorted by amount descending, the
+// branch is skipped when the sum exceeds the best, or the remaining outputs
+// are insufficient, the search order is fixed so the result is deterministic
+type outputsSearch struct {
+	outputs   []*Output
+	remaining []decimal.Decimal
+	amount    decimal.Decimal
+	tries     int
+
+	current []int
+	best    *decimal.Decimal
+	result  []int
+}
+
+func newOutputsSearch(outputs []*Output, amount decimal.Decimal, tries int) *outputsSearch {
+	if tries <= 0 {
+		tries = selectorDefaultMaxTries
+	}
+	s := &outputsSearch{
+		outputs: sortOutputsByAmount(outputs),
+		amount:  amount,
+		tries:   tries,
+	}
+	s.remaining = make([]decimal.Decimal, len(s.outputs)+1)
+	for i := len(s.outputs) - 1; i >= 0; i-- {
+		s.remaining[i] = s.remaining[i+1].Add(s.outputs[i].Amount)
+	}
+	return s
+}
+
+func (s *outputsSearch) seed(outputs []*Output) {
+	index := make(map[string]int)
+	for i, out := range s.outputs {
+		index[out.UTXOID] = i
+	}
+	var total decimal.Decimal
+	for _, out := range outputs {
+		total = total.Add(out.Amount)
+		s.result = append(s.result, index[out.UTXOID])
+	}
+	sort.Ints(s.result)
+	s.best = &total
+}
+
+func (s *outputsSearch) run(exact bool) {
+	if s.remaining[0].Cmp(s.amount) < 0 {
+		return
+	}
+	s.walk(0, decimal.Zero, exact)
+}
+
+func (s *outputsSearch) walk(i int, total decimal.Decimal, exact bool) bool {
+	if s.tries <= 0 {
+		return true
+	}
+	s.tries -= 1
+	if total.Cmp(s.amount) >= 0 {
+		if exact && !total.Equal(s.amount) {
+			return false
+		}
+		if s.better(total) {
+			s.best = &total
+			s.result = append([]int{}, s.current...)
+		}
+		return total.Equal(s.amount)
+	}
+	if i == len(s.outputs) || total.Add(s.remaining[i]).Cmp(s.amount) < 0 {
+		return false
+	}
+	if s.best != nil && total.Cmp(*s.best) >= 0 {
+		return false
+	}
+
+	s.current = append(s.current, i)
+	done := s.walk(i+1, total.Add(s.outputs[i].Amount), exact)
+	s.current = s.current[:len(s.current)-1]
+	if done {
+		return true
+	}
+	return s.walk(i+1, total, exact)
+}
+
+func (s *outputsSearch) better(total decimal.Decimal) bool {
+	if s.best == nil {
+		return true
+	}
+	switch total.Cmp(*s.best) {
+	case -1:
+		return true
+	case 0:
+		return len(s.current) < len(s.result)
+	}
+	return false
+}
+
+// the selected outputs are returned in created order
+func (s *outputsSearch) selected() []*Output {
+	if s.best == nil {
+		return nil
+	}
+	var consumed []*Output
+	for _, i := range s.result {
+		consumed = append(consumed, s.outputs[i])
+	}
+	sortOutputsByCreated(consumed)
+	return consumed
+}
+
+func sortOutputsByAmount(outputs []*Output) []*Output {
+	sorted := append([]*Output{}, outputs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if c := a.Amount.Cmp(b.Amount); c != 0 {
+			return c > 0
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.UTXOID < b.UTXOID
+	})
+	return sorted
+}
+
+func sortOutputsByCreated(outputs []*Output) {
+	sort.SliceStable(outputs, func(i, j int) bool {
+		a, b := outputs[i], outputs[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.UTXOID < b.UTXOID
+	})
+}
@@ -0,0 +1,94 @@
+package mtg
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoinSelectors(t *testing.T) {
+	require := require.New(t)
+
+	outputs := testBuildOutputs("5", "1", "3", "2", "8", "1")
+	amount := decimal.RequireFromString("6")
+
+	s := &OldestFirstSelector{}
+	require.Equal([]string{"5", "1"}, testOutputsAmounts(s.SelectOutputs(outputs, amount)))
+	s = &OldestFirstSelector{Minimum: 3}
+	require.Equal([]string{"5", "1", "3"}, testOutputsAmounts(s.SelectOutputs(outputs, amount)))
+	require.Nil(s.SelectOutputs(outputs, decimal.RequireFromString("21")))
+
+	ls := &LargestFirstSelector{}
+	require.Equal([]string{"8"}, testOutputsAmounts(ls.SelectOutputs(outputs, amount)))
+	require.Equal([]string{"5", "3", "8"}, testOutputsAmounts(ls.SelectOutputs(outputs, decimal.RequireFromString("15"))))
+	require.Nil(ls.SelectOutputs(outputs, decimal.RequireFromString("21")))
+
+	bs := &BranchAndBoundSelector{}
+	require.Equal([]string{"5", "1"}, testOutputsAmounts(bs.SelectOutputs(outputs, amount)))
+	require.Equal([]string{"5", "3", "8"}, testOutputsAmounts(bs.SelectOutputs(outputs, decimal.RequireFromString("16"))))
+	require.Equal([]string{"8"}, testOutputsAmounts(bs.SelectOutputs(outputs, decimal.RequireFromString("7.5"))))
+	bs.Fallback = &OldestFirstSelector{}
+	require.Equal([]string{"5", "1", "3"}, testOutputsAmounts(bs.SelectOutputs(outputs, decimal.RequireFromString("7.5"))))
+	require.Nil(bs.SelectOutputs(outputs, decimal.RequireFromString("21")))
+
+	ms := &MinimizeChangeSelector{}
+	require.Equal([]string{"5", "1"}, testOutputsAmounts(ms.SelectOutputs(outputs, amount)))
+	require.Equal([]string{"8"}, testOutputsAmounts(ms.SelectOutputs(outputs, decimal.RequireFromString("7.5"))))
+	require.Equal([]string{"2", "8"}, testOutputsAmounts(ms.SelectOutputs(outputs, decimal.RequireFromString("9.5"))))
+	require.Equal([]string{"5", "1", "3", "2", "8", "1"}, testOutputsAmounts(ms.SelectOutputs(outputs, decimal.RequireFromString("20"))))
+	require.Nil(ms.SelectOutputs(outputs, decimal.RequireFromString("21")))
+}
+
+func TestCoinSelectorsDeterministic(t *testing.T) {
+	require := require.New(t)
+
+	var amounts []string
+	for i := 0; i < 36; i++ {
+		amounts = append(amounts, fmt.Sprint(i%7+1))
+	}
+	outputs := testBuildOutputs(amounts...)
+	amount := decimal.RequireFromString("23")
+
+	for _, s := range []CoinSelector{
+		&OldestFirstSelector{Minimum: 4},
+		&LargestFirstSelector{},
+		&BranchAndBoundSelector{MaxTries: 1000},
+		&MinimizeChangeSelector{MaxTries: 1000},
+	} {
+		expected := s.SelectOutputs(outputs, amount)
+		require.NotNil(expected)
+		for i := 0; i < 10; i++ {
+			shuffled := append([]*Output{}, outputs...)
+			rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			sortOutputsByCreated(shuffled)
+			require.Equal(expected, s.SelectOutputs(shuffled, amount))
+		}
+	}
+}
+
+func testBuildOutputs(amounts ...string) []*Output {
+	var outputs []*Output
+	for i, a := range amounts {
+		outputs = append(outputs, &Output{
+			UTXOID:    fmt.Sprintf("utxo-%02d", i),
+			Amount:    decimal.RequireFromString(a),
+			CreatedAt: time.Unix(1600000000, 0).Add(time.Duration(i/2) * time.Second),
+		})
+	}
+	return outputs
+}
+
+func testOutputsAmounts(outputs []*Output) []string {
+	if outputs == nil {
+		return nil
+	}
+	var amounts []string
+	for _, out := range outputs {
+		amounts = append(amounts, out.Amount.String())
+	}
+	return amounts
+}
@@ -0,0 +1,391 @@
+package mtg
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/MixinNetwork/mixin/logger"
+	"github.com/fox-one/mixin-sdk-go"
+)
+
+// the group with collectibles is marked, because only the multisig outputs
+// are exported, and the snapshot is refused for it
+const snapshotCollectiblesKey = "MTG:SNAPSHOT:COLLECTIBLES"
+
+// the properties exported, the group and store keys all have these prefixes
+var snapshotPropertyPrefixes = []string{"MTG:", outputsDrainingKey}
+
+type SnapshotProperty struct {
+	Key   string
+	Value []byte
+}
+
+type SnapshotOutput struct {
+	Output  *Output
+	TraceId string
+}
+
+// the store of a member at the draining checkpoints, a new node imports it
+// and drains from the checkpoints, instead of from the genesis. only the
+// multisig outputs are exported, so the group with collectibles is refused.
+// the signatures are not included in the hash.
+type Snapshot struct {
+	GenesisId    string
+	CreatedAt    time.Time
+	Iterations   []*Iteration
+	Properties   []*SnapshotProperty
+	Outputs      []*SnapshotOutput
+	Actions      []*Action
+	Timers       []*Timer
+	Transactions []*Transaction
+	Audit        []*AuditEntry
+	Signatures   map[string][]byte
+}
+
+func (s *Snapshot) Hash() crypto.Hash {
+	c := *s
+	c.Signatures = nil
+	return crypto.NewHash(MsgpackMarshalPanic(&c))
+}
+
+func (s *Snapshot) Marshal() []byte {
+	return compress(MsgpackMarshalPanic(s))
+}
+
+func UnmarshalSnapshot(b []byte) (*Snapshot, error) {
+	var s Snapshot
+	err := MsgpackUnmarshal(decompress(b), &s)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// the draining checkpoints are exported first, so the outputs after them
+// are drained again after imported, which is safe even if the group is
+// running when exporting
+func (grp *Group) ExportSnapshot() (*Snapshot, error) {
+	ps, ok := grp.store.(PropertyStore)
+	if !ok {
+		return nil, newStoreError("Group.ListProperties", errStoreCapability(grp.store, "PropertyStore"))
+	}
+	as, ok := grp.store.(ActionStore)
+	if !ok {
+		return nil, newStoreError("Group.ListActionsForState", errStoreCapability(grp.store, "ActionStore"))
+	}
+	err := grp.checkSnapshotCollectibles()
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		GenesisId:  grp.id,
+		CreatedAt:  grp.clock.Now(),
+		Signatures: make(map[string][]byte),
+	}
+	for _, prefix := range snapshotPropertyPrefixes {
+		props, err := ps.ListProperties([]byte(prefix))
+		if err != nil {
+			return nil, newStoreError("Group.ListProperties", err)
+		}
+		for k, v := range props {
+			if k == timersKey {
+				continue
+			}
+			s.Properties = append(s.Properties, &SnapshotProperty{Key: k, Value: v})
+		}
+	}
+	sort.Slice(s.Properties, func(i, j int) bool { return s.Properties[i].Key < s.Properties[j].Key })
+
+	irs, err := grp.store.ListIterations()
+	if err != nil {
+		return nil, newStoreError("Group.ListIterations", err)
+	}
+	s.Iterations = irs
+
+	traces := make(map[string]string)
+	for _, state := range []int{TransactionStateHeld, TransactionStateInitial, TransactionStateSigning, TransactionStateSigned, TransactionStateSnapshot} {
+		txs, err := grp.store.ListTransactions(state, 0)
+		if err != nil {
+			return nil, newStoreError("Group.ListTransactions", err)
+		}
+		for _, tx := range txs {
+			outputs, err := grp.store.ListOutputsForTransaction(tx.TraceId)
+			if err != nil {
+				return nil, newStoreError("Group.ListOutputsForTransaction", err)
+			}
+			for _, out := range outputs {
+				traces[out.UTXOID] = tx.TraceId
+			}
+		}
+		s.Transactions = append(s.Transactions, txs...)
+	}
+	for _, state := range []string{mixin.UTXOStateUnspent, mixin.UTXOStateSigned, mixin.UTXOStateSpent} {
+		outputs, err := listOutputsForState(grp.store, state, 0)
+		if err != nil {
+			return nil, newStoreError("Group.ListOutputsForState", err)
+		}
+		for _, out := range outputs {
+			s.Outputs = append(s.Outputs, &SnapshotOutput{Output: out, TraceId: traces[out.UTXOID]})
+		}
+	}
+
+	// the actions handled are exported too, otherwise the outputs drained
+	// again after imported are handled twice
+	for _, state := range []int{ActionStateInitial, ActionStateDone} {
+		actions, err := as.ListActionsForState(state, 0)
+		if err != nil {
+			return nil, newStoreError("Group.ListActionsForState", err)
+		}
+		s.Actions = append(s.Actions, actions...)
+	}
+	s.Timers, err = grp.ListTimers()
+	if err != nil {
+		return nil, err
+	}
+	s.Audit, err = grp.ExportAuditLog(1, 0)
+	return s, err
+}
+
+func (grp *Group) checkSnapshotCollectibles() error {
+	val, err := grp.store.ReadProperty([]byte(snapshotCollectiblesKey))
+	if err != nil {
+		return newStoreError("Group.ReadProperty", err)
+	}
+	if len(val) > 0 {
+		return newInputError("Group.ExportSnapshot", "collectibles not exported %s", grp.id)
+	}
+	for _, state := range []int{TransactionStateInitial, TransactionStateSigning, TransactionStateSigned, TransactionStateSnapshot} {
+		txs, err := grp.store.ListCollectibleTransactions(state, 1)
+		if err != nil {
+			return newStoreError("Group.ListCollectibleTransactions", err)
+		}
+		if len(txs) > 0 {
+			return newInputError("Group.ExportSnapshot", "collectibles not exported %s", grp.id)
+		}
+	}
+	return nil
+}
+
+// the member only signs the snapshot with the same consensus digest, and
+// all its outputs and transactions are the same as the local ones
+func (grp *Group) SignSnapshot(s *Snapshot, key ed25519.PrivateKey) error {
+	err := grp.checkSnapshot(s)
+	if err != nil {
+		return err
+	}
+	if s.Signatures == nil {
+		s.Signatures = make(map[string][]byte)
+	}
+	hash := s.Hash()
+	s.Signatures[grp.member] = ed25519.Sign(key, hash[:])
+	return nil
+}
+
+func (grp *Group) checkSnapshot(s *Snapshot) error {
+	if s.GenesisId != grp.id {
+		return newInputError("Group.SignSnapshot", "invalid genesis id %s", s.GenesisId)
+	}
+	err := VerifyAuditEntries(nil, s.Audit)
+	if err != nil {
+		return err
+	}
+	if len(s.Audit) > 0 {
+		last := s.Audit[len(s.Audit)-1]
+		digest, err := grp.readAuditDigest(last.Round)
+		if err != nil {
+			return err
+		}
+		if digest == nil || digest.Digest != last.Digest {
+			return newInputError("Group.SignSnapshot", "invalid digest at round %d", last.Round)
+		}
+	}
+
+	// the output state may be different among members
+	local := make(map[string]map[string]*Output)
+	for _, so := range s.Outputs {
+		var found bool
+		for _, state := range []string{mixin.UTXOStateUnspent, mixin.UTXOStateSigned, mixin.UTXOStateSpent} {
+			outputs, err := grp.listSnapshotOutputs(local, so.Output.GroupId, state, so.Output.AssetID)
+			if err != nil {
+				return err
+			}
+			if o := outputs[so.Output.UTXOID]; o != nil {
+				found = matchSnapshotOutput(o, so.Output)
+				break
+			}
+		}
+		if !found {
+			return newInputError("Group.SignSnapshot", "invalid output %s", so.Output.UTXOID)
+		}
+	}
+	for _, tx := range s.Transactions {
+		old, err := grp.store.ReadTransactionByTraceId(tx.TraceId)
+		if err != nil {
+			return newStoreError("Group.ReadTransactionByTraceId", err)
+		}
+		if old == nil && tx.Memo == CompactionTransactionMemo {
+			continue
+		}
+		if old == nil || (tx.AssetId != "" && old.AssetId != "" && diffReplayTransaction(tx, old) != "") {
+			return newInputError("Group.SignSnapshot", "invalid transaction %s", tx.TraceId)
+		}
+	}
+	return nil
+}
+
+// the local outputs of each group id, state and asset are only listed once
+// for all outputs of the snapshot
+func (grp *Group) listSnapshotOutputs(local map[string]map[string]*Output, groupId, state, assetId string) (map[string]*Output, error) {
+	key := groupId + ":" + state + ":" + assetId
+	if outputs, found := local[key]; found {
+		return outputs, nil
+	}
+	list, err := grp.store.ListOutputsForAsset(groupId, state, assetId, 0)
+	if err != nil {
+		return nil, newStoreError("Group.ListOutputsForAsset", err)
+	}
+	outputs := make(map[string]*Output, len(list))
+	for _, o := range list {
+		outputs[o.UTXOID] = o
+	}
+	local[key] = outputs
+	return outputs, nil
+}
+
+func matchSnapshotOutput(o, out *Output) bool {
+	return o.Amount.Equal(out.Amount) && o.Threshold == out.Threshold &&
+		hashMembers(o.Members) == hashMembers(out.Members) && o.TransactionHash == out.TransactionHash
+}
+
+// the digest of the consensus entry at the round in the local audit log
+func (grp *Group) readAuditDigest(round uint64) (*AuditDigest, error) {
+	as, ok := grp.store.(AuditStore)
+	if !ok {
+		return nil, newStoreError("Group.ReadAuditEntryByRound", errStoreCapability(grp.store, "AuditStore"))
+	}
+	e, err := as.ReadAuditEntryByRound(round)
+	if err != nil || e == nil {
+		return nil, newStoreError("Group.ReadAuditEntryByRound", err)
+	}
+	return e.digest(), nil
+}
+
+// the snapshot must be signed by a threshold of the members of its latest
+// epoch, with the public keys trusted by the configuration
+func VerifySnapshot(s *Snapshot, conf *Configuration) error {
+	if s.GenesisId != generateGenesisId(conf) {
+		return fmt.Errorf("invalid snapshot genesis id %s", s.GenesisId)
+	}
+	genesis := &Epoch{
+		Members:   conf.Genesis.Members,
+		Threshold: conf.Genesis.Threshold,
+		CreatedAt: time.Unix(0, conf.Genesis.Timestamp),
+	}
+	epochs, err := buildEpochs(genesis, append([]*Iteration{}, s.Iterations...))
+	if err != nil {
+		return err
+	}
+	e := epochs[len(epochs)-1]
+	hash := s.Hash()
+	var signers int
+	for _, m := range e.Members {
+		sig, key := s.Signatures[m], conf.Snapshot.Keys[m]
+		pub, _ := hex.DecodeString(key)
+		if len(sig) == 0 || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		if ed25519.Verify(ed25519.PublicKey(pub), hash[:], sig) {
+			signers++
+		}
+	}
+	if signers < e.Threshold {
+		return fmt.Errorf("insufficient snapshot signatures %d/%d", signers, e.Threshold)
+	}
+	return VerifyAuditEntries(nil, s.Audit)
+}
+
+// import the snapshot to the empty store of a new node
+func ImportSnapshot(store Store, s *Snapshot, conf *Configuration) error {
+	err := VerifySnapshot(s, conf)
+	if err != nil {
+		return err
+	}
+	for _, ir := range s.Iterations {
+		err = store.WriteIteration(ir)
+		if err != nil {
+			return err
+		}
+	}
+	for _, so := range s.Outputs {
+		err = store.WriteOutput(so.Output, so.TraceId)
+		if err != nil {
+			return err
+		}
+	}
+	for _, tx := range s.Transactions {
+		err = store.WriteTransaction(tx)
+		if err != nil {
+			return err
+		}
+	}
+	for _, act := range s.Actions {
+		err = store.WriteAction(act)
+		if err != nil {
+			return err
+		}
+	}
+	for _, t := range s.Timers {
+		err = writeTimer(store, t)
+		if err != nil {
+			return err
+		}
+	}
+	as, ok := store.(AuditStore)
+	if !ok && len(s.Audit) > 0 {
+		return errStoreCapability(store, "AuditStore")
+	}
+	for _, e := range s.Audit {
+		c := *e
+		err = as.AppendAuditEntry(&c)
+		if err != nil {
+			return err
+		}
+		if c.Hash != e.Hash {
+			return fmt.Errorf("invalid audit entry %d", e.Sequence)
+		}
+	}
+	// the properties are imported at last, because the draining
+	// checkpoints are only valid after all outputs imported
+	for _, p := range s.Properties {
+		if p.Key == snapshotCollectiblesKey {
+			return fmt.Errorf("invalid snapshot with collectibles %s", s.GenesisId)
+		}
+		if !strings.HasPrefix(p.Key, snapshotPropertyPrefixes[0]) && !strings.HasPrefix(p.Key, snapshotPropertyPrefixes[1]) {
+			return fmt.Errorf("invalid snapshot property %s", p.Key)
+		}
+		err = store.WriteProperty([]byte(p.Key), p.Value)
+		if err != nil {
+			return err
+		}
+	}
+	logger.Printf("ImportSnapshot(%s, %s) => %d %d\n", s.GenesisId, s.Hash(), len(s.Outputs), len(s.Transactions))
+	return nil
+}
+
+func importSnapshotFile(store Store, conf *Configuration) error {
+	b, err := os.ReadFile(conf.Snapshot.Path)
+	if err != nil {
+		return err
+	}
+	s, err := UnmarshalSnapshot(b)
+	if err != nil {
+		return err
+	}
+	return ImportSnapshot(store, s, conf)
+}
@@ -0,0 +1,122 @@
+package mtg
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// the last success and failure of a stage of the Run loop
+type StageStatus struct {
+	SucceededAt time.Time
+	FailedAt    time.Time
+	Error       string
+}
+
+// the draining checkpoints of the current epoch, the network head is the
+// latest updated time of the outputs read from the network, so the gap
+// between them is the draining progress
+type DrainStatus struct {
+	Created     time.Time
+	Updated     time.Time
+	NetworkHead time.Time
+}
+
+type Status struct {
+	Synced                  bool
+	Halted                  bool
+	Epoch                   string
+	Draining                DrainStatus
+	PendingActions          int
+	Transactions            map[int]int
+	CollectibleTransactions map[int]int
+	Stages                  map[string]StageStatus
+}
+
+type stageState struct {
+	sync.Mutex
+	stages map[string]StageStatus
+}
+
+// the status for dashboards and readiness probes, the counts are read from
+// the state indexes of the CountStore, which still iterates all the keys of
+// the snapshot transactions, so the callers should cache it. the pending
+// actions is -1 and the transactions are empty without the CountStore
+func (grp *Group) Status(ctx context.Context) (*Status, error) {
+	e := grp.currentEpoch()
+	s := &Status{
+		Epoch:                   e.String(),
+		Transactions:            make(map[int]int),
+		CollectibleTransactions: make(map[int]int),
+		Stages:                  make(map[string]StageStatus),
+	}
+	synced, err := grp.Synced()
+	if err != nil {
+		return nil, newStoreError("Group.Synced", err)
+	}
+	s.Synced = synced
+	s.Halted, err = grp.Halted()
+	if err != nil {
+		return nil, err
+	}
+
+	s.Draining.Created, err = grp.readDrainingCheckpoint(ctx, e, outputsOrderCreated)
+	if err != nil {
+		return nil, newStoreError("Group.readDrainingCheckpoint", err)
+	}
+	s.Draining.Updated, err = grp.readDrainingCheckpoint(ctx, e, outputsOrderUpdated)
+	if err != nil {
+		return nil, newStoreError("Group.readDrainingCheckpoint", err)
+	}
+	grp.drainState.Lock()
+	s.Draining.NetworkHead = grp.drainState.head
+	grp.drainState.Unlock()
+
+	cs, ok := grp.store.(CountStore)
+	if !ok {
+		s.PendingActions = -1
+		return grp.readStageStatus(s), nil
+	}
+	s.PendingActions, err = cs.CountActions(ActionStateInitial)
+	if err != nil {
+		return nil, newStoreError("Group.CountActions", err)
+	}
+	for _, state := range []int{TransactionStateHeld, TransactionStateInitial, TransactionStateSigning, TransactionStateSigned, TransactionStateSnapshot} {
+		s.Transactions[state], err = cs.CountTransactions(state)
+		if err != nil {
+			return nil, newStoreError("Group.CountTransactions", err)
+		}
+	}
+	for _, state := range []int{TransactionStateInitial, TransactionStateSigning, TransactionStateSigned, TransactionStateSnapshot} {
+		s.CollectibleTransactions[state], err = cs.CountCollectibleTransactions(state)
+		if err != nil {
+			return nil, newStoreError("Group.CountCollectibleTransactions", err)
+		}
+	}
+	return grp.readStageStatus(s), nil
+}
+
+func (grp *Group) readStageStatus(s *Status) *Status {
+	grp.stageState.Lock()
+	for stage, ss := range grp.stageState.stages {
+		s.Stages[stage] = ss
+	}
+	grp.stageState.Unlock()
+	return s
+}
+
+func (grp *Group) recordStage(stage string, err error) {
+	grp.stageState.Lock()
+	defer grp.stageState.Unlock()
+
+	if grp.stageState.stages == nil {
+		grp.stageState.stages = make(map[string]StageStatus)
+	}
+	ss := grp.stageState.stages[stage]
+	if err == nil {
+		ss.SucceededAt = time.Now()
+	} else {
+		ss.FailedAt, ss.Error = time.Now(), err.Error()
+	}
+	grp.stageState.stages[stage] = ss
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	prefixActionPayload = "ACTION:PAYLOAD:"
+	prefixActionState   = "ACTION:STATE:"
+)
+
+// the initial action retried is written again with the time not before,
+// so it's moved back in the queue without blocking the actions after it
+func (bs *BadgerStore) WriteAction(act *mtg.Action) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		old, err := bs.readAction(txn, act.UTXOID)
+		if err != nil {
+			return err
+		}
+		if old != nil && old.State > act.State {
+			return nil
+		}
+		if old != nil && old.State == act.State && !act.CreatedAt.After(old.CreatedAt) {
+			return nil
+		}
+		if old != nil {
+			err = txn.Delete(buildActionTimedKey(old))
+			if err != nil {
+				return err
+			}
+		}
+		key := []byte(prefixActionPayload + act.UTXOID)
+		err = txn.Set(key, mtg.MsgpackMarshalPanic(act))
+		if err != nil {
+			return err
+		}
+		return txn.Set(buildActionTimedKey(act), []byte{1})
+	})
+}
+
+func (bs *BadgerStore) ListActions(limit int) ([]*mtg.UnifiedOutput, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	prefix := []byte(actionStatePrefix(mtg.ActionStateInitial))
+	var outs []*mtg.UnifiedOutput
+	for _, id := range listTimedIds(txn, prefix, 0, limit) {
+		mo, err := bs.readOutput(txn, id)
+		if err != nil {
+			return nil, err
+		} else if mo != nil {
+			outs = append(outs, mo.Unified())
+			continue
+		}
+
+		co, err := bs.readCollectibleOutput(txn, id)
+		if err != nil {
+			return nil, err
+		} else if co != nil {
+			outs = append(outs, co.Unified())
+		}
+	}
+	return outs, nil
+}
+
+// the actions are listed by the time in the queue
+func (bs *BadgerStore) ListActionsForState(state int, limit int) ([]*mtg.Action, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	prefix := []byte(actionStatePrefix(state))
+	var acts []*mtg.Action
+	for _, id := range listTimedIds(txn, prefix, 0, limit) {
+		act, err := bs.readAction(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		acts = append(acts, act)
+	}
+	return acts, nil
+}
+
+func (bs *BadgerStore) CountActions(state int) (int, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return countTimedKeys(txn, []byte(actionStatePrefix(state))), nil
+}
+
+func (bs *BadgerStore) readAction(txn *badger.Txn, id string) (*mtg.Action, error) {
+	var act mtg.Action
+	found, err := readMsgpack(txn, []byte(prefixActionPayload+id), &act)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &act, nil
+}
+
+func buildActionTimedKey(act *mtg.Action) []byte {
+	key := append([]byte(actionStatePrefix(act.State)), tsToBytes(act.CreatedAt)...)
+	return append(key, act.UTXOID...)
+}
+
+func actionStatePrefix(state int) string {
+	prefix := prefixActionState
+	switch state {
+	case mtg.ActionStateInitial:
+		return prefix + "initial"
+	case mtg.ActionStateDone:
+		return prefix + "doneeee"
+	}
+	panic(state)
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"encoding/binary"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	prefixAuditEntry = "AUDIT:ENTRY:"
+	prefixAuditRound = "AUDIT:ROUND:"
+	keyAuditLast     = "AUDIT:LAST"
+)
+
+// the entry is chained to the last one in the same badger transaction, so
+// the chain never forks even with concurrent writers
+func (bs *BadgerStore) AppendAuditEntry(entry *mtg.AuditEntry) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		last, err := bs.readLastAuditEntry(txn)
+		if err != nil {
+			return err
+		}
+		entry.Chain(last)
+		key := buildAuditEntryKey(entry.Sequence)
+		err = txn.Set(key, mtg.MsgpackMarshalPanic(entry))
+		if err != nil {
+			return err
+		}
+		if entry.Consensus {
+			err = txn.Set(buildAuditRoundKey(entry.Round), key[len(prefixAuditEntry):])
+			if err != nil {
+				return err
+			}
+		}
+		return txn.Set([]byte(keyAuditLast), key[len(prefixAuditEntry):])
+	})
+}
+
+// the consensus entry of the round, the round starts from 1
+func (bs *BadgerStore) ReadAuditEntryByRound(round uint64) (*mtg.AuditEntry, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(buildAuditRoundKey(round))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	seq, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	var e mtg.AuditEntry
+	found, err := readMsgpack(txn, append([]byte(prefixAuditEntry), seq...), &e)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (bs *BadgerStore) ReadLastAuditEntry() (*mtg.AuditEntry, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return bs.readLastAuditEntry(txn)
+}
+
+func (bs *BadgerStore) ListAuditEntries(from uint64, limit int) ([]*mtg.AuditEntry, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(prefixAuditEntry)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var entries []*mtg.AuditEntry
+	for it.Seek(buildAuditEntryKey(from)); it.Valid(); it.Next() {
+		b, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		var e mtg.AuditEntry
+		err = mtg.MsgpackUnmarshal(b, &e)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &e)
+		if len(entries) == limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+func (bs *BadgerStore) readLastAuditEntry(txn *badger.Txn) (*mtg.AuditEntry, error) {
+	item, err := txn.Get([]byte(keyAuditLast))
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	seq, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	var e mtg.AuditEntry
+	found, err := readMsgpack(txn, append([]byte(prefixAuditEntry), seq...), &e)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func buildAuditEntryKey(seq uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, seq)
+	return append([]byte(prefixAuditEntry), buf...)
+}
+
+func buildAuditRoundKey(round uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, round)
+	return append([]byte(prefixAuditRound), buf...)
+}
@@ -0,0 +1,154 @@
+// Package store is the reference badger implementation of mtg.Store.
+//
+// All values are msgpack encoded, and all timestamps in keys are encoded
+// as 8 bytes big endian unix nanoseconds, so that the badger iterators
+// return them in the time order. The key schema:
+//
+//	ITERATION:PAYLOAD:{node}                              => Iteration
+//	ITERATION:QUEUE:{created}{node}                       => 1
+//
+//	OUTPUT:PAYLOAD:{utxo}                                 => Output
+//	OUTPUT:STATE:{state}{created}{utxo}                   => 1
+//	OUTPUT:ASSET:{state}{asset}{group}{created}{utxo}     => 1
+//	OUTPUT:MEMBERS:{state}{members}{threshold}{created}{utxo}
+//	OUTPUT:EPOCH:{state}{members}{threshold}{asset}{group}{created}{utxo}
+//	OUTPUT:TRANSACTION:{trace}{created}{utxo}             => 1
+//	OUTPUT:TRACE:{utxo}                                   => trace
+//
+//	ACTION:PAYLOAD:{utxo}                                 => Action
+//	ACTION:STATE:{state}{created}{utxo}                   => 1
+//
+//	TRANSACTION:PAYLOAD:{trace}                           => Transaction
+//	TRANSACTION:STATE:{state}{updated}{trace}             => 1
+//	TRANSACTION:HASH:{hash}                               => trace
+//	TRANSACTION:GROUP:{state}{group}{updated}{trace}      => 1
+//	TRANSACTION:ASSET:{state}{asset}{group}{updated}{trace}
+//
+//	COLLECTIBLES:OUTPUT:PAYLOAD:{output}                  => CollectibleOutput
+//	COLLECTIBLES:OUTPUT:STATE:{state}{created}{output}    => 1
+//	COLLECTIBLES:OUTPUT:ASSET:{state}{token}{created}{output}
+//	COLLECTIBLES:OUTPUT:TRANSACTION:{trace}{created}{output}
+//
+//	COLLECTIBLES:TRANSACTION:PAYLOAD:{trace}              => CollectibleTransaction
+//	COLLECTIBLES:TRANSACTION:STATE:{state}{updated}{trace}
+//	COLLECTIBLES:TRANSACTION:HASH:{hash}                  => trace
+//
+//	AUDIT:ENTRY:{sequence}                                => AuditEntry
+//	AUDIT:ROUND:{round}                                   => sequence
+//	AUDIT:LAST                                            => sequence
+//
+//	TIMER:PAYLOAD:{id}                                    => Timer
+//	TIMER:QUEUE:{at}{id}                                  => 1
+//
+//	DRAINED:KEY:{kind}:{updated}{utxo}                    => 1
+//	DRAINED:TIME:{updated}{kind}:{updated}{utxo}          => DRAINED:KEY
+//
+// Any other key written by WriteProperty must not start with these prefixes.
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/MixinNetwork/mixin/logger"
+	"github.com/dgraph-io/badger/v4"
+)
+
+type BadgerStore struct {
+	db *badger.DB
+}
+
+func OpenBadger(ctx context.Context, path string) (*BadgerStore, error) {
+	opts := badger.DefaultOptions(path)
+	return openBadger(ctx, opts)
+}
+
+// the memory store is only useful for tests and simulations
+func OpenMemoryBadger(ctx context.Context) (*BadgerStore, error) {
+	opts := badger.DefaultOptions("").WithInMemory(true)
+	opts = opts.WithLoggingLevel(badger.WARNING)
+	return openBadger(ctx, opts)
+}
+
+func openBadger(ctx context.Context, opts badger.Options) (*BadgerStore, error) {
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.InMemory {
+		go runValueLogGC(ctx, db)
+	}
+
+	return &BadgerStore{
+		db: db,
+	}, nil
+}
+
+func runValueLogGC(ctx context.Context, db *badger.DB) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Minute):
+		}
+		if db.IsClosed() {
+			return
+		}
+		lsm, vlog := db.Size()
+		logger.Printf("Badger LSM %d VLOG %d\n", lsm, vlog)
+		if lsm > 1024*1024*8 || vlog > 1024*1024*32 {
+			err := db.RunValueLogGC(0.5)
+			logger.Printf("Badger RunValueLogGC %v\n", err)
+		}
+	}
+}
+
+func (bs *BadgerStore) Close() error {
+	return bs.db.Close()
+}
+
+func (bs *BadgerStore) Badger() *badger.DB {
+	return bs.db
+}
+
+func (bs *BadgerStore) WriteProperty(key, val []byte) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return txn.Set(key, val)
+	})
+}
+
+// the properties with the prefix, which must not be any prefix of the
+// other keys in the schema
+func (bs *BadgerStore) ListProperties(prefix []byte) (map[string][]byte, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	props := make(map[string][]byte)
+	for it.Seek(opts.Prefix); it.Valid(); it.Next() {
+		val, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		props[string(it.Item().KeyCopy(nil))] = val
+	}
+	return props, nil
+}
+
+func (bs *BadgerStore) ReadProperty(key []byte) ([]byte, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return item.ValueCopy(nil)
+}
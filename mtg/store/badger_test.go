@@ -0,0 +1,35 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/MixinNetwork/trusted-group/mtg/store/storetest"
+)
+
+var (
+	_ mtg.Store            = (*BadgerStore)(nil)
+	_ mtg.EpochOutputStore = (*BadgerStore)(nil)
+	_ mtg.EpochAssetStore  = (*BadgerStore)(nil)
+	_ mtg.OutputStateStore = (*BadgerStore)(nil)
+	_ mtg.AtomicStore      = (*BadgerStore)(nil)
+	_ mtg.AuditStore       = (*BadgerStore)(nil)
+	_ mtg.PropertyStore    = (*BadgerStore)(nil)
+	_ mtg.DrainStore       = (*BadgerStore)(nil)
+	_ mtg.CountStore       = (*BadgerStore)(nil)
+	_ mtg.QueryStore       = (*BadgerStore)(nil)
+	_ mtg.TimerStore       = (*BadgerStore)(nil)
+	_ mtg.ActionStore      = (*BadgerStore)(nil)
+)
+
+func TestBadgerStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) mtg.Store {
+		bs, err := OpenMemoryBadger(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { bs.Close() })
+		return bs
+	})
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	prefixCollectibleOutputPayload     = "COLLECTIBLES:OUTPUT:PAYLOAD:"
+	prefixCollectibleOutputState       = "COLLECTIBLES:OUTPUT:STATE:"
+	prefixCollectibleOutputTransaction = "COLLECTIBLES:OUTPUT:TRANSACTION:"
+	prefixCollectibleOutputToken       = "COLLECTIBLES:OUTPUT:ASSET:"
+
+	prefixCollectibleTransactionPayload = "COLLECTIBLES:TRANSACTION:PAYLOAD:"
+	prefixCollectibleTransactionState   = "COLLECTIBLES:TRANSACTION:STATE:"
+	prefixCollectibleTransactionHash    = "COLLECTIBLES:TRANSACTION:HASH:"
+)
+
+func (bs *BadgerStore) WriteCollectibleOutput(out *mtg.CollectibleOutput, traceId string) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return bs.writeCollectibleOutput(txn, out, traceId)
+	})
+}
+
+func (bs *BadgerStore) WriteCollectibleOutputs(outs []*mtg.CollectibleOutput, traceId string) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		for _, out := range outs {
+			err := bs.writeCollectibleOutput(txn, out, traceId)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BadgerStore) ListCollectibleOutputsForTransaction(traceId string) ([]*mtg.CollectibleOutput, error) {
+	prefix := prefixCollectibleOutputTransaction + traceId
+	return bs.listCollectibleOutputs(prefix, 0)
+}
+
+func (bs *BadgerStore) ListCollectibleOutputsForToken(state, tokenId string, limit int) ([]*mtg.CollectibleOutput, error) {
+	prefix := prefixCollectibleOutputToken + state + tokenId
+	return bs.listCollectibleOutputs(prefix, limit)
+}
+
+func (bs *BadgerStore) WriteCollectibleTransaction(traceId string, tx *mtg.CollectibleTransaction) error {
+	if traceId != tx.TraceId {
+		return fmt.Errorf("invalid collectible transaction trace %s %s", traceId, tx.TraceId)
+	}
+	return bs.db.Update(func(txn *badger.Txn) error {
+		old, err := bs.readCollectibleTransaction(txn, tx.TraceId)
+		if err != nil {
+			return err
+		}
+		if old != nil && old.State >= tx.State {
+			return nil
+		}
+		if old != nil {
+			err = txn.Delete(buildCollectibleTransactionTimedKey(old))
+			if err != nil {
+				return err
+			}
+		}
+
+		key := []byte(prefixCollectibleTransactionPayload + tx.TraceId)
+		err = txn.Set(key, mtg.MsgpackMarshalPanic(tx))
+		if err != nil {
+			return err
+		}
+		if len(tx.Raw) > 0 {
+			if !tx.Hash.HasValue() {
+				return fmt.Errorf("invalid collectible transaction hash %s", tx.TraceId)
+			}
+			key = []byte(prefixCollectibleTransactionHash + tx.Hash.String())
+			err = txn.Set(key, []byte(tx.TraceId))
+			if err != nil {
+				return err
+			}
+		}
+		return txn.Set(buildCollectibleTransactionTimedKey(tx), []byte{1})
+	})
+}
+
+func (bs *BadgerStore) ReadCollectibleTransaction(traceId string) (*mtg.CollectibleTransaction, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return bs.readCollectibleTransaction(txn, traceId)
+}
+
+func (bs *BadgerStore) ReadCollectibleTransactionByHash(hash crypto.Hash) (*mtg.CollectibleTransaction, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	traceId, err := readTraceIdByHash(txn, prefixCollectibleTransactionHash, hash)
+	if err != nil || traceId == "" {
+		return nil, err
+	}
+	return bs.readCollectibleTransaction(txn, traceId)
+}
+
+func (bs *BadgerStore) CountCollectibleTransactions(state int) (int, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return countTimedKeys(txn, []byte(collectibleTransactionStatePrefix(state))), nil
+}
+
+func (bs *BadgerStore) ListCollectibleTransactions(state int, limit int) ([]*mtg.CollectibleTransaction, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	prefix := []byte(collectibleTransactionStatePrefix(state))
+	var txs []*mtg.CollectibleTransaction
+	for _, id := range listTimedIds(txn, prefix, 0, limit) {
+		tx, err := bs.readCollectibleTransaction(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+func (bs *BadgerStore) listCollectibleOutputs(prefix string, limit int) ([]*mtg.CollectibleOutput, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	var outputs []*mtg.CollectibleOutput
+	for _, id := range listTimedIds(txn, []byte(prefix), uuidSize, limit) {
+		out, err := bs.readCollectibleOutput(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+func (bs *BadgerStore) writeCollectibleOutput(txn *badger.Txn, utxo *mtg.CollectibleOutput, traceId string) error {
+	old, err := bs.readCollectibleOutput(txn, utxo.OutputId)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		switch {
+		case old.State == utxo.State:
+			return nil
+		case old.State > utxo.State:
+			return fmt.Errorf("invalid collectible output state %s %d %d", old.OutputId, old.State, utxo.State)
+		case old.SignedBy != "" && old.SignedBy != utxo.SignedBy:
+			return fmt.Errorf("invalid collectible output signer %s %s %s", old.OutputId, old.SignedBy, utxo.SignedBy)
+		}
+		for _, prefix := range []string{prefixCollectibleOutputState, prefixCollectibleOutputToken, prefixCollectibleOutputTransaction} {
+			err = txn.Delete(buildCollectibleOutputTimedKey(old, prefix, traceId))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	key := []byte(prefixCollectibleOutputPayload + utxo.OutputId)
+	err = txn.Set(key, mtg.MsgpackMarshalPanic(utxo))
+	if err != nil {
+		return err
+	}
+	err = txn.Set(buildCollectibleOutputTimedKey(utxo, prefixCollectibleOutputState, traceId), []byte{1})
+	if err != nil {
+		return err
+	}
+	err = txn.Set(buildCollectibleOutputTimedKey(utxo, prefixCollectibleOutputToken, traceId), []byte{1})
+	if err != nil {
+		return err
+	}
+
+	if traceId == "" {
+		return nil
+	}
+	return txn.Set(buildCollectibleOutputTimedKey(utxo, prefixCollectibleOutputTransaction, traceId), []byte{1})
+}
+
+func (bs *BadgerStore) readCollectibleOutput(txn *badger.Txn, id string) (*mtg.CollectibleOutput, error) {
+	var utxo mtg.CollectibleOutput
+	found, err := readMsgpack(txn, []byte(prefixCollectibleOutputPayload+id), &utxo)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &utxo, nil
+}
+
+func buildCollectibleOutputTimedKey(out *mtg.CollectibleOutput, prefix string, traceId string) []byte {
+	switch prefix {
+	case prefixCollectibleOutputState:
+		prefix = prefix + out.StateName()
+	case prefixCollectibleOutputToken:
+		prefix = prefix + out.StateName() + out.TokenId
+	case prefixCollectibleOutputTransaction:
+		prefix = prefix + traceId
+	default:
+		panic(prefix)
+	}
+	key := append([]byte(prefix), tsToBytes(out.CreatedAt)...)
+	return append(key, out.OutputId...)
+}
+
+func (bs *BadgerStore) readCollectibleTransaction(txn *badger.Txn, traceId string) (*mtg.CollectibleTransaction, error) {
+	var tx mtg.CollectibleTransaction
+	found, err := readMsgpack(txn, []byte(prefixCollectibleTransactionPayload+traceId), &tx)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+func buildCollectibleTransactionTimedKey(tx *mtg.CollectibleTransaction) []byte {
+	key := append([]byte(collectibleTransactionStatePrefix(tx.State)), tsToBytes(tx.UpdatedAt)...)
+	return append(key, tx.TraceId...)
+}
+
+func collectibleTransactionStatePrefix(state int) string {
+	prefix := prefixCollectibleTransactionState
+	switch state {
+	case mtg.TransactionStateInitial:
+		return prefix + "initiall"
+	case mtg.TransactionStateSigning:
+		return prefix + "signingg"
+	case mtg.TransactionStateSigned:
+		return prefix + "signeddd"
+	case mtg.TransactionStateSnapshot:
+		return prefix + "snapshot"
+	}
+	panic(state)
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	prefixDrainedKey  = "DRAINED:KEY:"
+	prefixDrainedTime = "DRAINED:TIME:"
+)
+
+func (bs *BadgerStore) ReadDrainedOutput(kind, id string, updatedAt time.Time) (bool, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	_, err := txn.Get(buildDrainedKey(kind, id, updatedAt))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (bs *BadgerStore) WriteDrainedOutput(kind, id string, updatedAt time.Time) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		key := buildDrainedKey(kind, id, updatedAt)
+		err := txn.Set(key, []byte{1})
+		if err != nil {
+			return err
+		}
+		idx := append([]byte(prefixDrainedTime), tsToBytes(updatedAt)...)
+		idx = append(idx, key[len(prefixDrainedKey):]...)
+		return txn.Set(idx, key)
+	})
+}
+
+// delete at most limit drained outputs updated before the time, and the
+// deleted count is returned, so the caller prunes again when it's limit
+func (bs *BadgerStore) PruneDrainedOutputs(before time.Time, limit int) (int, error) {
+	var count int
+	err := bs.db.Update(func(txn *badger.Txn) error {
+		keys, err := listDrainedKeys(txn, before, limit)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			err = txn.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		count = len(keys) / 2
+		return nil
+	})
+	return count, err
+}
+
+// both the time index keys and the drained keys are returned
+func listDrainedKeys(txn *badger.Txn, before time.Time, limit int) ([][]byte, error) {
+	opts := badger.DefaultIteratorOptions
+	opts.Prefix = []byte(prefixDrainedTime)
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	end := append([]byte(prefixDrainedTime), tsToBytes(before)...)
+	var keys [][]byte
+	for it.Seek(opts.Prefix); it.Valid() && len(keys) < limit*2; it.Next() {
+		idx := it.Item().KeyCopy(nil)
+		if bytes.Compare(idx[:len(end)], end) >= 0 {
+			break
+		}
+		key, err := it.Item().ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, idx, key)
+	}
+	return keys, nil
+}
+
+func buildDrainedKey(kind, id string, updatedAt time.Time) []byte {
+	key := append([]byte(prefixDrainedKey), kind...)
+	key = append(key, ':')
+	key = append(key, tsToBytes(updatedAt)...)
+	return append(key, id...)
+}
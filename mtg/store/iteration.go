@@ -0,0 +1,79 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	prefixIterationPayload = "ITERATION:PAYLOAD:"
+	prefixIterationQueue   = "ITERATION:QUEUE:"
+)
+
+// only the latest iteration of each node is kept, and a node removed
+// could not join the group again with the same id
+func (bs *BadgerStore) WriteIteration(ir *mtg.Iteration) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		olds, err := bs.listIterations(txn)
+		if err != nil {
+			return err
+		}
+		if l := len(olds); l > 0 && olds[l-1].CreatedAt.After(ir.CreatedAt) {
+			return fmt.Errorf("invalid iteration timestamp %s %s", ir.CreatedAt, olds[l-1].CreatedAt)
+		}
+		old, err := bs.readIteration(txn, ir.NodeId)
+		if err != nil {
+			return err
+		}
+		if old != nil && old.Action >= ir.Action {
+			return nil
+		}
+		if old != nil {
+			err = txn.Delete(buildIterationTimedKey(old))
+			if err != nil {
+				return err
+			}
+		}
+		err = txn.Set(buildIterationTimedKey(ir), []byte{1})
+		if err != nil {
+			return err
+		}
+		key := []byte(prefixIterationPayload + ir.NodeId)
+		return txn.Set(key, mtg.MsgpackMarshalPanic(ir))
+	})
+}
+
+func (bs *BadgerStore) ListIterations() ([]*mtg.Iteration, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return bs.listIterations(txn)
+}
+
+func (bs *BadgerStore) listIterations(txn *badger.Txn) ([]*mtg.Iteration, error) {
+	var irs []*mtg.Iteration
+	for _, id := range listTimedIds(txn, []byte(prefixIterationQueue), 0, 0) {
+		ir, err := bs.readIteration(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		irs = append(irs, ir)
+	}
+	return irs, nil
+}
+
+func (bs *BadgerStore) readIteration(txn *badger.Txn, id string) (*mtg.Iteration, error) {
+	var ir mtg.Iteration
+	found, err := readMsgpack(txn, []byte(prefixIterationPayload+id), &ir)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &ir, nil
+}
+
+func buildIterationTimedKey(ir *mtg.Iteration) []byte {
+	key := append([]byte(prefixIterationQueue), tsToBytes(ir.CreatedAt)...)
+	return append(key, ir.NodeId...)
+}
@@ -0,0 +1,271 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/dgraph-io/badger/v4"
+	"github.com/fox-one/mixin-sdk-go"
+)
+
+const (
+	prefixOutputPayload     = "OUTPUT:PAYLOAD:"
+	prefixOutputTrace       = "OUTPUT:TRACE:"
+	prefixOutputState       = "OUTPUT:STATE:"
+	prefixOutputGroupAsset  = "OUTPUT:ASSET:"
+	prefixOutputMembers     = "OUTPUT:MEMBERS:"
+	prefixOutputEpochAsset  = "OUTPUT:EPOCH:"
+	prefixOutputTransaction = "OUTPUT:TRANSACTION:"
+
+	uuidSize = 36
+)
+
+func (bs *BadgerStore) WriteOutput(utxo *mtg.Output, traceId string) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return bs.writeOutput(txn, utxo, traceId)
+	})
+}
+
+func (bs *BadgerStore) WriteOutputs(utxos []*mtg.Output, traceId string) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		for _, utxo := range utxos {
+			err := bs.writeOutput(txn, utxo, traceId)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (bs *BadgerStore) ListOutputsForTransaction(traceId string) ([]*mtg.Output, error) {
+	prefix := prefixOutputTransaction + traceId
+	return bs.listOutputs(prefix, 0)
+}
+
+func (bs *BadgerStore) ListOutputsForAsset(groupId, state, assetId string, limit int) ([]*mtg.Output, error) {
+	prefix := prefixOutputGroupAsset + state + assetId + groupId
+	return bs.listOutputs(prefix, limit)
+}
+
+// the outputs of the group id exactly, ordered by the created time
+func (bs *BadgerStore) ListOutputsForAssetAfter(groupId, state, assetId string, cursor string, limit int) ([]*mtg.Output, string, error) {
+	prefix := prefixOutputGroupAsset + state + assetId + groupId
+	return bs.listOutputsAfter(prefix, cursor, limit)
+}
+
+// the outputs of all group ids and assets, ordered by the created time
+func (bs *BadgerStore) ListOutputsForStateAfter(state string, cursor string, limit int) ([]*mtg.Output, string, error) {
+	prefix := prefixOutputState + state
+	return bs.listOutputsAfter(prefix, cursor, limit)
+}
+
+func (bs *BadgerStore) ListOutputsForState(state string, limit int) ([]*mtg.Output, error) {
+	prefix := prefixOutputState + state
+	return bs.listOutputs(prefix, limit)
+}
+
+// the outputs of an epoch, i.e. the members and threshold, of all group ids
+// and assets ordered by the created time
+func (bs *BadgerStore) ListOutputsForMembers(membersHash string, threshold int, state string, limit int) ([]*mtg.Output, error) {
+	prefix := prefixOutputMembers + state + membersHash + fmt.Sprintf("%03d", threshold)
+	return bs.listOutputs(prefix, limit)
+}
+
+// count the outputs of an epoch by group id and asset, only the keys are
+// iterated, and the group id is between the asset and the timestamp
+func (bs *BadgerStore) CountOutputsForMembers(membersHash string, threshold int, state string) ([]*mtg.AssetOutputs, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = []byte(prefixOutputEpochAsset + state + membersHash + fmt.Sprintf("%03d", threshold))
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	counts := make(map[[2]string]*mtg.AssetOutputs)
+	for it.Seek(opts.Prefix); it.Valid(); it.Next() {
+		key := it.Item().Key()
+		if len(key) < len(opts.Prefix)+uuidSize+8+uuidSize {
+			continue
+		}
+		assetId := string(key[len(opts.Prefix) : len(opts.Prefix)+uuidSize])
+		groupId := string(key[len(opts.Prefix)+uuidSize : len(key)-8-uuidSize])
+		k := [2]string{groupId, assetId}
+		if counts[k] == nil {
+			counts[k] = &mtg.AssetOutputs{GroupId: groupId, AssetId: assetId}
+		}
+		counts[k].Count++
+	}
+	outputs := make([]*mtg.AssetOutputs, 0, len(counts))
+	for _, c := range counts {
+		outputs = append(outputs, c)
+	}
+	sort.Slice(outputs, func(i, j int) bool {
+		if outputs[i].GroupId != outputs[j].GroupId {
+			return outputs[i].GroupId < outputs[j].GroupId
+		}
+		return outputs[i].AssetId < outputs[j].AssetId
+	})
+	return outputs, nil
+}
+
+// the outputs of an epoch, the group id exactly and asset, ordered by the
+// created time
+func (bs *BadgerStore) ListOutputsForMembersAsset(membersHash string, threshold int, state, groupId, assetId string, limit int) ([]*mtg.Output, error) {
+	prefix := prefixOutputEpochAsset + state + membersHash + fmt.Sprintf("%03d", threshold) + assetId + groupId
+	return bs.listOutputs(prefix, limit)
+}
+
+func (bs *BadgerStore) listOutputs(prefix string, limit int) ([]*mtg.Output, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	var outputs []*mtg.Output
+	for _, id := range listTimedIds(txn, []byte(prefix), uuidSize, limit) {
+		out, err := bs.readOutput(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, nil
+}
+
+func (bs *BadgerStore) listOutputsAfter(prefix string, cursor string, limit int) ([]*mtg.Output, string, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	ids, next, err := listTimedIdsAfter(txn, []byte(prefix), uuidSize, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	var outputs []*mtg.Output
+	for _, id := range ids {
+		out, err := bs.readOutput(txn, id)
+		if err != nil {
+			return nil, "", err
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, next, nil
+}
+
+func (bs *BadgerStore) writeOutput(txn *badger.Txn, utxo *mtg.Output, traceId string) error {
+	old, err := bs.readOutput(txn, utxo.UTXOID)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		switch {
+		case old.State == mtg.OutputStateSigned && utxo.State == mtg.OutputStateUnspent:
+		case old.State > utxo.State:
+			return fmt.Errorf("invalid output state %s %d %d", old.UTXOID, old.State, utxo.State)
+		case old.State == utxo.State && old.SignedTx == utxo.SignedTx:
+			return nil
+		}
+		err = bs.resetOldOutput(txn, old)
+		if err != nil {
+			return err
+		}
+	}
+
+	key := []byte(prefixOutputPayload + utxo.UTXOID)
+	err = txn.Set(key, mtg.MsgpackMarshalPanic(utxo))
+	if err != nil {
+		return err
+	}
+	err = txn.Set(buildOutputTimedKey(utxo, prefixOutputState, ""), []byte{1})
+	if err != nil {
+		return err
+	}
+	err = txn.Set(buildOutputTimedKey(utxo, prefixOutputGroupAsset, ""), []byte{1})
+	if err != nil {
+		return err
+	}
+	err = txn.Set(buildOutputTimedKey(utxo, prefixOutputMembers, ""), []byte{1})
+	if err != nil {
+		return err
+	}
+	err = txn.Set(buildOutputTimedKey(utxo, prefixOutputEpochAsset, ""), []byte{1})
+	if err != nil {
+		return err
+	}
+
+	if traceId == "" {
+		return nil
+	}
+	err = txn.Set([]byte(prefixOutputTrace+utxo.UTXOID), []byte(traceId))
+	if err != nil {
+		return err
+	}
+	return txn.Set(buildOutputTimedKey(utxo, prefixOutputTransaction, traceId), []byte{1})
+}
+
+func (bs *BadgerStore) resetOldOutput(txn *badger.Txn, old *mtg.Output) error {
+	err := txn.Delete(buildOutputTimedKey(old, prefixOutputState, ""))
+	if err != nil {
+		return err
+	}
+	err = txn.Delete(buildOutputTimedKey(old, prefixOutputGroupAsset, ""))
+	if err != nil {
+		return err
+	}
+	err = txn.Delete(buildOutputTimedKey(old, prefixOutputMembers, ""))
+	if err != nil {
+		return err
+	}
+	err = txn.Delete(buildOutputTimedKey(old, prefixOutputEpochAsset, ""))
+	if err != nil {
+		return err
+	}
+
+	key := []byte(prefixOutputTrace + old.UTXOID)
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	traceId, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+	err = txn.Delete(key)
+	if err != nil {
+		return err
+	}
+	return txn.Delete(buildOutputTimedKey(old, prefixOutputTransaction, string(traceId)))
+}
+
+func (bs *BadgerStore) readOutput(txn *badger.Txn, id string) (*mtg.Output, error) {
+	var utxo mtg.Output
+	found, err := readMsgpack(txn, []byte(prefixOutputPayload+id), &utxo)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &utxo, nil
+}
+
+func buildOutputTimedKey(out *mtg.Output, prefix string, traceId string) []byte {
+	switch prefix {
+	case prefixOutputState:
+		prefix = prefix + out.StateName()
+	case prefixOutputGroupAsset:
+		prefix = prefix + out.StateName() + out.AssetID + out.GroupId
+	case prefixOutputMembers:
+		members := mixin.HashMembers(append([]string{}, out.Members...))
+		prefix = prefix + out.StateName() + members + fmt.Sprintf("%03d", out.Threshold)
+	case prefixOutputEpochAsset:
+		members := mixin.HashMembers(append([]string{}, out.Members...))
+		prefix = prefix + out.StateName() + members + fmt.Sprintf("%03d", out.Threshold) + out.AssetID + out.GroupId
+	case prefixOutputTransaction:
+		prefix = prefix + traceId
+	default:
+		panic(prefix)
+	}
+	key := append([]byte(prefix), tsToBytes(out.CreatedAt)...)
+	return append(key, out.UTXOID...)
+}
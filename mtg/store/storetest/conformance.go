@@ -0,0 +1,935 @@
+// Package storetest is the conformance test suite for mtg.Store, any
+// implementation should pass all the tests to be used by mtg.Group.
+package storetest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/fox-one/mixin-sdk-go"
+	"github.com/gofrs/uuid/v5"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+// the open function must return an empty store for each call
+func Run(t *testing.T, open func(t *testing.T) mtg.Store) {
+	tests := []struct {
+		name string
+		test func(*testing.T, mtg.Store)
+	}{
+		{"Property", testProperty},
+		{"Iteration", testIteration},
+		{"Output", testOutput},
+		{"Action", testAction},
+		{"Transaction", testTransaction},
+		{"OutputsAndTransaction", testOutputsAndTransaction},
+		{"Collectible", testCollectible},
+		{"Audit", testAudit},
+		{"Drained", testDrained},
+		{"OutputState", testOutputState},
+		{"EpochOutput", testEpochOutput},
+		{"EpochAsset", testEpochAsset},
+		{"Count", testCount},
+		{"Query", testQuery},
+		{"Timer", testTimer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+func testProperty(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+
+	val, err := store.ReadProperty([]byte("property"))
+	require.Nil(err)
+	require.Nil(val)
+
+	err = store.WriteProperty([]byte("property"), []byte("value"))
+	require.Nil(err)
+	val, err = store.ReadProperty([]byte("property"))
+	require.Nil(err)
+	require.Equal([]byte("value"), val)
+
+	err = store.WriteProperty([]byte("property:a"), []byte("a"))
+	require.Nil(err)
+	err = store.WriteProperty([]byte("other:b"), []byte("b"))
+	require.Nil(err)
+	ps, ok := store.(mtg.PropertyStore)
+	if !ok {
+		t.Skip("mtg.PropertyStore not implemented")
+	}
+	props, err := ps.ListProperties([]byte("property"))
+	require.Nil(err)
+	require.Equal(map[string][]byte{"property": []byte("value"), "property:a": []byte("a")}, props)
+}
+
+func testIteration(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+
+	epoch := time.Unix(0, 1000)
+	a, b := newUUID(), newUUID()
+	for _, id := range []string{a, b} {
+		err := store.WriteIteration(&mtg.Iteration{Action: mtg.IterationActionAdd, NodeId: id, Threshold: 1, CreatedAt: epoch})
+		require.Nil(err)
+	}
+	err := store.WriteIteration(&mtg.Iteration{Action: mtg.IterationActionAdd, NodeId: a, Threshold: 1, CreatedAt: epoch})
+	require.Nil(err)
+	irs, err := store.ListIterations()
+	require.Nil(err)
+	require.Len(irs, 2)
+
+	err = store.WriteIteration(&mtg.Iteration{Action: mtg.IterationActionRemove, NodeId: b, Threshold: 1, CreatedAt: epoch.Add(time.Second)})
+	require.Nil(err)
+	irs, err = store.ListIterations()
+	require.Nil(err)
+	require.Len(irs, 2)
+	last := irs[len(irs)-1]
+	require.Equal(b, last.NodeId)
+	require.Equal(mtg.IterationActionRemove, last.Action)
+	require.True(last.CreatedAt.Equal(epoch.Add(time.Second)))
+}
+
+func testOutput(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+
+	groupId, assetId, traceId := newUUID(), newUUID(), newUUID()
+	var outputs []*mtg.Output
+	for i := 0; i < 5; i++ {
+		out := newOutput(groupId, assetId, time.Unix(0, int64(5-i)*1000))
+		err := store.WriteOutput(out, "")
+		require.Nil(err)
+		outputs = append(outputs, out)
+	}
+	err := store.WriteOutput(newOutput(newUUID(), assetId, time.Now()), "")
+	require.Nil(err)
+
+	unspent, err := store.ListOutputsForAsset(groupId, mixin.UTXOStateUnspent, assetId, 0)
+	require.Nil(err)
+	require.Len(unspent, 5)
+	for i := 1; i < len(unspent); i++ {
+		require.True(unspent[i-1].CreatedAt.Before(unspent[i].CreatedAt))
+	}
+	unspent, err = store.ListOutputsForAsset(groupId, mixin.UTXOStateUnspent, assetId, 2)
+	require.Nil(err)
+	require.Len(unspent, 2)
+	require.Equal(outputs[4].UTXOID, unspent[0].UTXOID)
+
+	signed := outputs[:2]
+	for _, out := range signed {
+		out.State = mtg.OutputStateSigned
+		out.SignedBy = crypto.NewHash([]byte(traceId)).String()
+		out.SignedTx = "raw"
+	}
+	err = store.WriteOutputs(signed, traceId)
+	require.Nil(err)
+	unspent, err = store.ListOutputsForAsset(groupId, mixin.UTXOStateUnspent, assetId, 0)
+	require.Nil(err)
+	require.Len(unspent, 3)
+	listed, err := store.ListOutputsForTransaction(traceId)
+	require.Nil(err)
+	require.Len(listed, 2)
+
+	spent := *signed[0]
+	spent.State = mtg.OutputStateSpent
+	err = store.WriteOutput(&spent, traceId)
+	require.Nil(err)
+	listed, err = store.ListOutputsForTransaction(traceId)
+	require.Nil(err)
+	require.Len(listed, 2)
+	listed, err = store.ListOutputsForAsset(groupId, mixin.UTXOStateSpent, assetId, 0)
+	require.Nil(err)
+	require.Len(listed, 1)
+	require.Equal(mtg.OutputStateSpent, listed[0].State)
+
+	unlocked := *signed[1]
+	unlocked.State = mtg.OutputStateUnspent
+	unlocked.SignedBy = ""
+	unlocked.SignedTx = ""
+	err = store.WriteOutput(&unlocked, "")
+	require.Nil(err)
+	unspent, err = store.ListOutputsForAsset(groupId, mixin.UTXOStateUnspent, assetId, 0)
+	require.Nil(err)
+	require.Len(unspent, 4)
+	listed, err = store.ListOutputsForTransaction(traceId)
+	require.Nil(err)
+	require.Len(listed, 1)
+
+	err = store.WriteOutput(&unlocked, "")
+	require.Nil(err)
+	unspent, err = store.ListOutputsForAsset(groupId, mixin.UTXOStateUnspent, assetId, 0)
+	require.Nil(err)
+	require.Len(unspent, 4)
+
+	err = store.WriteOutput(signed[0], traceId)
+	require.NotNil(err)
+}
+
+func testOutputState(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	ss, ok := store.(mtg.OutputStateStore)
+	if !ok {
+		t.Skip("mtg.OutputStateStore not implemented")
+	}
+
+	var outputs []*mtg.Output
+	for i := 0; i < 3; i++ {
+		out := newOutput(newUUID(), newUUID(), time.Unix(0, int64(3-i)*1000))
+		err := store.WriteOutput(out, "")
+		require.Nil(err)
+		outputs = append(outputs, out)
+	}
+	all, err := ss.ListOutputsForState(mixin.UTXOStateUnspent, 0)
+	require.Nil(err)
+	require.Len(all, 3)
+	require.Equal(outputs[2].UTXOID, all[0].UTXOID)
+
+	outputs[0].State = mtg.OutputStateSigned
+	outputs[0].SignedTx = "raw"
+	err = store.WriteOutput(outputs[0], newUUID())
+	require.Nil(err)
+	all, err = ss.ListOutputsForState(mixin.UTXOStateUnspent, 1)
+	require.Nil(err)
+	require.Len(all, 1)
+	all, err = ss.ListOutputsForState(mixin.UTXOStateSigned, 0)
+	require.Nil(err)
+	require.Len(all, 1)
+	require.Equal(outputs[0].UTXOID, all[0].UTXOID)
+}
+
+func testEpochOutput(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	es, ok := store.(mtg.EpochOutputStore)
+	if !ok {
+		t.Skip("mtg.EpochOutputStore not implemented")
+	}
+
+	members := []string{newUUID(), newUUID(), newUUID()}
+	hash := mixin.HashMembers(append([]string{}, members...))
+	var outputs []*mtg.Output
+	for i := 0; i < 4; i++ {
+		out := newOutput(newUUID(), newUUID(), time.Unix(0, int64(4-i)*1000))
+		out.Members, out.Threshold = members, 2
+		if i == 3 {
+			out.Threshold = 3
+		}
+		err := store.WriteOutput(out, "")
+		require.Nil(err)
+		outputs = append(outputs, out)
+	}
+	err := store.WriteOutput(newOutput(newUUID(), newUUID(), time.Unix(0, 1)), "")
+	require.Nil(err)
+
+	listed, err := es.ListOutputsForMembers(hash, 2, mixin.UTXOStateUnspent, 0)
+	require.Nil(err)
+	require.Len(listed, 3)
+	require.Equal(outputs[2].UTXOID, listed[0].UTXOID)
+	listed, err = es.ListOutputsForMembers(hash, 2, mixin.UTXOStateUnspent, 2)
+	require.Nil(err)
+	require.Len(listed, 2)
+	listed, err = es.ListOutputsForMembers(hash, 3, mixin.UTXOStateUnspent, 0)
+	require.Nil(err)
+	require.Len(listed, 1)
+
+	outputs[0].State = mtg.OutputStateSpent
+	outputs[0].SignedTx = "raw"
+	err = store.WriteOutput(outputs[0], newUUID())
+	require.Nil(err)
+	listed, err = es.ListOutputsForMembers(hash, 2, mixin.UTXOStateUnspent, 0)
+	require.Nil(err)
+	require.Len(listed, 2)
+	listed, err = es.ListOutputsForMembers(hash, 2, mixin.UTXOStateSpent, 0)
+	require.Nil(err)
+	require.Len(listed, 1)
+	require.Equal(outputs[0].UTXOID, listed[0].UTXOID)
+}
+
+func testEpochAsset(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	es, ok := store.(mtg.EpochAssetStore)
+	if !ok {
+		t.Skip("mtg.EpochAssetStore not implemented")
+	}
+
+	members := []string{newUUID(), newUUID(), newUUID()}
+	hash := mixin.HashMembers(append([]string{}, members...))
+	groupId, assetId := newUUID(), newUUID()
+	var outputs []*mtg.Output
+	for i := 0; i < 5; i++ {
+		out := newOutput(groupId, assetId, time.Unix(0, int64(5-i)*1000))
+		if i == 4 {
+			out.GroupId = ""
+		}
+		out.Members, out.Threshold = members, 2
+		err := store.WriteOutput(out, "")
+		require.Nil(err)
+		outputs = append(outputs, out)
+	}
+	other := newOutput(groupId, assetId, time.Unix(0, 1))
+	other.Members, other.Threshold = members, 3
+	err := store.WriteOutput(other, "")
+	require.Nil(err)
+
+	counts, err := es.CountOutputsForMembers(hash, 2, mixin.UTXOStateUnspent)
+	require.Nil(err)
+	require.Len(counts, 2)
+	require.Equal(mtg.AssetOutputs{GroupId: "", AssetId: assetId, Count: 1}, *counts[0])
+	require.Equal(mtg.AssetOutputs{GroupId: groupId, AssetId: assetId, Count: 4}, *counts[1])
+	listed, err := es.ListOutputsForMembersAsset(hash, 2, mixin.UTXOStateUnspent, groupId, assetId, 2)
+	require.Nil(err)
+	require.Len(listed, 2)
+	require.Equal(outputs[3].UTXOID, listed[0].UTXOID)
+	listed, err = es.ListOutputsForMembersAsset(hash, 2, mixin.UTXOStateUnspent, "", assetId, 0)
+	require.Nil(err)
+	require.Len(listed, 1)
+	require.Equal(outputs[4].UTXOID, listed[0].UTXOID)
+
+	outputs[0].State = mtg.OutputStateSpent
+	outputs[0].SignedTx = "raw"
+	err = store.WriteOutput(outputs[0], newUUID())
+	require.Nil(err)
+	counts, err = es.CountOutputsForMembers(hash, 2, mixin.UTXOStateUnspent)
+	require.Nil(err)
+	require.Equal(3, counts[1].Count)
+	counts, err = es.CountOutputsForMembers(hash, 2, mixin.UTXOStateSpent)
+	require.Nil(err)
+	require.Len(counts, 1)
+	require.Equal(1, counts[0].Count)
+}
+
+func testAction(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+
+	groupId, assetId := newUUID(), newUUID()
+	var outputs []*mtg.Output
+	for i := 0; i < 3; i++ {
+		out := newOutput(groupId, assetId, time.Unix(0, int64(3-i)*1000))
+		err := store.WriteOutput(out, "")
+		require.Nil(err)
+		err = store.WriteAction(&mtg.Action{UTXOID: out.UTXOID, CreatedAt: out.CreatedAt, State: mtg.ActionStateInitial})
+		require.Nil(err)
+		outputs = append(outputs, out)
+	}
+
+	actions, err := store.ListActions(2)
+	require.Nil(err)
+	require.Len(actions, 2)
+	require.Equal(mtg.OutputTypeMultisig, actions[0].Type)
+	require.Equal(outputs[2].UTXOID, actions[0].UniqueId())
+	require.Equal(outputs[1].UTXOID, actions[1].UniqueId())
+
+	out := outputs[2]
+	err = store.WriteAction(&mtg.Action{UTXOID: out.UTXOID, CreatedAt: out.CreatedAt, State: mtg.ActionStateDone})
+	require.Nil(err)
+	err = store.WriteAction(&mtg.Action{UTXOID: out.UTXOID, CreatedAt: out.CreatedAt, State: mtg.ActionStateInitial})
+	require.Nil(err)
+	actions, err = store.ListActions(0)
+	require.Nil(err)
+	require.Len(actions, 2)
+	require.Equal(outputs[1].UTXOID, actions[0].UniqueId())
+
+	out = outputs[1]
+	err = store.WriteAction(&mtg.Action{UTXOID: out.UTXOID, CreatedAt: time.Unix(0, 5000), State: mtg.ActionStateInitial})
+	require.Nil(err)
+	err = store.WriteAction(&mtg.Action{UTXOID: out.UTXOID, CreatedAt: out.CreatedAt, State: mtg.ActionStateInitial})
+	require.Nil(err)
+	actions, err = store.ListActions(0)
+	require.Nil(err)
+	require.Len(actions, 2)
+	require.Equal(outputs[0].UTXOID, actions[0].UniqueId())
+	require.Equal(outputs[1].UTXOID, actions[1].UniqueId())
+
+	as, ok := store.(mtg.ActionStore)
+	if !ok {
+		return
+	}
+	acts, err := as.ListActionsForState(mtg.ActionStateInitial, 0)
+	require.Nil(err)
+	require.Len(acts, 2)
+	require.Equal(outputs[0].UTXOID, acts[0].UTXOID)
+	require.Equal(outputs[1].UTXOID, acts[1].UTXOID)
+	require.True(time.Unix(0, 5000).Equal(acts[1].CreatedAt))
+	acts, err = as.ListActionsForState(mtg.ActionStateDone, 0)
+	require.Nil(err)
+	require.Len(acts, 1)
+	require.Equal(outputs[2].UTXOID, acts[0].UTXOID)
+	require.Equal(mtg.ActionStateDone, acts[0].State)
+}
+
+func testTransaction(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+
+	tx := newTransaction(time.Unix(0, 1000))
+	tx.Entries = []*mtg.TransactionEntry{{
+		TraceId:   newUUID(),
+		Receivers: tx.Receivers,
+		Threshold: tx.Threshold,
+		Amount:    tx.Amount,
+		State:     tx.State,
+	}}
+	err := store.WriteTransaction(tx)
+	require.Nil(err)
+	err = store.WriteTransaction(newTransaction(time.Unix(0, 2000)))
+	require.Nil(err)
+
+	old, err := store.ReadTransactionByTraceId(tx.TraceId)
+	require.Nil(err)
+	require.NotNil(old)
+	require.Equal(tx.Amount, old.Amount)
+	require.Equal(tx.Receivers, old.Receivers)
+	require.Equal(tx.Entries, old.Entries)
+	txs, err := store.ListTransactions(mtg.TransactionStateInitial, 0)
+	require.Nil(err)
+	require.Len(txs, 2)
+	require.Equal(tx.TraceId, txs[0].TraceId)
+	txs, err = store.ListTransactions(mtg.TransactionStateInitial, 1)
+	require.Nil(err)
+	require.Len(txs, 1)
+
+	tx.State = mtg.TransactionStateSigning
+	tx.Raw = []byte("raw")
+	tx.Hash = crypto.NewHash(tx.Raw)
+	tx.UpdatedAt = time.Unix(0, 3000)
+	err = store.WriteTransaction(tx)
+	require.Nil(err)
+	old, err = store.ReadTransactionByHash(tx.Hash)
+	require.Nil(err)
+	require.NotNil(old)
+	require.Equal(tx.TraceId, old.TraceId)
+	txs, err = store.ListTransactions(mtg.TransactionStateInitial, 0)
+	require.Nil(err)
+	require.Len(txs, 1)
+	txs, err = store.ListTransactions(mtg.TransactionStateSigning, 0)
+	require.Nil(err)
+	require.Len(txs, 1)
+
+	unlocked := *tx
+	unlocked.State = mtg.TransactionStateInitial
+	unlocked.Raw = nil
+	unlocked.Hash = crypto.Hash{}
+	err = store.WriteTransaction(&unlocked)
+	require.Nil(err)
+	old, err = store.ReadTransactionByHash(tx.Hash)
+	require.Nil(err)
+	require.Nil(old)
+	txs, err = store.ListTransactions(mtg.TransactionStateInitial, 0)
+	require.Nil(err)
+	require.Len(txs, 2)
+
+	err = store.WriteTransaction(tx)
+	require.Nil(err)
+	tx.State = mtg.TransactionStateSnapshot
+	err = store.WriteTransaction(tx)
+	require.Nil(err)
+	err = store.WriteTransaction(&unlocked)
+	require.NotNil(err)
+
+	err = store.DeleteTransaction(tx)
+	require.Nil(err)
+	old, err = store.ReadTransactionByTraceId(tx.TraceId)
+	require.Nil(err)
+	require.Nil(old)
+	old, err = store.ReadTransactionByHash(tx.Hash)
+	require.Nil(err)
+	require.Nil(old)
+	txs, err = store.ListTransactions(mtg.TransactionStateSnapshot, 0)
+	require.Nil(err)
+	require.Len(txs, 0)
+
+	held := newTransaction(time.Unix(0, 4000))
+	err = store.WriteTransaction(held)
+	require.Nil(err)
+	held.State = mtg.TransactionStateHeld
+	err = store.WriteTransaction(held)
+	require.Nil(err)
+	txs, err = store.ListTransactions(mtg.TransactionStateHeld, 0)
+	require.Nil(err)
+	require.Len(txs, 1)
+	require.Equal(held.TraceId, txs[0].TraceId)
+	held.State = mtg.TransactionStateSigning
+	held.Raw = []byte("held")
+	held.Hash = crypto.NewHash(held.Raw)
+	err = store.WriteTransaction(held)
+	require.Nil(err)
+	txs, err = store.ListTransactions(mtg.TransactionStateHeld, 0)
+	require.Nil(err)
+	require.Len(txs, 0)
+}
+
+func testOutputsAndTransaction(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	as, ok := store.(mtg.AtomicStore)
+	if !ok {
+		t.Skip("mtg.AtomicStore not implemented")
+	}
+
+	tx := newTransaction(time.Unix(0, 1000))
+	tx.Entries = []*mtg.TransactionEntry{{
+		TraceId:   newUUID(),
+		Receivers: tx.Receivers,
+		Threshold: tx.Threshold,
+		Amount:    tx.Amount,
+		State:     tx.State,
+	}}
+	err := store.WriteTransaction(tx)
+	require.Nil(err)
+	out := newOutput(tx.GroupId, tx.AssetId, time.Unix(0, 1000))
+	err = store.WriteOutput(out, "")
+	require.Nil(err)
+
+	out.State = mtg.OutputStateSigned
+	out.SignedTx = "raw"
+	tx.State = mtg.TransactionStateSigning
+	tx.Raw = []byte("raw")
+	tx.Hash = crypto.NewHash(tx.Raw)
+	err = as.WriteOutputsAndTransaction([]*mtg.Output{out}, tx, map[string][]byte{"conformance:usage": []byte("1")})
+	require.Nil(err)
+	outputs, err := store.ListOutputsForTransaction(tx.TraceId)
+	require.Nil(err)
+	require.Len(outputs, 1)
+	val, err := store.ReadProperty([]byte("conformance:usage"))
+	require.Nil(err)
+	require.Equal([]byte("1"), val)
+	old, err := store.ReadTransactionByTraceId(tx.TraceId)
+	require.Nil(err)
+	require.Equal(mtg.TransactionStateSigning, old.State)
+
+	// the transaction state is invalid, so the outputs and properties should
+	// not change
+	other := *out
+	other.State = mtg.OutputStateSpent
+	initial := newTransaction(time.Unix(0, 2000))
+	initial.TraceId = tx.TraceId
+	err = as.WriteOutputsAndTransaction([]*mtg.Output{&other}, &mtg.Transaction{
+		TraceId:   tx.TraceId,
+		State:     mtg.TransactionStateSigning,
+		Raw:       []byte("other"),
+		Hash:      crypto.NewHash([]byte("other")),
+		UpdatedAt: time.Unix(0, 2000),
+	}, map[string][]byte{"conformance:usage": []byte("2")})
+	require.NotNil(err)
+	outputs, err = store.ListOutputsForAsset(tx.GroupId, mixin.UTXOStateSigned, tx.AssetId, 0)
+	require.Nil(err)
+	require.Len(outputs, 1)
+	val, err = store.ReadProperty([]byte("conformance:usage"))
+	require.Nil(err)
+	require.Equal([]byte("1"), val)
+
+	unlocked := *tx
+	unlocked.State = mtg.TransactionStateInitial
+	unlocked.Raw = nil
+	unlocked.Hash = crypto.Hash{}
+	err = store.WriteTransaction(&unlocked)
+	require.Nil(err)
+	outputs, err = store.ListOutputsForTransaction(tx.TraceId)
+	require.Nil(err)
+	require.Len(outputs, 0)
+}
+
+func testCollectible(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+
+	tokenId, traceId := newUUID(), newUUID()
+	out := &mtg.CollectibleOutput{
+		Type:               mtg.OutputTypeCollectible,
+		OutputId:           newUUID(),
+		TokenId:            tokenId,
+		TransactionHash:    crypto.NewHash([]byte(tokenId)),
+		Amount:             decimal.NewFromInt(1),
+		ReceiversThreshold: 1,
+		Receivers:          []string{newUUID()},
+		State:              mtg.OutputStateUnspent,
+		CreatedAt:          time.Unix(0, 1000),
+		UpdatedAt:          time.Unix(0, 1000),
+	}
+	err := store.WriteCollectibleOutput(out, "")
+	require.Nil(err)
+	outputs, err := store.ListCollectibleOutputsForToken(mixin.UTXOStateUnspent, tokenId, 0)
+	require.Nil(err)
+	require.Len(outputs, 1)
+
+	err = store.WriteAction(&mtg.Action{UTXOID: out.OutputId, CreatedAt: out.CreatedAt, State: mtg.ActionStateInitial})
+	require.Nil(err)
+	actions, err := store.ListActions(0)
+	require.Nil(err)
+	require.Len(actions, 1)
+	require.Equal(mtg.OutputTypeCollectible, actions[0].Type)
+
+	out.State = mtg.OutputStateSigned
+	out.SignedBy = "signer"
+	err = store.WriteCollectibleOutputs([]*mtg.CollectibleOutput{out}, traceId)
+	require.Nil(err)
+	outputs, err = store.ListCollectibleOutputsForTransaction(traceId)
+	require.Nil(err)
+	require.Len(outputs, 1)
+	outputs, err = store.ListCollectibleOutputsForToken(mixin.UTXOStateUnspent, tokenId, 0)
+	require.Nil(err)
+	require.Len(outputs, 0)
+
+	tx := &mtg.CollectibleTransaction{
+		TraceId:   traceId,
+		State:     mtg.TransactionStateInitial,
+		Receivers: []string{newUUID()},
+		Threshold: 1,
+		Amount:    "1",
+		UpdatedAt: time.Unix(0, 1000),
+		TokenId:   tokenId,
+	}
+	err = store.WriteCollectibleTransaction(traceId, tx)
+	require.Nil(err)
+	txs, err := store.ListCollectibleTransactions(mtg.TransactionStateInitial, 0)
+	require.Nil(err)
+	require.Len(txs, 1)
+
+	tx.State = mtg.TransactionStateSigned
+	tx.Raw = []byte("raw")
+	tx.Hash = crypto.NewHash(tx.Raw)
+	err = store.WriteCollectibleTransaction(traceId, tx)
+	require.Nil(err)
+	old, err := store.ReadCollectibleTransactionByHash(tx.Hash)
+	require.Nil(err)
+	require.NotNil(old)
+	require.Equal(traceId, old.TraceId)
+	old, err = store.ReadCollectibleTransaction(traceId)
+	require.Nil(err)
+	require.Equal(mtg.TransactionStateSigned, old.State)
+	txs, err = store.ListCollectibleTransactions(mtg.TransactionStateInitial, 0)
+	require.Nil(err)
+	require.Len(txs, 0)
+}
+
+func testAudit(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	as, ok := store.(mtg.AuditStore)
+	if !ok {
+		t.Skip("mtg.AuditStore not implemented")
+	}
+
+	last, err := as.ReadLastAuditEntry()
+	require.Nil(err)
+	require.Nil(last)
+
+	for i := 0; i < 5; i++ {
+		err = as.AppendAuditEntry(&mtg.AuditEntry{
+			Kind:      mtg.AuditKindAction,
+			Subject:   newUUID(),
+			State:     mtg.ActionStateDone,
+			Consensus: i%2 == 0,
+			CreatedAt: time.Unix(0, int64(i)*1000),
+		})
+		require.Nil(err)
+	}
+	last, err = as.ReadLastAuditEntry()
+	require.Nil(err)
+	require.Equal(uint64(5), last.Sequence)
+	require.Equal(uint64(3), last.Round)
+
+	for round, seq := range map[uint64]uint64{1: 1, 2: 3, 3: 5} {
+		e, err := as.ReadAuditEntryByRound(round)
+		require.Nil(err)
+		require.Equal(seq, e.Sequence)
+		require.Equal(round, e.Round)
+		require.True(e.Consensus)
+	}
+	e, err := as.ReadAuditEntryByRound(4)
+	require.Nil(err)
+	require.Nil(e)
+
+	entries, err := as.ListAuditEntries(2, 2)
+	require.Nil(err)
+	require.Len(entries, 2)
+	require.Equal(uint64(2), entries[0].Sequence)
+	require.Equal(uint64(3), entries[1].Sequence)
+	require.Equal(entries[0].Hash, entries[1].Previous)
+
+	entries, err = as.ListAuditEntries(1, 0)
+	require.Nil(err)
+	require.Len(entries, 5)
+	require.Equal(last.Hash, entries[4].Hash)
+	require.Nil(mtg.VerifyAuditEntries(nil, entries))
+	require.Nil(mtg.VerifyAuditEntries(entries[1], entries[2:]))
+
+	entries[2].Subject = newUUID()
+	require.NotNil(mtg.VerifyAuditEntries(nil, entries))
+}
+
+func testDrained(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	ds, ok := store.(mtg.DrainStore)
+	if !ok {
+		t.Skip("mtg.DrainStore not implemented")
+	}
+
+	id := newUUID()
+	for i := 0; i < 5; i++ {
+		err := ds.WriteDrainedOutput("OUT", id, time.Unix(0, int64(i)*1000))
+		require.Nil(err)
+	}
+	found, err := ds.ReadDrainedOutput("OUT", id, time.Unix(0, 2000))
+	require.Nil(err)
+	require.True(found)
+	found, err = ds.ReadDrainedOutput("ACT", id, time.Unix(0, 2000))
+	require.Nil(err)
+	require.False(found)
+	found, err = ds.ReadDrainedOutput("OUT", id, time.Unix(0, 2001))
+	require.Nil(err)
+	require.False(found)
+
+	count, err := ds.PruneDrainedOutputs(time.Unix(0, 3000), 2)
+	require.Nil(err)
+	require.Equal(2, count)
+	count, err = ds.PruneDrainedOutputs(time.Unix(0, 3000), 2)
+	require.Nil(err)
+	require.Equal(1, count)
+	count, err = ds.PruneDrainedOutputs(time.Unix(0, 3000), 2)
+	require.Nil(err)
+	require.Equal(0, count)
+	found, err = ds.ReadDrainedOutput("OUT", id, time.Unix(0, 2000))
+	require.Nil(err)
+	require.False(found)
+	found, err = ds.ReadDrainedOutput("OUT", id, time.Unix(0, 3000))
+	require.Nil(err)
+	require.True(found)
+}
+
+func testCount(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	cs, ok := store.(mtg.CountStore)
+	if !ok {
+		t.Skip("mtg.CountStore not implemented")
+	}
+
+	groupId, assetId := newUUID(), newUUID()
+	for i := 0; i < 3; i++ {
+		out := newOutput(groupId, assetId, time.Unix(0, int64(i+1)*1000))
+		err := store.WriteOutput(out, "")
+		require.Nil(err)
+		state := mtg.ActionStateInitial
+		if i == 0 {
+			state = mtg.ActionStateDone
+		}
+		err = store.WriteAction(&mtg.Action{UTXOID: out.UTXOID, CreatedAt: out.CreatedAt, State: state})
+		require.Nil(err)
+	}
+	count, err := cs.CountActions(mtg.ActionStateInitial)
+	require.Nil(err)
+	require.Equal(2, count)
+	count, err = cs.CountActions(mtg.ActionStateDone)
+	require.Nil(err)
+	require.Equal(1, count)
+
+	for i := 0; i < 3; i++ {
+		tx := newTransaction(time.Unix(0, int64(i+1)*1000))
+		err := store.WriteTransaction(tx)
+		require.Nil(err)
+		if i == 0 {
+			tx.State = mtg.TransactionStateSigning
+			err = store.WriteTransaction(tx)
+			require.Nil(err)
+		}
+	}
+	count, err = cs.CountTransactions(mtg.TransactionStateInitial)
+	require.Nil(err)
+	require.Equal(2, count)
+	count, err = cs.CountTransactions(mtg.TransactionStateSigning)
+	require.Nil(err)
+	require.Equal(1, count)
+
+	traceId := newUUID()
+	err = store.WriteCollectibleTransaction(traceId, &mtg.CollectibleTransaction{
+		TraceId:   traceId,
+		State:     mtg.TransactionStateInitial,
+		Receivers: []string{newUUID()},
+		Threshold: 1,
+		Amount:    "1",
+		UpdatedAt: time.Unix(0, 1000),
+	})
+	require.Nil(err)
+	count, err = cs.CountCollectibleTransactions(mtg.TransactionStateInitial)
+	require.Nil(err)
+	require.Equal(1, count)
+	count, err = cs.CountCollectibleTransactions(mtg.TransactionStateSigned)
+	require.Nil(err)
+	require.Equal(0, count)
+}
+
+func testQuery(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	qs, ok := store.(mtg.QueryStore)
+	if !ok {
+		t.Skip("mtg.QueryStore not implemented")
+	}
+
+	groupId, assetId := newUUID(), newUUID()
+	var outputs []*mtg.Output
+	for i := 0; i < 5; i++ {
+		out := newOutput(groupId, assetId, time.Unix(0, int64(5-i)*1000))
+		err := store.WriteOutput(out, "")
+		require.Nil(err)
+		outputs = append(outputs, out)
+	}
+	err := store.WriteOutput(newOutput(newUUID(), assetId, time.Now()), "")
+	require.Nil(err)
+
+	page, cursor, err := qs.ListOutputsForAssetAfter(groupId, mixin.UTXOStateUnspent, assetId, "", 3)
+	require.Nil(err)
+	require.Len(page, 3)
+	require.Equal(outputs[4].UTXOID, page[0].UTXOID)
+	require.NotEqual("", cursor)
+	page, cursor, err = qs.ListOutputsForAssetAfter(groupId, mixin.UTXOStateUnspent, assetId, cursor, 3)
+	require.Nil(err)
+	require.Len(page, 2)
+	require.Equal(outputs[0].UTXOID, page[1].UTXOID)
+	require.Equal("", cursor)
+	_, _, err = qs.ListOutputsForAssetAfter(groupId, mixin.UTXOStateUnspent, assetId, "invalid", 3)
+	require.ErrorIs(err, mtg.ErrInvalidCursor)
+	page, cursor, err = qs.ListOutputsForStateAfter(mixin.UTXOStateUnspent, "", 5)
+	require.Nil(err)
+	require.Len(page, 5)
+	require.Equal(outputs[4].UTXOID, page[0].UTXOID)
+	page, cursor, err = qs.ListOutputsForStateAfter(mixin.UTXOStateUnspent, cursor, 5)
+	require.Nil(err)
+	require.Len(page, 1)
+	require.NotEqual(groupId, page[0].GroupId)
+	require.Equal("", cursor)
+	page, _, err = qs.ListOutputsForStateAfter(mixin.UTXOStateSpent, "", 5)
+	require.Nil(err)
+	require.Len(page, 0)
+
+	tx := newTransaction(time.Unix(0, 1000))
+	err = store.WriteTransaction(tx)
+	require.Nil(err)
+	other := newTransaction(time.Unix(0, 2000))
+	other.AssetId = tx.AssetId
+	err = store.WriteTransaction(other)
+	require.Nil(err)
+
+	txs, cursor, err := qs.ListTransactionsAfter("", mtg.TransactionStateInitial, "", 1)
+	require.Nil(err)
+	require.Len(txs, 1)
+	require.Equal(tx.TraceId, txs[0].TraceId)
+	txs, cursor, err = qs.ListTransactionsAfter("", mtg.TransactionStateInitial, cursor, 1)
+	require.Nil(err)
+	require.Len(txs, 1)
+	require.Equal(other.TraceId, txs[0].TraceId)
+	txs, cursor, err = qs.ListTransactionsAfter("", mtg.TransactionStateInitial, cursor, 1)
+	require.Nil(err)
+	require.Len(txs, 0)
+	require.Equal("", cursor)
+	_, _, err = qs.ListTransactionsAfter("", mtg.TransactionStateInitial, "invalid", 1)
+	require.ErrorIs(err, mtg.ErrInvalidCursor)
+
+	txs, _, err = qs.ListTransactionsAfter(tx.GroupId, mtg.TransactionStateInitial, "", 0)
+	require.Nil(err)
+	require.Len(txs, 1)
+	require.Equal(tx.TraceId, txs[0].TraceId)
+	txs, _, err = qs.ListTransactionsForAssetAfter(other.GroupId, tx.AssetId, mtg.TransactionStateInitial, "", 0)
+	require.Nil(err)
+	require.Len(txs, 1)
+	require.Equal(other.TraceId, txs[0].TraceId)
+	txs, _, err = qs.ListTransactionsForAssetAfter(other.GroupId, newUUID(), mtg.TransactionStateInitial, "", 0)
+	require.Nil(err)
+	require.Len(txs, 0)
+
+	// the group and asset indexes are moved with the state
+	tx.State = mtg.TransactionStateSigning
+	tx.Raw = []byte("raw")
+	tx.Hash = crypto.NewHash(tx.Raw)
+	tx.UpdatedAt = time.Unix(0, 3000)
+	err = store.WriteTransaction(tx)
+	require.Nil(err)
+	txs, _, err = qs.ListTransactionsAfter(tx.GroupId, mtg.TransactionStateInitial, "", 0)
+	require.Nil(err)
+	require.Len(txs, 0)
+	txs, _, err = qs.ListTransactionsForAssetAfter(tx.GroupId, tx.AssetId, mtg.TransactionStateSigning, "", 0)
+	require.Nil(err)
+	require.Len(txs, 1)
+	require.Equal(tx.TraceId, txs[0].TraceId)
+
+	err = store.DeleteTransaction(tx)
+	require.Nil(err)
+	txs, _, err = qs.ListTransactionsForAssetAfter(tx.GroupId, tx.AssetId, mtg.TransactionStateSigning, "", 0)
+	require.Nil(err)
+	require.Len(txs, 0)
+}
+
+func testTimer(t *testing.T, store mtg.Store) {
+	require := require.New(t)
+	ts, ok := store.(mtg.TimerStore)
+	if !ok {
+		t.Skip("mtg.TimerStore not implemented")
+	}
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id := newUUID()
+		err := ts.WriteTimer(&mtg.Timer{Id: id, Name: "test", At: time.Unix(0, int64(3-i)*1000), Payload: []byte{byte(i)}})
+		require.Nil(err)
+		ids = append(ids, id)
+	}
+	timers, err := ts.ListTimers(2)
+	require.Nil(err)
+	require.Len(timers, 2)
+	require.Equal(ids[2], timers[0].Id)
+	require.Equal(ids[1], timers[1].Id)
+	require.Equal([]byte{2}, timers[0].Payload)
+
+	timer, err := ts.ReadTimer(ids[0])
+	require.Nil(err)
+	require.Equal("test", timer.Name)
+	timer, err = ts.ReadTimer(newUUID())
+	require.Nil(err)
+	require.Nil(timer)
+
+	err = ts.WriteTimer(&mtg.Timer{Id: ids[2], Name: "test", At: time.Unix(0, 5000)})
+	require.Nil(err)
+	err = ts.DeleteTimer(ids[1])
+	require.Nil(err)
+	err = ts.DeleteTimer(ids[1])
+	require.Nil(err)
+	timers, err = ts.ListTimers(0)
+	require.Nil(err)
+	require.Len(timers, 2)
+	require.Equal(ids[0], timers[0].Id)
+	require.Equal(ids[2], timers[1].Id)
+}
+
+func newOutput(groupId, assetId string, createdAt time.Time) *mtg.Output {
+	id := newUUID()
+	return &mtg.Output{
+		GroupId:         groupId,
+		UTXOID:          id,
+		AssetID:         assetId,
+		TransactionHash: crypto.NewHash([]byte(id)),
+		Sender:          newUUID(),
+		Amount:          decimal.NewFromInt(1),
+		Threshold:       1,
+		Members:         []string{newUUID()},
+		State:           mtg.OutputStateUnspent,
+		CreatedAt:       createdAt,
+		UpdatedAt:       createdAt,
+	}
+}
+
+func newTransaction(updatedAt time.Time) *mtg.Transaction {
+	return &mtg.Transaction{
+		GroupId:   newUUID(),
+		TraceId:   newUUID(),
+		State:     mtg.TransactionStateInitial,
+		AssetId:   newUUID(),
+		Receivers: []string{newUUID()},
+		Threshold: 1,
+		Amount:    "1",
+		Memo:      "memo",
+		UpdatedAt: updatedAt,
+	}
+}
+
+func newUUID() string {
+	return uuid.Must(uuid.NewV4()).String()
+}
@@ -0,0 +1,85 @@
+package store
+
+import (
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	prefixTimerPayload = "TIMER:PAYLOAD:"
+	prefixTimerQueue   = "TIMER:QUEUE:"
+)
+
+// the timer with the same id is replaced, and moved in the queue if its
+// time changed
+func (bs *BadgerStore) WriteTimer(t *mtg.Timer) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		old, err := bs.readTimer(txn, t.Id)
+		if err != nil {
+			return err
+		}
+		if old != nil {
+			err = txn.Delete(buildTimerTimedKey(old))
+			if err != nil {
+				return err
+			}
+		}
+		key := []byte(prefixTimerPayload + t.Id)
+		err = txn.Set(key, mtg.MsgpackMarshalPanic(t))
+		if err != nil {
+			return err
+		}
+		return txn.Set(buildTimerTimedKey(t), []byte{1})
+	})
+}
+
+func (bs *BadgerStore) ReadTimer(id string) (*mtg.Timer, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return bs.readTimer(txn, id)
+}
+
+func (bs *BadgerStore) DeleteTimer(id string) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		old, err := bs.readTimer(txn, id)
+		if err != nil || old == nil {
+			return err
+		}
+		err = txn.Delete(buildTimerTimedKey(old))
+		if err != nil {
+			return err
+		}
+		return txn.Delete([]byte(prefixTimerPayload + id))
+	})
+}
+
+// the timers are listed by time, then by id
+func (bs *BadgerStore) ListTimers(limit int) ([]*mtg.Timer, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	var timers []*mtg.Timer
+	for _, id := range listTimedIds(txn, []byte(prefixTimerQueue), 0, limit) {
+		t, err := bs.readTimer(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		timers = append(timers, t)
+	}
+	return timers, nil
+}
+
+func (bs *BadgerStore) readTimer(txn *badger.Txn, id string) (*mtg.Timer, error) {
+	var t mtg.Timer
+	found, err := readMsgpack(txn, []byte(prefixTimerPayload+id), &t)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func buildTimerTimedKey(t *mtg.Timer) []byte {
+	key := append([]byte(prefixTimerQueue), tsToBytes(t.At)...)
+	return append(key, t.Id...)
+}
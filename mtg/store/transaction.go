@@ -0,0 +1,285 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/MixinNetwork/mixin/crypto"
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/dgraph-io/badger/v4"
+)
+
+const (
+	prefixTransactionPayload = "TRANSACTION:PAYLOAD:"
+	prefixTransactionState   = "TRANSACTION:STATE:"
+	prefixTransactionHash    = "TRANSACTION:HASH:"
+	prefixTransactionGroup   = "TRANSACTION:GROUP:"
+	prefixTransactionAsset   = "TRANSACTION:ASSET:"
+)
+
+func (bs *BadgerStore) WriteTransaction(tx *mtg.Transaction) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		return bs.writeTransaction(txn, tx)
+	})
+}
+
+// the outputs signed by the transaction, the transaction state and the
+// properties are updated in the same badger transaction, so that a crash
+// could never leave signed outputs for an initial transaction
+func (bs *BadgerStore) WriteOutputsAndTransaction(utxos []*mtg.Output, tx *mtg.Transaction, properties map[string][]byte) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		for k, v := range properties {
+			err := txn.Set([]byte(k), v)
+			if err != nil {
+				return err
+			}
+		}
+		for _, utxo := range utxos {
+			err := bs.writeOutput(txn, utxo, tx.TraceId)
+			if err != nil {
+				return err
+			}
+		}
+		return bs.writeTransaction(txn, tx)
+	})
+}
+
+func (bs *BadgerStore) DeleteTransaction(old *mtg.Transaction) error {
+	return bs.db.Update(func(txn *badger.Txn) error {
+		old, err := bs.readTransaction(txn, old.TraceId)
+		if err != nil || old == nil {
+			return err
+		}
+		err = bs.resetTransactionOutputs(txn, old.TraceId)
+		if err != nil {
+			return err
+		}
+		if old.Hash.HasValue() {
+			err = txn.Delete([]byte(prefixTransactionHash + old.Hash.String()))
+			if err != nil {
+				return err
+			}
+		}
+		for _, key := range buildTransactionTimedKeys(old) {
+			err = txn.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+		return txn.Delete([]byte(prefixTransactionPayload + old.TraceId))
+	})
+}
+
+func (bs *BadgerStore) ReadTransactionByTraceId(traceId string) (*mtg.Transaction, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return bs.readTransaction(txn, traceId)
+}
+
+func (bs *BadgerStore) ReadTransactionByHash(hash crypto.Hash) (*mtg.Transaction, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	traceId, err := readTraceIdByHash(txn, prefixTransactionHash, hash)
+	if err != nil || traceId == "" {
+		return nil, err
+	}
+	return bs.readTransaction(txn, traceId)
+}
+
+func (bs *BadgerStore) CountTransactions(state int) (int, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	return countTimedKeys(txn, []byte(transactionStatePrefix(state))), nil
+}
+
+func (bs *BadgerStore) ListTransactions(state int, limit int) ([]*mtg.Transaction, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	prefix := []byte(transactionStatePrefix(state))
+	var txs []*mtg.Transaction
+	for _, id := range listTimedIds(txn, prefix, 0, limit) {
+		tx, err := bs.readTransaction(txn, id)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// the transactions of all group ids are listed with an empty group id, and
+// they are ordered by the updated time
+func (bs *BadgerStore) ListTransactionsAfter(groupId string, state int, cursor string, limit int) ([]*mtg.Transaction, string, error) {
+	prefix, size := transactionStatePrefix(state), 0
+	if groupId != "" {
+		prefix, size = transactionGroupPrefix(state, groupId), uuidSize
+	}
+	return bs.listTransactionsAfter([]byte(prefix), size, cursor, limit)
+}
+
+// the transactions of the group id and asset exactly, ordered by the
+// updated time
+func (bs *BadgerStore) ListTransactionsForAssetAfter(groupId, assetId string, state int, cursor string, limit int) ([]*mtg.Transaction, string, error) {
+	prefix := transactionAssetPrefix(state, assetId, groupId)
+	return bs.listTransactionsAfter([]byte(prefix), uuidSize, cursor, limit)
+}
+
+func (bs *BadgerStore) listTransactionsAfter(prefix []byte, size int, cursor string, limit int) ([]*mtg.Transaction, string, error) {
+	txn := bs.db.NewTransaction(false)
+	defer txn.Discard()
+
+	ids, next, err := listTimedIdsAfter(txn, prefix, size, cursor, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	var txs []*mtg.Transaction
+	for _, id := range ids {
+		tx, err := bs.readTransaction(txn, id)
+		if err != nil {
+			return nil, "", err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, next, nil
+}
+
+func (bs *BadgerStore) writeTransaction(txn *badger.Txn, tx *mtg.Transaction) error {
+	old, err := bs.readTransaction(txn, tx.TraceId)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		switch {
+		case old.State == tx.State && old.Hash == tx.Hash:
+			// the same transaction is written again with more details
+		case old.State == mtg.TransactionStateInitial && tx.State == mtg.TransactionStateHeld:
+		case old.State == mtg.TransactionStateSigning && tx.State == mtg.TransactionStateInitial:
+			err = bs.resetTransactionOutputs(txn, tx.TraceId)
+			if err != nil {
+				return err
+			}
+		case old.State > tx.State:
+			return fmt.Errorf("invalid transaction state %s %d %d", old.TraceId, old.State, tx.State)
+		case old.State == tx.State:
+			return fmt.Errorf("invalid transaction hash %s %s %s", old.TraceId, old.Hash, tx.Hash)
+		}
+		for _, key := range buildTransactionTimedKeys(old) {
+			err = txn.Delete(key)
+			if err != nil {
+				return err
+			}
+		}
+		if old.Hash.HasValue() && old.Hash != tx.Hash {
+			err = txn.Delete([]byte(prefixTransactionHash + old.Hash.String()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	key := []byte(prefixTransactionPayload + tx.TraceId)
+	err = txn.Set(key, mtg.MsgpackMarshalPanic(tx))
+	if err != nil {
+		return err
+	}
+	if len(tx.Raw) > 0 {
+		if !tx.Hash.HasValue() {
+			return fmt.Errorf("invalid transaction hash %s", tx.TraceId)
+		}
+		key = []byte(prefixTransactionHash + tx.Hash.String())
+		err = txn.Set(key, []byte(tx.TraceId))
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range buildTransactionTimedKeys(tx) {
+		err = txn.Set(key, []byte{1})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (bs *BadgerStore) readTransaction(txn *badger.Txn, traceId string) (*mtg.Transaction, error) {
+	var tx mtg.Transaction
+	found, err := readMsgpack(txn, []byte(prefixTransactionPayload+traceId), &tx)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &tx, nil
+}
+
+func (bs *BadgerStore) resetTransactionOutputs(txn *badger.Txn, traceId string) error {
+	prefix := []byte(prefixOutputTransaction + traceId)
+	for _, id := range listTimedIds(txn, prefix, uuidSize, 0) {
+		out, err := bs.readOutput(txn, id)
+		if err != nil {
+			return err
+		}
+		err = txn.Delete(buildOutputTimedKey(out, prefixOutputTransaction, traceId))
+		if err != nil {
+			return err
+		}
+		err = txn.Delete([]byte(prefixOutputTrace + id))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readTraceIdByHash(txn *badger.Txn, prefix string, hash crypto.Hash) (string, error) {
+	item, err := txn.Get([]byte(prefix + hash.String()))
+	if err == badger.ErrKeyNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	traceId, err := item.ValueCopy(nil)
+	return string(traceId), err
+}
+
+// the state index of all group ids, the group index and the asset index
+// of a group id, which are removed and written with the transaction state
+func buildTransactionTimedKeys(tx *mtg.Transaction) [][]byte {
+	state := transactionStatePrefix(tx.State)
+	var keys [][]byte
+	for _, prefix := range []string{
+		state,
+		transactionGroupPrefix(tx.State, tx.GroupId),
+		transactionAssetPrefix(tx.State, tx.AssetId, tx.GroupId),
+	} {
+		key := append([]byte(prefix), tsToBytes(tx.UpdatedAt)...)
+		keys = append(keys, append(key, tx.TraceId...))
+	}
+	return keys
+}
+
+func transactionGroupPrefix(state int, groupId string) string {
+	return prefixTransactionGroup + transactionStatePrefix(state)[len(prefixTransactionState):] + groupId
+}
+
+func transactionAssetPrefix(state int, assetId, groupId string) string {
+	return prefixTransactionAsset + transactionStatePrefix(state)[len(prefixTransactionState):] + assetId + groupId
+}
+
+func transactionStatePrefix(state int) string {
+	prefix := prefixTransactionState
+	switch state {
+	case mtg.TransactionStateHeld:
+		return prefix + "heldheld"
+	case mtg.TransactionStateInitial:
+		return prefix + "initiall"
+	case mtg.TransactionStateSigning:
+		return prefix + "signingg"
+	case mtg.TransactionStateSigned:
+		return prefix + "signeddd"
+	case mtg.TransactionStateSnapshot:
+		return prefix + "snapshot"
+	}
+	panic(state)
+}
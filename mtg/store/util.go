@@ -0,0 +1,105 @@
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/MixinNetwork/trusted-group/mtg"
+	"github.com/dgraph-io/badger/v4"
+)
+
+func tsToBytes(ts time.Time) []byte {
+	buf := make([]byte, 8)
+	d := ts.UnixNano()
+	binary.BigEndian.PutUint64(buf, uint64(d))
+	return buf
+}
+
+func readMsgpack(txn *badger.Txn, key []byte, val any) (bool, error) {
+	item, err := txn.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	b, err := item.ValueCopy(nil)
+	if err != nil {
+		return false, err
+	}
+	return true, mtg.MsgpackUnmarshal(b, val)
+}
+
+// list the ids at the end of all keys with the prefix, the id is after
+// the 8 bytes timestamp, and the size check skips the keys with a longer
+// prefix, e.g. the outputs of another group id
+func listTimedIds(txn *badger.Txn, prefix []byte, size, limit int) []string {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var ids []string
+	for it.Seek(opts.Prefix); it.Valid(); it.Next() {
+		key := it.Item().Key()
+		if size > 0 && len(key) != len(prefix)+8+size {
+			continue
+		}
+		ids = append(ids, string(key[len(prefix)+8:]))
+		if len(ids) == limit {
+			break
+		}
+	}
+	return ids
+}
+
+// count the keys of the index without reading the values
+func countTimedKeys(txn *badger.Txn, prefix []byte) int {
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var count int
+	for it.Seek(opts.Prefix); it.Valid(); it.Next() {
+		count++
+	}
+	return count
+}
+
+// list the ids after the cursor, which is the timestamp and id of the last
+// key listed, and the next cursor is empty when fewer ids than the limit
+// listed
+func listTimedIdsAfter(txn *badger.Txn, prefix []byte, size int, cursor string, limit int) ([]string, string, error) {
+	after, err := hex.DecodeString(cursor)
+	if err != nil || (len(after) > 0 && len(after) <= 8) {
+		return nil, "", fmt.Errorf("%w %s", mtg.ErrInvalidCursor, cursor)
+	}
+	opts := badger.DefaultIteratorOptions
+	opts.PrefetchValues = false
+	opts.Prefix = prefix
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	var ids []string
+	var last []byte
+	for it.Seek(append(append([]byte{}, prefix...), after...)); it.Valid(); it.Next() {
+		key := it.Item().Key()
+		if size > 0 && len(key) != len(prefix)+8+size {
+			continue
+		}
+		if bytes.Equal(key[len(prefix):], after) {
+			continue
+		}
+		ids = append(ids, string(key[len(prefix)+8:]))
+		last = append([]byte{}, key[len(prefix):]...)
+		if len(ids) == limit {
+			return ids, hex.EncodeToString(last), nil
+		}
+	}
+	return ids, "", nil
+}
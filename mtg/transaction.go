@@ -5,7 +5,6 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"strings"
 	"time"
 
 	"github.com/MixinNetwork/mixin/common"
@@ -17,6 +16,8 @@ import (
 )
 
 const (
+	// the transaction over the outflow limits waits for approvals
+	TransactionStateHeld     = 9
 	TransactionStateInitial  = 10
 	TransactionStateSigning  = 11
 	TransactionStateSigned   = 12
@@ -41,11 +42,18 @@ type Transaction struct {
 	Hash       crypto.Hash
 	References []crypto.Hash
 	UpdatedAt  time.Time
+	// the consensus time when built, which decides the outflow limit windows
+	CreatedAt time.Time
+	// the created time of the epoch whose outputs are spent
+	Epoch time.Time
+	// the outputs of a batch transaction, the receivers and threshold of
+	// the transaction are empty, and the amount is the sum of all entries
+	Entries []*TransactionEntry
 }
 
 // the app should decide a unique trace id so that the MTG will not double spend
 func (grp *Group) BuildTransaction(ctx context.Context, assetId string, receivers []string, threshold int, amount, memo string, traceId, groupId string) error {
-	return grp.buildTransaction(ctx, assetId, receivers, threshold, amount, memo, traceId, groupId, grp.clock.Now(), nil)
+	return grp.buildTransaction(ctx, assetId, receivers, threshold, amount, memo, traceId, groupId, grp.buildTime(ctx), nil, grp.currentEpoch())
 }
 
 func (grp *Group) BuildStorageTransaction(ctx context.Context, data []byte, groupId string) (*Transaction, error) {
@@ -60,7 +68,7 @@ func (grp *Group) BuildStorageTransaction(ctx context.Context, data []byte, grou
 	extra := int64(len(encodeMixinExtra(groupId, sTraceId, string(data))))
 	sAmount := decimal.RequireFromString(common.ExtraStoragePriceStep)
 	sAmount = sAmount.Mul(decimal.NewFromInt(extra/common.ExtraSizeStorageStep + 1))
-	err = grp.buildTransaction(ctx, StorageAssetId, sReceivers, 64, sAmount.String(), string(data), sTraceId, groupId, grp.clock.Now(), nil)
+	err = grp.buildTransaction(ctx, StorageAssetId, sReceivers, 64, sAmount.String(), string(data), sTraceId, groupId, grp.buildTime(ctx), nil, grp.currentEpoch())
 	if err != nil {
 		return nil, fmt.Errorf("Group.buildStorageTransaction(%d) => %s %v", len(data), sTraceId, err)
 	}
@@ -68,52 +76,82 @@ func (grp *Group) BuildStorageTransaction(ctx context.Context, data []byte, grou
 }
 
 func (grp *Group) BuildTransactionWithReferences(ctx context.Context, assetId string, receivers []string, threshold int, amount, memo string, traceId, groupId string, references []crypto.Hash) error {
-	return grp.buildTransaction(ctx, assetId, receivers, threshold, amount, memo, traceId, groupId, grp.clock.Now(), references)
+	return grp.buildTransaction(ctx, assetId, receivers, threshold, amount, memo, traceId, groupId, grp.buildTime(ctx), references, grp.currentEpoch())
 }
 
-func (grp *Group) buildCompactTransaction(ctx context.Context, source *Transaction, outputs []*Output) error {
+func (grp *Group) buildCompactTransaction(ctx context.Context, e *Epoch, source *Transaction, outputs []*Output) error {
+	return grp.compactOutputs(ctx, e, source.GroupId, source.AssetId, source.TraceId, outputs)
+}
+
+// the trace id is decided by the seed and outputs, so all nodes build the
+// same compaction transaction for the same outputs
+func (grp *Group) compactOutputs(ctx context.Context, e *Epoch, groupId, assetId, seed string, outputs []*Output) error {
 	var total common.Integer
-	traceId := mixin.UniqueConversationID(CompactionTransactionMemo, source.TraceId)
+	traceId := mixin.UniqueConversationID(CompactionTransactionMemo, seed)
 	for _, out := range outputs {
-		if out.GroupId != source.GroupId {
-			panic(source)
+		if out.GroupId != groupId {
+			return newConsensusError("Group.buildCompactTransaction", "invalid output group %s %s", out.GroupId, groupId)
 		}
 		total = total.Add(common.NewIntegerFromString(out.Amount.String()))
 		traceId = mixin.UniqueConversationID(traceId, out.UTXOID)
 	}
-	logger.Printf("Group.buildCompactTransaction(%s, %s, %s) => %s\n", source.GroupId, source.TraceId, total, traceId)
-	return grp.buildTransaction(ctx, source.AssetId, grp.GetMembers(), grp.GetThreshold(), total.String(), CompactionTransactionMemo, traceId, source.GroupId, time.Unix(0, 0), nil)
+	logger.Printf("Group.buildCompactTransaction(%s, %s, %s) => %s\n", groupId, seed, total, traceId)
+	err := grp.buildTransaction(ctx, assetId, e.Members, e.Threshold, total.String(), CompactionTransactionMemo, traceId, groupId, time.Unix(0, 0), nil, e)
+	if err != nil {
+		return err
+	}
+	err = grp.writeAuditEntry(AuditKindCompaction, traceId, TransactionStateInitial, seed, false, grp.clock.Now())
+	if err != nil {
+		return err
+	}
+	tx, err := grp.store.ReadTransactionByTraceId(traceId)
+	if err != nil || tx == nil {
+		return newStoreError("Group.ReadTransactionByTraceId", err)
+	}
+	grp.emitTransactionEvent(EventCompactionCreated, tx)
+	return nil
 }
 
-func (grp *Group) buildTransaction(ctx context.Context, assetId string, receivers []string, threshold int, amount, memo string, traceId, groupId string, ts time.Time, references []crypto.Hash) error {
-	if len(references) > 2 {
-		panic(len(references))
+// the compaction transaction spends all outputs of the batch to a single
+// output, it expires when any of the outputs spent by other transactions
+func (grp *Group) checkCompactTransactionOutputs(tx *Transaction, outputs []*Output) bool {
+	if len(outputs) != OutputsBatchSize {
+		return false
 	}
-	for _, r := range references {
-		if !r.HasValue() {
-			panic(traceId)
-		}
+	var total decimal.Decimal
+	for _, out := range outputs {
+		total = total.Add(out.Amount)
 	}
-	if threshold < 1 || threshold > 128 {
-		return fmt.Errorf("invalid receivers threshold %d/%d", threshold, len(receivers))
+	return total.Equal(decimal.RequireFromString(tx.Amount))
+}
+
+// the expired compaction or maintenance transaction is deleted, so that a
+// new one could be built for the new outputs with a different trace id
+func (grp *Group) expireTransaction(tx *Transaction, kind string) error {
+	err := grp.store.DeleteTransaction(tx)
+	logger.Printf("Group.expireTransaction(%v, %s) => %v", *tx, kind, err)
+	if err != nil {
+		return newStoreError("Group.DeleteTransaction", err)
 	}
-	amt, err := decimal.NewFromString(amount)
-	min, _ := decimal.NewFromString("0.00000001")
-	if err != nil || amt.Cmp(min) < 0 {
-		return fmt.Errorf("invalid amount %s", amount)
+	err = grp.writeAuditEntry(kind, tx.TraceId, 0, "expired", false, grp.clock.Now())
+	if err != nil {
+		return err
 	}
+	return newInputError("Group.signTransaction", "expired %s transaction %s", kind, tx.TraceId)
+}
 
-	for _, r := range receivers {
-		id, _ := uuid.FromString(r)
-		if id.String() == uuid.Nil.String() {
-			return fmt.Errorf("invalid receiver %s", r)
+func (grp *Group) buildTransaction(ctx context.Context, assetId string, receivers []string, threshold int, amount, memo string, traceId, groupId string, ts time.Time, references []crypto.Hash, e *Epoch) error {
+	if len(references) > 2 {
+		return newInputError("Group.buildTransaction", "invalid references count %d", len(references))
+	}
+	for _, r := range references {
+		if !r.HasValue() {
+			return newInputError("Group.buildTransaction", "invalid reference %s", traceId)
 		}
 	}
-	old, err := grp.store.ReadTransactionByTraceId(traceId)
+	err := checkTransactionOutput("Group.buildTransaction", receivers, threshold, amount)
 	if err != nil {
-		panic(err)
-	} else if old != nil {
-		return nil
+		return err
 	}
 	tx := &Transaction{
 		GroupId:    groupId,
@@ -126,83 +164,191 @@ func (grp *Group) buildTransaction(ctx context.Context, assetId string, receiver
 		Memo:       memo,
 		References: references,
 		UpdatedAt:  ts,
+		CreatedAt:  ts,
+		Epoch:      e.CreatedAt,
+	}
+	return grp.writeNewTransaction(ctx, tx)
+}
+
+func checkTransactionOutput(op string, receivers []string, threshold int, amount string) error {
+	if threshold < 1 || threshold > 128 {
+		return newInputError(op, "invalid receivers threshold %d/%d", threshold, len(receivers))
+	}
+	amt, err := decimal.NewFromString(amount)
+	min, _ := decimal.NewFromString("0.00000001")
+	if err != nil || amt.Cmp(min) < 0 {
+		return newInputError(op, "invalid amount %s", amount)
+	}
+
+	for _, r := range receivers {
+		id, _ := uuid.FromString(r)
+		if id.String() == uuid.Nil.String() {
+			return newInputError(op, "invalid receiver %s", r)
+		}
+	}
+	return nil
+}
+
+// the transaction is ignored if the trace id exists already, and the one
+// built by an action is a consensus audit entry
+func (grp *Group) writeNewTransaction(ctx context.Context, tx *Transaction) error {
+	if uuid.FromStringOrNil(tx.TraceId).String() != tx.TraceId {
+		return newInputError("Group.buildTransaction", "invalid trace id %s", tx.TraceId)
+	}
+	old, err := grp.store.ReadTransactionByTraceId(tx.TraceId)
+	if err != nil {
+		return newStoreError("Group.ReadTransactionByTraceId", err)
+	} else if old != nil && old.AssetId != "" {
+		return nil
 	}
 
-	// TODO ensure valid memo and trace id
 	if grp.checkStorageTransaction(tx) {
 		if len(tx.Memo) > common.ExtraSizeStorageCapacity/2 {
-			panic(len(tx.Memo))
+			return newInputError("Group.buildTransaction", "invalid storage size %d", len(tx.Memo))
 		}
-	} else {
-		EncodeMixinExtra(groupId, tx.TraceId, tx.Memo)
+	} else if len(encodeMixinExtra(tx.GroupId, tx.TraceId, tx.Memo)) >= common.ExtraSizeGeneralLimit {
+		return newInputError("Group.buildTransaction", "invalid memo size %d", len(tx.Memo))
 	}
 
-	grp.writeTansactionOrPanic(tx)
-	return nil
+	// the transaction drained from the network before built by this node
+	// only has the raw, so the details are filled, and the drained state
+	// is emitted after queued
+	queued := *tx
+	if old != nil {
+		tx.State, tx.Raw, tx.Hash, tx.UpdatedAt = old.State, old.Raw, old.Hash, old.UpdatedAt
+	}
+	err = grp.storeTransaction(tx, nil)
+	if err != nil {
+		return err
+	}
+	grp.emitTransactionEvent(EventTransactionQueued, &queued)
+	if tx.State != queued.State {
+		grp.emitTransactionEvent(transactionStateEvent(tx.State), tx)
+	}
+	action := actionFromContext(ctx)
+	return grp.writeAuditEntry(AuditKindTransaction, tx.TraceId, TransactionStateInitial, action, action != "", tx.UpdatedAt)
+}
+
+// the state changes are recorded in the audit log
+func (grp *Group) writeTransaction(tx *Transaction) error {
+	return grp.writeTransactionWithProperties(tx, nil)
 }
 
-func (grp *Group) writeTansactionOrPanic(tx *Transaction) {
-	err := grp.store.WriteTransaction(tx)
-	logger.Printf("Group.writeTansactionOrPanic(%v) => %v", *tx, err)
+// the properties are written with the transaction atomically if possible
+func (grp *Group) writeTransactionWithProperties(tx *Transaction, properties map[string][]byte) error {
+	old, err := grp.store.ReadTransactionByTraceId(tx.TraceId)
 	if err != nil {
-		panic(err)
+		return newStoreError("Group.ReadTransactionByTraceId", err)
+	}
+	err = grp.storeTransaction(tx, properties)
+	if err != nil || (old != nil && old.State == tx.State) {
+		return err
+	}
+	var detail string
+	if tx.Hash.HasValue() {
+		detail = tx.Hash.String()
+	}
+	err = grp.writeAuditEntry(AuditKindTransaction, tx.TraceId, tx.State, detail, false, grp.clock.Now())
+	if err != nil {
+		return err
+	}
+	grp.emitTransactionEvent(transactionStateEvent(tx.State), tx)
+	return nil
+}
+
+func (grp *Group) storeTransaction(tx *Transaction, properties map[string][]byte) error {
+	tx.updateEntries()
+	var err error
+	if len(properties) > 0 {
+		err = writeOutputsAndTransaction(grp.store, nil, tx, properties)
+	} else {
+		err = grp.store.WriteTransaction(tx)
 	}
+	logger.Printf("Group.writeTransaction(%v) => %v", *tx, err)
+	return newStoreError("Group.WriteTransaction", err)
 }
 
 func (grp *Group) checkStorageTransaction(tx *Transaction) bool {
 	return len(tx.Receivers) == 1 && tx.Threshold == 64 && tx.AssetId == StorageAssetId && tx.Receivers[0] == StorageReceiverId
 }
 
-func (grp *Group) checkCompactTransactionRequest(ctx context.Context, ver *common.VersionedTransaction, extra *mixinExtraPack) bool {
+func (grp *Group) checkCompactTransactionRequest(ctx context.Context, e *Epoch, ver *common.VersionedTransaction, extra *mixinExtraPack) bool {
 	// FIXME should check the keys with messenger api
 	return ver != nil && ver.AggregatedSignature == nil && len(ver.SignaturesMap) == 0 &&
 		extra != nil && extra.M == CompactionTransactionMemo && len(ver.Inputs) == OutputsBatchSize &&
-		len(ver.Outputs) == 1 && len(ver.Outputs[0].Keys) == len(grp.GetMembers()) &&
-		ver.Outputs[0].Script.String() == common.NewThresholdScript(uint8(grp.GetThreshold())).String()
+		len(ver.Outputs) == 1 && len(ver.Outputs[0].Keys) == len(e.Members) &&
+		ver.Outputs[0].Script.String() == common.NewThresholdScript(uint8(e.Threshold)).String()
 }
 
-func (grp *Group) signTransaction(ctx context.Context, tx *Transaction) ([]byte, error) {
+// the outputs signed are returned to be written with the transaction
+func (grp *Group) signTransaction(ctx context.Context, tx *Transaction) ([]byte, []*Output, error) {
 	outputs, err := grp.ListOutputsForTransaction(tx.TraceId)
 	if err != nil {
-		panic(err)
+		return nil, nil, newStoreError("Group.ListOutputsForTransaction", err)
 	}
-	if len(outputs) == 0 {
-		outputs, err = grp.ListOutputsForAsset(tx.GroupId, tx.AssetId, mixin.UTXOStateUnspent, OutputsBatchSize)
+	e := grp.readEpoch(tx.Epoch)
+	bound := len(outputs) > 0
+	if !bound && isMaintenanceTransaction(tx) {
+		outputs, err = grp.listMaintenanceOutputs(e, tx)
+		if err != nil {
+			return nil, nil, err
+		} else if len(outputs) == 0 {
+			return nil, nil, grp.expireTransaction(tx, AuditKindTransaction)
+		}
+	} else if !bound {
+		outputs, err = grp.listEpochOutputsForAsset(e, tx.GroupId, tx.AssetId, mixin.UTXOStateUnspent, OutputsBatchSize)
 	}
 	if err != nil {
-		panic(err)
+		return nil, nil, newStoreError("Group.listEpochOutputsForAsset", err)
 	}
 	logger.Verbosef("group.ListOutputsForTransaction(%s) => %d %v\n", tx.TraceId, len(outputs), err)
 	if len(outputs) == 0 {
-		return nil, fmt.Errorf("empty outputs %s", tx.Amount)
+		return nil, nil, newInputError("Group.signTransaction", "empty outputs %s", tx.Amount)
 	}
-	// FIXME do more compatcion transaction check
-	if len(outputs) < OutputsBatchSize && tx.Memo == CompactionTransactionMemo {
-		return nil, fmt.Errorf("insufficient compaction transaction outputs %v %d", tx, len(outputs))
+	if tx.Memo == CompactionTransactionMemo && !grp.checkCompactTransactionOutputs(tx, outputs) {
+		return nil, nil, grp.expireTransaction(tx, AuditKindCompaction)
 	}
 
-	ver, outputs, err := grp.buildRawTransaction(ctx, tx, outputs)
+	ver, outputs, err := grp.buildRawTransaction(ctx, e, tx, outputs, bound)
 	logger.Verbosef("group.buildRawTransaction(%v) => %v %d %v\n", tx, ver, len(outputs), err)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	// FIXME do more compatcion transaction check
 	if len(ver.Outputs) != 1 && tx.Memo == CompactionTransactionMemo {
-		return nil, fmt.Errorf("expired compaction transaction %v", tx)
+		return nil, nil, newInputError("Group.signTransaction", "expired compaction transaction %v", tx)
 	}
 	if ver.AggregatedSignature != nil || len(ver.SignaturesMap) > 0 {
-		return ver.Marshal(), nil
+		return ver.Marshal(), nil, nil
+	}
+
+	err = grp.checkSigningRequest(ctx, &SigningRequest{
+		Action:      mixin.MultisigActionSign,
+		Raw:         ver,
+		Transaction: tx,
+		Outputs:     outputs,
+		Change:      grp.readChangeEpoch(e),
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
 	raw := hex.EncodeToString(ver.Marshal())
 	req, err := grp.createMultisigUntilSufficient(ctx, mixin.MultisigActionSign, raw)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	err = checkRequestedRaw(ver, req.RawTransaction)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	req, err = grp.signMultisigUntilSufficient(ctx, req.RequestID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	err = checkRequestedRaw(ver, req.RawTransaction)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	for _, out := range outputs {
@@ -210,50 +356,35 @@ func (grp *Group) signTransaction(ctx context.Context, tx *Transaction) ([]byte,
 		out.SignedBy = ver.PayloadHash().String()
 		out.SignedTx = req.RawTransaction
 	}
-	err = grp.store.WriteOutputs(outputs, tx.TraceId)
-	if err != nil {
-		panic(err)
-	}
-	return hex.DecodeString(req.RawTransaction)
+	signed, err := hex.DecodeString(req.RawTransaction)
+	return signed, outputs, err
 }
 
 func (grp *Group) createMultisigUntilSufficient(ctx context.Context, action, raw string) (*mixin.MultisigRequest, error) {
-	for {
-		req, err := grp.mixin.CreateMultisig(ctx, action, raw)
+	var req *mixin.MultisigRequest
+	err := grp.retry(ctx, func() error {
+		var err error
+		req, err = grp.network.CreateMultisig(ctx, action, raw)
 		logger.Verbosef("group.CreateMultisig(%s, %s) => %v %v\n", action, raw, req, err)
-		if err != nil && checkRetryableError(err) {
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		return req, err
-	}
+		return newNetworkError("Group.CreateMultisig", err)
+	})
+	return req, err
 }
 
 func (grp *Group) signMultisigUntilSufficient(ctx context.Context, requestID string) (*mixin.MultisigRequest, error) {
-	for {
-		req, err := grp.mixin.SignMultisig(ctx, requestID, grp.pin)
-		logger.Verbosef("group.CreateMultisig(%s) => %v %v\n", requestID, req, err)
-		if err != nil && checkRetryableError(err) {
-			time.Sleep(3 * time.Second)
-			continue
-		}
-		return req, err
-	}
-}
-
-func checkRetryableError(err error) bool {
-	es := err.Error()
-	switch {
-	case strings.Contains(es, "Client.Timeout exceeded"):
-	case strings.Contains(es, "Bad Gateway"):
-	case strings.Contains(es, "Internal Server Error"):
-	default:
-		return false
-	}
-	return true
+	var req *mixin.MultisigRequest
+	err := grp.retry(ctx, func() error {
+		var err error
+		req, err = grp.network.SignMultisig(ctx, requestID, grp.pin)
+		logger.Verbosef("group.SignMultisig(%s) => %v %v\n", requestID, req, err)
+		return newNetworkError("Group.SignMultisig", err)
+	})
+	return req, err
 }
 
-func (grp *Group) buildRawTransaction(ctx context.Context, tx *Transaction, outputs []*Output) (*common.VersionedTransaction, []*Output, error) {
+// the outputs already bound to the transaction were selected before, maybe
+// by other members, so they are all consumed without selection again
+func (grp *Group) buildRawTransaction(ctx context.Context, e *Epoch, tx *Transaction, outputs []*Output, bound bool) (*common.VersionedTransaction, []*Output, error) {
 	old, _ := decodeTransactionWithExtra(outputs[0].SignedTx)
 	if old != nil && (old.AggregatedSignature != nil || len(old.SignaturesMap) > 0) {
 		return old, nil, nil
@@ -262,52 +393,67 @@ func (grp *Group) buildRawTransaction(ctx context.Context, tx *Transaction, outp
 	ver.Extra = []byte(encodeMixinExtra(tx.GroupId, tx.TraceId, tx.Memo))
 	target := common.NewIntegerFromString(tx.Amount)
 
+	// the compaction and maintenance transactions spend all the outputs
+	consumed := outputs
+	if !bound && tx.Memo != CompactionTransactionMemo && !isMaintenanceTransaction(tx) {
+		consumed = grp.selector.SelectOutputs(outputs, decimal.RequireFromString(target.String()))
+	}
 	var total common.Integer
-	var consumed []*Output
-	for _, out := range outputs {
+	for _, out := range consumed {
 		total = total.Add(common.NewIntegerFromString(out.Amount.String()))
 		ver.AddInput(crypto.Hash(out.TransactionHash), out.OutputIndex)
-		consumed = append(consumed, out)
-		if total.Cmp(target) >= 0 && len(consumed) >= grp.groupSize {
-			break
-		}
 	}
-	if total.Cmp(target) < 0 {
+	if len(consumed) == 0 || total.Cmp(target) < 0 {
 		if len(outputs) == OutputsBatchSize {
-			err := grp.buildCompactTransaction(ctx, tx, outputs)
+			err := grp.buildCompactTransaction(ctx, e, tx, outputs)
 			if err != nil {
-				panic(err)
+				return nil, nil, err
 			}
 		}
-		return nil, nil, fmt.Errorf("insufficient %d %s %s", len(outputs), total, tx.Amount)
-	}
-
-	keys, err := grp.mixin.BatchReadGhostKeys(ctx, []*mixin.GhostInput{{
-		Receivers: tx.Receivers,
-		Index:     0,
+		return nil, nil, newInputError("Group.buildRawTransaction", "insufficient %d %s %s", len(outputs), total, tx.Amount)
+	}
+
+	// the change output always follows the entries
+	ce := grp.readChangeEpoch(e)
+	entries := tx.outputEntries()
+	var inputs []*mixin.GhostInput
+	for i, en := range entries {
+		inputs = append(inputs, &mixin.GhostInput{
+			Receivers: en.Receivers,
+			Index:     i,
+			Hint:      tx.TraceId,
+		})
+	}
+	inputs = append(inputs, &mixin.GhostInput{
+		Receivers: ce.Members,
+		Index:     len(entries),
 		Hint:      tx.TraceId,
-	}, {
-		Receivers: grp.members,
-		Index:     1,
-		Hint:      tx.TraceId,
-	}})
+	})
+	var keys []*mixin.GhostKeys
+	err := grp.retry(ctx, func() error {
+		var err error
+		keys, err = grp.network.BatchReadGhostKeys(ctx, inputs)
+		return newNetworkError("Group.BatchReadGhostKeys", err)
+	})
 	if err != nil {
 		return nil, nil, err
 	}
 
-	amount, err := decimal.NewFromString(tx.Amount)
-	if err != nil {
-		return nil, nil, err
+	for i, en := range entries {
+		amount, err := decimal.NewFromString(en.Amount)
+		if err != nil {
+			return nil, nil, err
+		}
+		out := keys[i].DumpOutput(uint8(en.Threshold), amount)
+		ver.Outputs = append(ver.Outputs, newCommonOutput(out))
 	}
-	out := keys[0].DumpOutput(uint8(tx.Threshold), amount)
-	ver.Outputs = append(ver.Outputs, newCommonOutput(out))
 
 	if diff := total.Sub(common.NewIntegerFromString(tx.Amount)); diff.Sign() > 0 {
 		amount, err := decimal.NewFromString(diff.String())
 		if err != nil {
 			return nil, nil, err
 		}
-		out := keys[1].DumpOutput(uint8(grp.threshold), amount)
+		out := keys[len(entries)].DumpOutput(uint8(ce.Threshold), amount)
 		ver.Outputs = append(ver.Outputs, newCommonOutput(out))
 	}
 
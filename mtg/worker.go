@@ -0,0 +1,188 @@
+package mtg
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/MixinNetwork/mixin/logger"
+)
+
+const (
+	// the output is handled, and the workers after are not called
+	WorkerResultHandled = iota + 1
+	// the output is not for the worker, and the next worker is called
+	WorkerResultSkipped
+	// the output should be handled later, and the actions after it are not
+	// blocked
+	WorkerResultRetryAfter
+	// the group must stop, the action stays initial
+	WorkerResultFatal
+)
+
+type WorkerResult struct {
+	Kind  int
+	After time.Duration
+	Err   error
+}
+
+func Handled() *WorkerResult {
+	return &WorkerResult{Kind: WorkerResultHandled}
+}
+
+func Skipped() *WorkerResult {
+	return &WorkerResult{Kind: WorkerResultSkipped}
+}
+
+// the duration is after the consensus time, and a zero duration retries
+// with the delay of the default retry policy, the same on all members
+func RetryAfter(d time.Duration) *WorkerResult {
+	return &WorkerResult{Kind: WorkerResultRetryAfter, After: d}
+}
+
+func Fatal(err error) *WorkerResult {
+	return &WorkerResult{Kind: WorkerResultFatal, Err: err}
+}
+
+// the route decides which outputs are passed to the worker, the memo prefix
+// matches the raw output memo, and the group id matches the one decoded from
+// the memo or by the grouper. an empty route matches all outputs.
+type WorkerRoute struct {
+	MemoPrefix string
+	GroupId    string
+}
+
+type routedWorker struct {
+	worker TypedWorker
+	route  *WorkerRoute
+}
+
+const actionRetryKeyPrefix = "MTG:ACTION:RETRY:"
+
+// the action retried is kept initial with the time not before, and the
+// attempts are persisted in the property until it's done
+type actionRetry struct {
+	NotBefore time.Time
+	Attempts  int
+}
+
+// the legacy worker handles the output when it returns true
+type boolWorker struct {
+	Worker
+}
+
+func (w *boolWorker) HandleOutput(ctx context.Context, out *Output) *WorkerResult {
+	if w.ProcessOutput(ctx, out) {
+		return Handled()
+	}
+	return Skipped()
+}
+
+func (w *boolWorker) HandleCollectibleOutput(ctx context.Context, out *CollectibleOutput) *WorkerResult {
+	if w.ProcessCollectibleOutput(ctx, out) {
+		return Handled()
+	}
+	return Skipped()
+}
+
+func (grp *Group) AddWorker(wkr Worker) {
+	grp.AddTypedWorker(&boolWorker{wkr}, nil)
+}
+
+// the outputs not matched by the route are never passed to the worker, and
+// the workers are called in the order added
+func (grp *Group) AddTypedWorker(wkr TypedWorker, route *WorkerRoute) {
+	grp.workers = append(grp.workers, &routedWorker{worker: wkr, route: route})
+}
+
+func (grp *Group) routeOutput(out *UnifiedOutput, route *WorkerRoute) bool {
+	if route == nil {
+		return true
+	}
+	if route.MemoPrefix != "" && !strings.HasPrefix(out.Memo, route.MemoPrefix) {
+		return false
+	}
+	if route.GroupId != "" {
+		if out.Type != OutputTypeMultisig {
+			return false
+		}
+		return grp.outputGroupId(out.AsMultisig()) == route.GroupId
+	}
+	return true
+}
+
+// pass the output to the routed workers until any result other than skipped,
+// and a nil result means skipped
+func (grp *Group) processActionOutput(ctx context.Context, out *UnifiedOutput) *WorkerResult {
+	for _, rw := range grp.workers {
+		if !grp.routeOutput(out, rw.route) {
+			continue
+		}
+		var res *WorkerResult
+		switch out.Type {
+		case OutputTypeMultisig:
+			res = rw.worker.HandleOutput(ctx, out.AsMultisig())
+		case OutputTypeCollectible:
+			res = rw.worker.HandleCollectibleOutput(ctx, out.AsCollectible())
+		default:
+			panic(out.Type)
+		}
+		if res != nil && res.Kind != WorkerResultSkipped {
+			return res
+		}
+	}
+	return Skipped()
+}
+
+// the action retried is moved back in the queue to the consensus time after
+// the duration, so the actions after it are not blocked, and all members
+// pass it to the workers again at the same point of the queue. the retry is
+// written before the action, so it's only retried at its old position with
+// the time not before if crashed between them
+func (grp *Group) scheduleActionRetry(ctx context.Context, out *UnifiedOutput, after time.Duration, attempts int) error {
+	if after <= 0 {
+		after = DefaultRetryPolicy().Delay(attempts)
+	}
+	now, _ := ConsensusTime(ctx)
+	r := &actionRetry{NotBefore: now.Add(after), Attempts: attempts}
+	logger.Printf("Group.scheduleActionRetry(%s, %d) => %s\n", out.UniqueId(), attempts, r.NotBefore)
+	err := grp.store.WriteProperty([]byte(actionRetryKeyPrefix+out.UniqueId()), MsgpackMarshalPanic(r))
+	if err != nil {
+		return newStoreError("Group.WriteProperty", err)
+	}
+	err = grp.store.WriteAction(&Action{
+		UTXOID:    out.UniqueId(),
+		CreatedAt: r.NotBefore,
+		State:     ActionStateInitial,
+	})
+	return newStoreError("Group.WriteAction", err)
+}
+
+func (grp *Group) readActionRetry(id string) (*actionRetry, error) {
+	val, err := grp.store.ReadProperty([]byte(actionRetryKeyPrefix + id))
+	if err != nil || len(val) == 0 {
+		return nil, newStoreError("Group.ReadProperty", err)
+	}
+	var r actionRetry
+	err = MsgpackUnmarshal(val, &r)
+	if err != nil {
+		return nil, newStoreError("Group.ReadProperty", err)
+	}
+	return &r, nil
+}
+
+// the action retried waits until all outputs created before the time not
+// before have been drained, so it's handled after the same actions on all
+// members, without the local time
+func (grp *Group) readyActionRetry(ctx context.Context, r *actionRetry) (bool, error) {
+	checkpoint, err := grp.readDrainingCheckpoint(ctx, grp.currentEpoch(), outputsOrderCreated)
+	if err != nil {
+		return false, newStoreError("Group.readDrainingCheckpoint", err)
+	}
+	return !checkpoint.Before(r.NotBefore), nil
+}
+
+func (grp *Group) clearActionRetry(id string) error {
+	err := grp.store.WriteProperty([]byte(actionRetryKeyPrefix+id), nil)
+	return newStoreError("Group.WriteProperty", err)
+}
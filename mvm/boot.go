@@ -6,9 +6,12 @@ import (
 	"log"
 	"net/http"
 	_ "net/http/pprof"
+	"os"
+	"os/signal"
 	"os/user"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/MixinNetwork/mixin/logger"
@@ -26,7 +29,8 @@ import (
 
 func bootCmd(c *cli.Context) error {
 	logger.SetLevel(logger.VERBOSE)
-	ctx := context.Background()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	cp := c.String("config")
 	if strings.HasPrefix(cp, "~/") {
@@ -80,35 +84,62 @@ func bootCmd(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if rounds := conf.MTG.DigestRounds; rounds > 0 {
+		err = group.SetDigestExchange(&mtg.DigestExchange{Messenger: messenger, Rounds: rounds})
+		if err != nil {
+			return err
+		}
+	}
 	im, err := machine.Boot(conf.Machine, group, db, messenger, mixin)
 	if err != nil {
 		return err
 	}
 
-	en, err := quorum.Boot(conf.Quorum)
+	en, err := quorum.Boot(ctx, conf.Quorum)
 	if err != nil {
 		return err
 	}
+	defer en.Close()
 	im.AddEngine(machine.ProcessPlatformQuorum, en)
 
 	go func() {
 		if c.Int("port") < 1000 {
 			return
 		}
-		server := rpc.NewServer(en, db, conf, c.Int("port"))
+		server := rpc.NewServer(en, group, db, conf, c.Int("port"))
 		err := server.ListenAndServe()
 		if err != nil {
 			panic(err)
 		}
 	}()
 
-	go im.Loop(ctx)
+	machineDone := make(chan struct{})
+	go func() {
+		im.Loop(ctx)
+		close(machineDone)
+	}()
 	go RunMonitor(ctx, messenger, db)
 
+	// the group finishes the current stage before stop, then all other
+	// loops are cancelled before the stores closed
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		s := <-sig
+		logger.Printf("bootCmd() => signal %s\n", s)
+		group.Stop()
+	}()
+
 	group.SetOutputGrouper(machine.OutputGrouper)
+	if ts := conf.Machine.RefundAfter; ts > 0 {
+		group.SetRefundPolicy(&mtg.RefundPolicy{AllAssets: true, Collectibles: true, After: time.Unix(0, ts)})
+	}
 	group.AddWorker(im)
 	group.Run(ctx)
 
+	cancel()
+	<-machineDone
+	logger.Printf("bootCmd() => stopped\n")
 	return nil
 }
 
@@ -18,34 +18,34 @@ type CollectibleToken struct {
 	CollectionSymbol string
 }
 
-func (m *Machine) WriteNFOGroupEvent(ctx context.Context, pid string, out *mtg.CollectibleOutput, extra []byte) {
+func (m *Machine) WriteNFOGroupEvent(ctx context.Context, pid string, out *mtg.CollectibleOutput, extra []byte) bool {
 	logger.Verbosef("Machine.WriteNFOGroupEvent(%s, %v, %x)", pid, out, extra)
 	m.procLock.RLock()
 	defer m.procLock.RUnlock()
 
 	proc := m.processes[pid]
 	if proc == nil {
-		return
+		return false
 	}
 	meta, err := m.fetchCollectibleToken(ctx, out.TokenId)
 	if err != nil {
 		panic(err)
 	}
 	if len(meta) == 0 {
-		return
+		return false
 	}
 	if proc.Asset {
 		extra = append(meta, extra...)
 	}
 	if len(extra) > encoding.EventExtraMaxSize {
-		return
+		return false
 	}
 
 	done, err := m.store.CheckPendingGroupEventIdentifier(out.OutputId)
 	if err != nil {
 		panic(err)
 	} else if done {
-		return
+		return true
 	}
 
 	amount := common.NewIntegerFromString(out.Amount.String())
@@ -72,6 +72,7 @@ func (m *Machine) WriteNFOGroupEvent(ctx context.Context, pid string, out *mtg.C
 		panic(err)
 	}
 	proc.Nonce = proc.Nonce + 1
+	return true
 }
 
 func (m *Machine) fetchCollectibleToken(ctx context.Context, id string) ([]byte, error) {
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/MixinNetwork/mixin/common"
 	"github.com/MixinNetwork/mixin/logger"
@@ -27,6 +28,7 @@ type Configuration struct {
 	Share            string `toml:"share"`
 	ProcessFeeAsset  string `toml:"process-fee-asset"`
 	ProcessFeeAmount string `toml:"process-fee-amount"`
+	RefundAfter      int64  `toml:"refund-unhandled-after"`
 }
 
 type Machine struct {
@@ -42,6 +44,7 @@ type Machine struct {
 	processes  map[string]*Process
 	procLock   *sync.RWMutex
 	signerLock *sync.Mutex
+	loops      *sync.WaitGroup
 }
 
 func Boot(conf *Configuration, group *mtg.Group, store Store, m messenger.Messenger, mixin *mixin.Client) (*Machine, error) {
@@ -80,6 +83,7 @@ func Boot(conf *Configuration, group *mtg.Group, store Store, m messenger.Messen
 		processes:  make(map[string]*Process),
 		procLock:   new(sync.RWMutex),
 		signerLock: new(sync.Mutex),
+		loops:      new(sync.WaitGroup),
 	}, nil
 }
 
@@ -92,8 +96,15 @@ func (m *Machine) Loop(ctx context.Context) {
 		m.processes[p.Identifier] = p
 		m.Spawn(ctx, p)
 	}
-	go m.loopReceiveGroupMessages(ctx)
+	m.loops.Add(1)
+	go func() {
+		defer m.loops.Done()
+		m.loopReceiveGroupMessages(ctx)
+	}()
 	m.loopSignGroupEvents(ctx)
+
+	// all process loops return after the context done
+	m.loops.Wait()
 }
 
 func (m *Machine) AddEngine(platform string, engine Engine) {
@@ -165,34 +176,36 @@ func (m *Machine) AddProcess(ctx context.Context, pid string, platform, address
 	return true
 }
 
-func (m *Machine) WriteGroupEvent(ctx context.Context, pid string, out *mtg.Output, extra []byte) {
+// the output is handled when the event written, otherwise it's refunded by
+// the group refund policy
+func (m *Machine) WriteGroupEvent(ctx context.Context, pid string, out *mtg.Output, extra []byte) bool {
 	logger.Verbosef("Machine.WriteGroupEvent(%s, %v, %x)", pid, out, extra)
 	m.procLock.RLock()
 	defer m.procLock.RUnlock()
 
 	proc := m.processes[pid]
 	if proc == nil {
-		return
+		return false
 	}
 	meta, err := m.fetchAssetMeta(ctx, out.AssetID, true)
 	if err != nil {
 		panic(err)
 	}
 	if meta == nil {
-		return
+		return false
 	}
 	if proc.Asset {
 		extra = append(meta, extra...)
 	}
 	if len(extra) > encoding.EventExtraMaxSize {
-		return
+		return false
 	}
 
 	done, err := m.store.CheckPendingGroupEventIdentifier(out.UTXOID)
 	if err != nil {
 		panic(err)
 	} else if done {
-		return
+		return true
 	}
 
 	amount := common.NewIntegerFromString(out.Amount.String())
@@ -216,6 +229,7 @@ func (m *Machine) WriteGroupEvent(ctx context.Context, pid string, out *mtg.Outp
 		panic(err)
 	}
 	proc.Nonce = proc.Nonce + 1
+	return true
 }
 
 func OutputGrouper(out *mtg.Output) string {
@@ -226,6 +240,13 @@ func OutputGrouper(out *mtg.Output) string {
 	return op.Process
 }
 
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
 func unmarshalPrivShare(b []byte) *share.PriShare {
 	var ps share.PriShare
 	ps.V = mod.NewInt64(0, en256.Order).SetBytes(b[4:])
@@ -30,19 +30,26 @@ type Process struct {
 
 func (m *Machine) Spawn(ctx context.Context, p *Process) {
 	logger.Verbosef("Spawn(%s, %s, %s, %d)", p.Identifier, p.Platform, p.Address, p.Nonce)
-	go m.loopSendEvents(ctx, p)
-	go m.loopReceiveEvents(ctx, p)
+	m.loops.Add(2)
+	go func() {
+		defer m.loops.Done()
+		m.loopSendEvents(ctx, p)
+	}()
+	go func() {
+		defer m.loops.Done()
+		m.loopReceiveEvents(ctx, p)
+	}()
 }
 
 func (m *Machine) loopSendEvents(ctx context.Context, p *Process) {
 	engine := m.engines[p.Platform]
-	for {
+	for ctx.Err() == nil {
 		events, err := m.store.ListSignedGroupEvents(p.Identifier, 100)
 		if err != nil {
 			panic(err)
 		}
 		if len(events) == 0 {
-			time.Sleep(5 * time.Second)
+			sleep(ctx, 5*time.Second)
 			continue
 		}
 		cost, err := engine.EstimateCost(events)
@@ -50,7 +57,7 @@ func (m *Machine) loopSendEvents(ctx context.Context, p *Process) {
 			panic(err)
 		}
 		if p.Credit.Cmp(cost.Mul(ProcessCreditMulplifier)) < 0 {
-			time.Sleep(1 * time.Minute)
+			sleep(ctx, 1*time.Minute)
 			continue
 		}
 
@@ -71,17 +78,20 @@ func (m *Machine) loopSendEvents(ctx context.Context, p *Process) {
 func (m *Machine) loopReceiveEvents(ctx context.Context, p *Process) {
 	engine := m.engines[p.Platform]
 	processed := make(map[uint64]bool)
-	for {
+	for ctx.Err() == nil {
 		offset, err := m.store.ReadEngineGroupEventsOffset(p.Identifier)
 		if err != nil {
 			panic(err)
 		}
 		events, err := engine.ReceiveGroupEvents(p.Address, offset, 100)
 		if err != nil {
-			time.Sleep(1 * time.Minute)
+			sleep(ctx, 1*time.Minute)
 			continue
 		}
 		for _, e := range events {
+			if ctx.Err() != nil {
+				return
+			}
 			if e.Process != p.Identifier {
 				continue
 			}
@@ -97,7 +107,7 @@ func (m *Machine) loopReceiveEvents(ctx context.Context, p *Process) {
 				panic(err)
 			} else if !enough {
 				logger.Verbosef("Process(%s, %d) => balance %s %s", p.Identifier, e.Nonce, e.Asset, e.Amount)
-				time.Sleep(1 * time.Minute)
+				sleep(ctx, 1*time.Minute)
 				break
 			}
 			processed[e.Nonce] = true
@@ -121,7 +131,7 @@ func (m *Machine) loopReceiveEvents(ctx context.Context, p *Process) {
 			}
 		}
 		if len(events) < 100 {
-			time.Sleep(5 * time.Second)
+			sleep(ctx, 5*time.Second)
 		}
 	}
 }
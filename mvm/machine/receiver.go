@@ -18,7 +18,8 @@ type Asset struct {
 }
 
 var (
-	// because the sdk bug, this output is skipped, and should always be in the future
+	// because the sdk bug, this output is skipped, and should always be in the future,
+	// it's handled without any event so never refunded
 	InvalidCollectibleOutputHackMap = map[string]bool{
 		"271d7ef5-6bf3-3b96-9c0c-701f7a989435": true,
 		"8f96c027-fbf0-39dc-99b7-6ba6cdf9c66c": true,
@@ -35,16 +36,16 @@ func (m *Machine) ProcessOutput(ctx context.Context, out *mtg.Output) bool {
 	}
 	switch op.Purpose {
 	case encoding.OperationPurposeAddProcess:
-		m.AddProcess(ctx, op.Process, op.Platform, op.Address, out, op.Extra)
+		return m.AddProcess(ctx, op.Process, op.Platform, op.Address, out, op.Extra)
 	case encoding.OperationPurposeGroupEvent:
-		m.WriteGroupEvent(ctx, op.Process, out, op.Extra)
+		return m.WriteGroupEvent(ctx, op.Process, out, op.Extra)
 	}
 	return false
 }
 
 func (m *Machine) ProcessCollectibleOutput(ctx context.Context, out *mtg.CollectibleOutput) bool {
 	if InvalidCollectibleOutputHackMap[out.OutputId] {
-		return false
+		return true
 	}
 	op, err := parseOperation(out.Memo)
 	logger.Verbosef("Machine.ProcessCollectibleOutput(%v) => %v %v", out, op, err)
@@ -53,7 +54,7 @@ func (m *Machine) ProcessCollectibleOutput(ctx context.Context, out *mtg.Collect
 	}
 	switch op.Purpose {
 	case encoding.OperationPurposeGroupEvent:
-		m.WriteNFOGroupEvent(ctx, op.Process, out, op.Extra)
+		return m.WriteNFOGroupEvent(ctx, op.Process, out, op.Extra)
 	}
 	return false
 }
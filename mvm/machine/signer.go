@@ -28,7 +28,11 @@ func (m *Machine) getProcess(pid string) *Process {
 func (m *Machine) loopSignGroupEvents(ctx context.Context) {
 	sm := make(map[string]time.Time)
 	for {
-		time.Sleep(3 * time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(3 * time.Second):
+		}
 		events, err := m.store.ListPendingGroupEvents(100)
 		if err != nil {
 			panic(err)
@@ -72,10 +76,20 @@ func (m *Machine) loopReceiveGroupMessages(ctx context.Context) {
 	sm := make(map[string]time.Time)
 	for {
 		peer, b, err := m.messenger.ReceiveMessage(ctx)
+		if err != nil && ctx.Err() != nil {
+			return
+		}
 		if err != nil {
 			logger.Verbosef("Machine.ReceiveMessage() => %s", err)
 			panic(err)
 		}
+		digest, err := m.group.HandleDigestMessage(ctx, peer, b)
+		if err != nil {
+			logger.Verbosef("HandleDigestMessage(%s, %x) => %s", peer, b, err)
+		}
+		if digest {
+			continue
+		}
 		evt, err := encoding.DecodeEvent(b[:len(b)-8])
 		if err != nil {
 			logger.Verbosef("DecodeEvent(%x) => %s", b, err)
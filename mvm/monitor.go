@@ -13,7 +13,7 @@ import (
 func RunMonitor(ctx context.Context, messenger messenger.Messenger, store machine.Store) {
 	startedAt := time.Now()
 
-	for {
+	for ctx.Err() == nil {
 		msg, err := bundleMachineState(ctx, store, startedAt)
 		if err != nil {
 			logger.Verbosef("Monitor.bundleMachineState() => %v", err)
@@ -21,7 +21,11 @@ func RunMonitor(ctx context.Context, messenger messenger.Messenger, store machin
 		}
 		err = messenger.BroadcastPlainMessage(ctx, msg)
 		logger.Verbosef("Monitor.BroadcastPlainMessage(%x) => %v", msg, err)
-		time.Sleep(30 * time.Minute)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(30 * time.Minute):
+		}
 	}
 }
 
@@ -1,7 +1,9 @@
 package quorum
 
 import (
+	"context"
 	"encoding/hex"
+	"sync"
 	"time"
 
 	"github.com/MixinNetwork/mixin/common"
@@ -40,15 +42,17 @@ type Engine struct {
 	rpc     *RPC
 	chainId int64
 	key     string
+	loops   *sync.WaitGroup
 }
 
-func Boot(conf *Configuration) (*Engine, error) {
+// all the engine loops return when the context is done
+func Boot(ctx context.Context, conf *Configuration) (*Engine, error) {
 	db := openBadger(conf.Store)
 	rpc, err := NewRPC(conf.RPC, conf.Base)
 	if err != nil {
 		return nil, err
 	}
-	e := &Engine{db: db, rpc: rpc, chainId: conf.ChainId}
+	e := &Engine{db: db, rpc: rpc, chainId: conf.ChainId, loops: new(sync.WaitGroup)}
 	if conf.PrivateKey != "" {
 		priv, err := crypto.HexToECDSA(conf.PrivateKey)
 		if err != nil {
@@ -56,11 +60,25 @@ func Boot(conf *Configuration) (*Engine, error) {
 		}
 		e.key = hex.EncodeToString(crypto.FromECDSA(priv))
 	}
-	go e.loopGetLogs(conf.Base)
-	go e.loopHandleContracts()
+	e.spawn(func() { e.loopGetLogs(ctx, conf.Base) })
+	e.spawn(func() { e.loopHandleContracts(ctx) })
 	return e, nil
 }
 
+// wait until all loops returned, then close the store
+func (e *Engine) Close() error {
+	e.loops.Wait()
+	return e.db.Close()
+}
+
+func (e *Engine) spawn(loop func()) {
+	e.loops.Add(1)
+	go func() {
+		defer e.loops.Done()
+		loop()
+	}()
+}
+
 func (e *Engine) Hash(b []byte) []byte {
 	return crypto.Keccak256(b)
 }
@@ -122,10 +140,10 @@ func (e *Engine) IsPublisher() bool {
 	return e.key != ""
 }
 
-func (e *Engine) loopGetLogs(base uint64) {
+func (e *Engine) loopGetLogs(ctx context.Context, base uint64) {
 	logger.Verbosef("Engine.loopGetLogs(%d)", base)
 
-	for {
+	for ctx.Err() == nil {
 		offset := e.storeReadContractLogsOffset()
 		if offset < base {
 			offset = base
@@ -133,7 +151,7 @@ func (e *Engine) loopGetLogs(base uint64) {
 		logs, err := e.rpc.GetLogs(EventTopic, offset, offset+10)
 		logger.Verbosef("loopGetLogs(%d) => GetLogs(%d) => %d, %v", base, offset, len(logs), err)
 		if err != nil {
-			time.Sleep(1 * time.Minute)
+			sleep(ctx, 1*time.Minute)
 			continue
 		}
 		for _, log := range logs {
@@ -149,7 +167,7 @@ func (e *Engine) loopGetLogs(base uint64) {
 		}
 		height, err := e.rpc.GetBlockHeight()
 		if err != nil || offset+10 > height {
-			time.Sleep(ClockTick)
+			sleep(ctx, ClockTick)
 			continue
 		}
 		err = e.storeWriteContractLogsOffset(offset + 10)
@@ -159,24 +177,24 @@ func (e *Engine) loopGetLogs(base uint64) {
 	}
 }
 
-func (e *Engine) loopSendGroupEvents(address string) {
+func (e *Engine) loopSendGroupEvents(ctx context.Context, address string) {
 	logger.Verbosef("Engine.loopSendGroupEvents(%s)", address)
 	notifier := e.storeReadContractNotifier(address)
 
-	for e.IsPublisher() {
+	for e.IsPublisher() && ctx.Err() == nil {
 		balance, err := e.rpc.GetAddressBalance(pub(notifier))
 		if err != nil {
 			logger.Verbosef("loopSendGroupEvents(%s) => GetAddressBalance(%s) => %v", address, pub(notifier), err)
-			time.Sleep(5 * time.Second)
+			sleep(ctx, 5*time.Second)
 			continue
 		}
 		if balance.Cmp(decimal.NewFromFloat(NotifierMinimumBalance/2)) < 0 {
-			time.Sleep(5 * time.Second)
+			sleep(ctx, 5*time.Second)
 			continue
 		}
 		nonce, err := e.rpc.GetAddressNonce(pub(notifier))
 		if err != nil {
-			time.Sleep(5 * time.Second)
+			sleep(ctx, 5*time.Second)
 			continue
 		}
 		evts, err := e.storeListGroupEvents(address, nonce, 100)
@@ -193,15 +211,19 @@ func (e *Engine) loopSendGroupEvents(address string) {
 			res, err := e.rpc.SendRawTransaction(raw)
 			logger.Verbosef("loopSendGroupEvents(%s) => SendRawTransaction(%s, %s) => %s, %v", address, id, raw, res, err)
 		}
-		time.Sleep(ClockTick)
+		sleep(ctx, ClockTick)
 	}
 }
 
-func (e *Engine) loopHandleContracts() {
+func (e *Engine) loopHandleContracts(ctx context.Context) {
 	contracts := make(map[string]bool)
 
 	for {
-		time.Sleep(ClockTick)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ClockTick):
+		}
 		all, err := e.storeListContractAddresses()
 		if err != nil {
 			panic(err)
@@ -211,7 +233,8 @@ func (e *Engine) loopHandleContracts() {
 				continue
 			}
 			contracts[c] = true
-			go e.loopSendGroupEvents(c)
+			address := c
+			e.spawn(func() { e.loopSendGroupEvents(ctx, address) })
 		}
 		if !e.IsPublisher() {
 			continue
@@ -219,7 +242,7 @@ func (e *Engine) loopHandleContracts() {
 
 		nonce, err := e.rpc.GetAddressNonce(pub(e.key))
 		if err != nil {
-			time.Sleep(1 * time.Minute)
+			sleep(ctx, 1*time.Minute)
 			continue
 		}
 		for _, c := range all {
@@ -239,6 +262,13 @@ func (e *Engine) loopHandleContracts() {
 	}
 }
 
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
 func pub(priv string) string {
 	key, _ := crypto.HexToECDSA(priv)
 	return crypto.PubkeyToAddress(key.PublicKey).Hex()
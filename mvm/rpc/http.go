@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/MixinNetwork/trusted-group/mtg"
 	"github.com/MixinNetwork/trusted-group/mvm/config"
 	"github.com/MixinNetwork/trusted-group/mvm/machine"
 	"github.com/MixinNetwork/trusted-group/mvm/store"
@@ -13,8 +14,10 @@ import (
 
 type RPC struct {
 	engine machine.Engine
+	group  *mtg.Group
 	store  *store.BadgerStore
 	conf   *config.Configuration
+	status *statusCache
 }
 
 type Call struct {
@@ -79,7 +82,7 @@ func (impl *RPC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	renderer := &Render{w: w, id: call.Id}
 	switch call.Method {
 	case "getinfo":
-		info, err := getInfo(impl.store)
+		info, err := getInfo(r.Context(), impl)
 		if err != nil {
 			renderer.RenderError(err)
 		} else {
@@ -124,11 +127,13 @@ func handleCORS(handler http.Handler) http.Handler {
 	})
 }
 
-func NewServer(engine machine.Engine, store *store.BadgerStore, conf *config.Configuration, port int) *http.Server {
+func NewServer(engine machine.Engine, group *mtg.Group, store *store.BadgerStore, conf *config.Configuration, port int) *http.Server {
 	rpc := &RPC{
 		engine: engine,
+		group:  group,
 		store:  store,
 		conf:   conf,
+		status: &statusCache{},
 	}
 	handler := handleCORS(rpc)
 
@@ -1,11 +1,14 @@
 package rpc
 
 import (
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"sync"
 	"time"
 
+	"github.com/MixinNetwork/trusted-group/mtg"
 	"github.com/MixinNetwork/trusted-group/mvm/config"
 	"github.com/MixinNetwork/trusted-group/mvm/crypto"
 	"github.com/MixinNetwork/trusted-group/mvm/crypto/en256"
@@ -16,10 +19,38 @@ import (
 
 const (
 	outputsDrainingKey = "outputs-draining-checkpoint"
+
+	// the rpc is public and the status reads the store, so it's cached
+	groupStatusCacheDuration = 30 * time.Second
 )
 
-func getInfo(store *store.BadgerStore) (map[string]any, error) {
-	odc, err := readDrainingCheckpoint(store, outputsDrainingKey)
+type statusCache struct {
+	sync.Mutex
+	status *mtg.Status
+	at     time.Time
+}
+
+func (sc *statusCache) read(ctx context.Context, group *mtg.Group) (*mtg.Status, error) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	if sc.status != nil && time.Since(sc.at) < groupStatusCacheDuration {
+		return sc.status, nil
+	}
+	status, err := group.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sc.status, sc.at = status, time.Now()
+	return status, nil
+}
+
+func getInfo(ctx context.Context, impl *RPC) (map[string]any, error) {
+	odc, err := readDrainingCheckpoint(impl.store, outputsDrainingKey)
+	if err != nil {
+		return nil, err
+	}
+	status, err := impl.status.read(ctx, impl.group)
 	if err != nil {
 		return nil, err
 	}
@@ -28,6 +59,7 @@ func getInfo(store *store.BadgerStore) (map[string]any, error) {
 			"outputs": map[string]any{
 				"draining": odc,
 			},
+			"status": status,
 		},
 	}, nil
 }